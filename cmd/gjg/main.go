@@ -0,0 +1,65 @@
+// Command gjg is the release tool for GJG launcher installations.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+)
+
+var version = "dev"
+
+type command struct {
+	name    string
+	summary string
+	run     func(args []string) error
+}
+
+var commands = []command{
+	{"manifest", "write gjg.manifest with the SHA-256 of the given files", runManifest},
+	{"keygen", "create an Ed25519 key pair for signing", runKeygen},
+	{"sign", "write detached .sig signatures for the given files", runSign},
+	{"stamp", "write icons, version info, manifest and config into a launcher .exe", runStamp},
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+	name := os.Args[1]
+	if name == "version" || name == "-version" || name == "--version" {
+		fmt.Println(version)
+		return
+	}
+	for _, c := range commands {
+		if c.name == name {
+			if err := c.run(os.Args[2:]); err != nil {
+				fmt.Fprintf(os.Stderr, "gjg %s: %v\n", name, err)
+				os.Exit(1)
+			}
+			return
+		}
+	}
+	fmt.Fprintf(os.Stderr, "gjg: unknown command %q\n\n", name)
+	usage()
+	os.Exit(2)
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: gjg <command> [arguments]\n\nCommands:\n")
+	for _, c := range commands {
+		fmt.Fprintf(os.Stderr, "  %-10s %s\n", c.name, c.summary)
+	}
+	fmt.Fprintf(os.Stderr, "  %-10s %s\n", "version", "print the tool version")
+}
+
+// newFlagSet returns a flag set whose usage shows synopsis.
+func newFlagSet(name, synopsis string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: gjg %s %s\n", name, synopsis)
+		fs.PrintDefaults()
+	}
+	return fs
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"gjg/internal/manifest"
+	"os"
+	"path/filepath"
+)
+
+func runManifest(args []string) error {
+	fs := newFlagSet("manifest", "[-dir dir] [-o file] path...")
+	dir := fs.String("dir", ".", "installation directory the paths are recorded relative to")
+	out := fs.String("o", "", "output file (default <dir>/"+manifest.FileName+")")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return errors.New("no files given")
+	}
+
+	root, err := filepath.Abs(*dir)
+	if err != nil {
+		return err
+	}
+	m, err := manifest.Generate(root, fs.Args())
+	if err != nil {
+		return err
+	}
+
+	path := *out
+	if path == "" {
+		path = filepath.Join(root, manifest.FileName)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := m.Write(f); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	fmt.Printf("%s: %d files\n", path, len(m.Entries))
+	return nil
+}
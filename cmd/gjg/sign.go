@@ -0,0 +1,70 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"gjg/internal/signature"
+	"os"
+)
+
+func runKeygen(args []string) error {
+	fs := newFlagSet("keygen", "[-o name]")
+	name := fs.String("o", "gjg-signing", "write <name>.key (private) and <name>.pub (public)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	pub, priv, err := signature.GenerateKey()
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(*name + ".key"); err == nil {
+		return fmt.Errorf("%s.key already exists", *name)
+	}
+	if err := os.WriteFile(*name+".key", []byte(priv+"\n"), 0600); err != nil {
+		return err
+	}
+	if err := os.WriteFile(*name+".pub", []byte(pub+"\n"), 0644); err != nil {
+		return err
+	}
+	fmt.Printf("Private key: %s.key (keep it secret)\n", *name)
+	fmt.Printf("Public key:  %s.pub\n\n", *name)
+	fmt.Printf("Build the launcher with:\n  -ldflags \"-X gjg/internal/signature.PublicKey=%s\"\n", pub)
+	return nil
+}
+
+func runSign(args []string) error {
+	fs := newFlagSet("sign", "-key file path...")
+	keyFile := fs.String("key", "", "private key file written by gjg keygen (or set GJG_SIGNING_KEY)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return errors.New("no files given")
+	}
+
+	encoded := os.Getenv("GJG_SIGNING_KEY")
+	if *keyFile != "" {
+		data, err := os.ReadFile(*keyFile)
+		if err != nil {
+			return err
+		}
+		encoded = string(data)
+	}
+	if encoded == "" {
+		return errors.New("no private key: use -key or GJG_SIGNING_KEY")
+	}
+	key, err := signature.ParsePrivateKey(encoded)
+	if err != nil {
+		return fmt.Errorf("invalid private key: %w", err)
+	}
+
+	for _, path := range fs.Args() {
+		if err := signature.SignFile(key, path); err != nil {
+			return err
+		}
+		fmt.Printf("%s%s\n", path, signature.Ext)
+	}
+	return nil
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"gjg/internal/fsutil"
+	"gjg/internal/signature"
+	"gjg/internal/winres"
+	"os"
+	"strings"
+)
+
+// listFlag collects the values of a repeatable flag.
+type listFlag []string
+
+func (l *listFlag) String() string { return strings.Join(*l, ",") }
+
+func (l *listFlag) Set(v string) error {
+	*l = append(*l, v)
+	return nil
+}
+
+func runStamp(args []string) error {
+	fs := newFlagSet("stamp", "[flags] launcher.exe")
+	var icons, infos listFlag
+	fs.Var(&icons, "icon", "`.ico` file for the application icon (repeatable; the first one is shown by Explorer)")
+	version := fs.String("version", "", "file version, e.g. 1.2.3.4")
+	productVersion := fs.String("product-version", "", "product version (default -version)")
+	fs.Var(&infos, "info", "version string `Key=Value`, e.g. ProductName=My App (repeatable)")
+	manifestFile := fs.String("manifest", "", "application manifest `file`")
+	configFile := fs.String("config", "", "`.gjg.conf` to bake into the executable (its .sig is baked too)")
+	out := fs.String("o", "", "output file (default: stamp launcher.exe in place)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("expected one launcher executable")
+	}
+	exe := fs.Arg(0)
+
+	data, err := os.ReadFile(exe)
+	if err != nil {
+		return err
+	}
+	set, err := winres.Read(data)
+	if err != nil {
+		return fmt.Errorf("%s: %w", exe, err)
+	}
+
+	for i, path := range icons {
+		ico, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if err := set.SetIcon(winres.IntID(uint16(i+1)), ico); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+	}
+
+	if *version != "" || len(infos) > 0 {
+		info, err := versionInfo(*version, *productVersion, infos)
+		if err != nil {
+			return err
+		}
+		set.Put(winres.Resource{Type: winres.IntID(winres.TypeVersion), Name: winres.IntID(1), Lang: winres.LangEnUS, Data: info.Bytes()})
+	}
+
+	if *manifestFile != "" {
+		m, err := os.ReadFile(*manifestFile)
+		if err != nil {
+			return err
+		}
+		set.Put(winres.Resource{Type: winres.IntID(winres.TypeManifest), Name: winres.IntID(1), Lang: winres.LangEnUS, Data: m})
+	}
+
+	if *configFile != "" {
+		if err := bakeConfig(&set, *configFile); err != nil {
+			return err
+		}
+	}
+
+	stamped, err := winres.Write(data, set)
+	if err != nil {
+		return fmt.Errorf("%s: %w", exe, err)
+	}
+	path := *out
+	if path == "" {
+		path = exe
+	}
+	if err := fsutil.WriteFile(path, stamped, 0755); err != nil {
+		return err
+	}
+	fmt.Printf("%s: %d resources\n", path, len(set))
+	return nil
+}
+
+// versionInfo builds the VERSIONINFO from the -version, -product-version and
+// -info flags.
+func versionInfo(version, productVersion string, infos []string) (winres.VersionInfo, error) {
+	info := winres.VersionInfo{Strings: map[string]string{}}
+	var err error
+	if version != "" {
+		if info.FileVersion, err = winres.ParseVersion(version); err != nil {
+			return info, err
+		}
+		info.Strings["FileVersion"] = version
+		info.ProductVersion = info.FileVersion
+		info.Strings["ProductVersion"] = version
+	}
+	if productVersion != "" {
+		if info.ProductVersion, err = winres.ParseVersion(productVersion); err != nil {
+			return info, err
+		}
+		info.Strings["ProductVersion"] = productVersion
+	}
+	for _, kv := range infos {
+		k, v, ok := strings.Cut(kv, "=")
+		if !ok || k == "" {
+			return info, fmt.Errorf("invalid -info %q (expected Key=Value)", kv)
+		}
+		info.Strings[k] = v
+	}
+	return info, nil
+}
+
+// bakeConfig stores the config file, and its signature when there is one, as
+// RCDATA resources.
+func bakeConfig(set *winres.Set, path string) error {
+	conf, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	set.Put(winres.Resource{Type: winres.IntID(winres.TypeRCData), Name: winres.StringID(winres.ConfigName), Lang: winres.LangEnUS, Data: conf})
+
+	sigName := winres.StringID(winres.ConfigSigName)
+	sig, err := os.ReadFile(path + signature.Ext)
+	switch {
+	case err == nil:
+		set.Put(winres.Resource{Type: winres.IntID(winres.TypeRCData), Name: sigName, Lang: winres.LangEnUS, Data: sig})
+	case errors.Is(err, os.ErrNotExist):
+		set.Remove(winres.IntID(winres.TypeRCData), sigName)
+	default:
+		return err
+	}
+	return nil
+}
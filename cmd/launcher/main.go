@@ -1,12 +1,25 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"gjg/internal/args"
-	"gjg/internal/config"
+	"gjg/internal/diagnose"
+	"gjg/internal/effective"
+	"gjg/internal/history"
+	"gjg/internal/logfile"
+	"gjg/internal/logging"
+	"gjg/internal/paths"
+	"gjg/internal/plan"
+	"gjg/internal/redact"
 	"gjg/internal/runner"
+	"gjg/launcher"
+	"io"
+	"log/slog"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"slices"
 	"strings"
 	"time"
 )
@@ -14,93 +27,337 @@ import (
 var version = "dev"
 
 func main() {
-	debug, dryRun, forwardArgs := args.ExtractSpecial(os.Args[1:])
+	os.Exit(run(os.Args[1:], launcher.Options{}))
+}
+
+// run is the launcher's command line: it handles the --gjg-* flags and
+// returns the process exit code. base holds the options that locate the
+// executable, its configuration and caches; empty fields use the defaults.
+func run(argv []string, base launcher.Options) int {
+	flags, forwardArgs := args.Parse(argv)
 
-	var logFile *os.File
-	if debug {
-		userConfigDir, err := os.UserCacheDir()
+	outputs := []io.Writer{os.Stderr}
+	if flags.Debug {
+		if f := openDebugLog(); f != nil {
+			defer f.Close()
+			outputs = append(outputs, f)
+		}
+	}
+	redactor := redact.Default()
+	log, err := newLogger(flags, outputs, redactor)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[GJG] %v\n", err)
+		return 1
+	}
+
+	log.Debug("Starting launcher", "version", version)
+
+	if flags.History {
+		return printHistory(log)
+	}
+
+	var p *launcher.LaunchPlan
+	if flags.RunPlan != "" {
+		if p, err = launcher.LoadPlan(flags.RunPlan, base); err != nil {
+			log.Error("Error loading plan", "error", err)
+			return 1
+		}
+		if redactor, err = redact.New(p.Redact); err != nil {
+			log.Error("Error loading plan", "error", err)
+			return 1
+		}
+		if len(forwardArgs) > 0 {
+			log.Warn("Ignoring command-line arguments; the plan has its own", "args", forwardArgs)
+		}
+		log.Debug("Plan loaded", "path", flags.RunPlan)
+	} else {
+		loadOpts := base
+		loadOpts.Logger, loadOpts.UseVersion, loadOpts.JNLP = log, flags.UseVersion, jnlpSource(flags.JNLP)
+		cfg, confPath, err := launcher.Load(loadOpts)
+		if err == nil && flags.Rollback {
+			cfg, confPath, err = rollbackVersion(log, cfg, loadOpts)
+		}
+		if err == nil {
+			redactor, err = redact.New(cfg.Redact)
+		}
 		if err == nil {
-			logFilePath := filepath.Join(userConfigDir, "gjg", getExeName(), "gjg-debug.log")
-			_ = os.MkdirAll(filepath.Dir(logFilePath), 0755)
-			logFile, _ = os.Create(logFilePath)
-			if logFile != nil {
-				defer logFile.Close()
+			// Mask the configured patterns in everything logged from here on
+			if log, err = newLogger(flags, outputs, redactor); err == nil {
+				loadOpts.Logger = log
 			}
 		}
+		if flags.Diagnose {
+			return runDiagnose(log, redactor, base, cfg, confPath, err, forwardArgs)
+		}
+		if err == nil && flags.PrintConfig != "" {
+			// Show the configuration as it is, without downloading anything
+			return printConfig(log, flags.PrintConfig, effective.Build(cfg, confPath, plan.Argv(cfg, forwardArgs), forwardArgs, os.Environ(), redactor))
+		}
+		if err == nil {
+			cfg, confPath, err = prepare(cfg, confPath, loadOpts, !flags.DryRun)
+		}
+		if err == nil {
+			p, err = launcher.Plan(cfg, confPath, forwardArgs)
+		}
+		if err != nil {
+			log.Error("Error loading config", "error", err)
+			return 1
+		}
+
+		log.Debug("Configuration loaded", "path", confPath)
+		for _, path := range launcher.InsecurePaths(cfg, confPath) {
+			log.Warn("Can be modified by other users; restrict its permissions", "path", path)
+		}
+		if cfg.Versions.Selected != "" {
+			log.Debug("Application version", "version", cfg.Versions.Selected, "dir", cfg.Versions.Dir)
+		}
+		if cfg.MainClass != "" {
+			log.Debug("Main class", "class", cfg.MainClass, "classpath", cfg.Classpath)
+		} else {
+			log.Debug("JAR file", "path", cfg.JarFileAbsolutePath)
+		}
+		if cfg.JVMArgs != "" {
+			log.Debug("JVM arguments", "args", cfg.JVMArgs)
+		}
 	}
 
-	logf(logFile, "Starting Launcher on Version: %s", version)
-	cfg, confPath, err := config.Load()
+	if p.LogFile != "" {
+		f, err := logfile.Open(p.LogFile, 0, 0)
+		if err != nil {
+			log.Error("Failed to open log_file", "path", p.LogFile, "error", err)
+			return 1
+		}
+		defer f.Close()
+		outputs = append(outputs, f)
+	}
+	// Rebuild the logger with the configured outputs and redact patterns
+	if log, err = newLogger(flags, outputs, redactor); err != nil {
+		fmt.Fprintf(os.Stderr, "[GJG] %v\n", err)
+		return 1
+	}
+
+	logPlan(log, p)
+
+	if flags.DryRun {
+		return dryRun(log, flags.DryRunFormat, p, redactor)
+	}
+
+	// Handle Ctrl+C: kill the child and stop supervising
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	runOpts := base
+	runOpts.Logger, runOpts.Version = log, version
+	code, err := launcher.Run(ctx, p, runOpts)
 	if err != nil {
-		logf(logFile, "Error loading config: %s", err)
-		os.Exit(1)
+		log.Error("Execution failed", "error", err)
+		return code
+	}
+	if code != 0 {
+		log.Debug("Process exited", "exitCode", code)
 	}
+	return code
+}
 
-	jvmTokens := args.Tokenize(cfg.JVMArgs)
-	appTokens := args.Tokenize(cfg.AppArgs)
+// logPlan writes the plan details at debug level.
+func logPlan(log *slog.Logger, p *launcher.LaunchPlan) {
+	log.Debug("Java executable", "path", p.Executable)
+	log.Debug("Working directory", "path", p.WorkDir)
 
-	argv := make([]string, 0, 4+len(jvmTokens)+len(appTokens)+len(forwardArgs))
-	argv = append(argv, cfg.JavaExecutableAbsolutePath)
-	argv = append(argv, jvmTokens...)
-	argv = append(argv, "-jar", cfg.JarFileAbsolutePath)
-	argv = append(argv, appTokens...)
-	argv = append(argv, forwardArgs...)
+	if len(p.ForwardArgs) > 0 {
+		log.Debug("Forward arguments", "args", p.ForwardArgs)
+	}
 
-	if debug {
-		logf(logFile, "Configuration loaded from: %s", confPath)
-		logf(logFile, "Java executable: %s", cfg.JavaExecutableAbsolutePath)
-		logf(logFile, "JAR file: %s", cfg.JarFileAbsolutePath)
-		logf(logFile, "Working directory: %s", filepath.Dir(confPath))
+	for _, h := range p.Hooks.PreLaunch {
+		log.Debug("Pre-launch hook", "command", h)
+	}
+	for _, h := range p.Hooks.PostExit {
+		log.Debug("Post-exit hook", "command", h)
+	}
 
-		if cfg.JVMArgs != "" {
-			logf(logFile, "JVM arguments: %s", cfg.JVMArgs)
-		}
+	if len(p.HeapFallback) > 0 {
+		log.Debug("Heap fallback", "sizes", p.HeapFallback)
+	}
 
-		if len(forwardArgs) > 0 {
-			logf(logFile, "Forward arguments: %v", forwardArgs)
+	policy := p.RestartPolicy()
+	if policy.Mode != runner.RestartNever || len(policy.RestartExitCodes) > 0 {
+		log.Debug("Restart policy", "mode", policy.Mode, "restartExitCodes", policy.RestartExitCodes, "maxRestarts", policy.MaxRestarts, "window", policy.Window)
+	}
+
+	if p.Console.StdoutLog != "" {
+		log.Debug("Capturing stdout", "path", p.Console.StdoutLog)
+	}
+	if p.Console.StderrLog != "" {
+		log.Debug("Capturing stderr", "path", p.Console.StderrLog)
+	}
+
+	log.Debug("Executing", "argv", p.Argv)
+}
+
+// dryRun reports the plan without executing it: as JSON on stdout, or as a
+// log line. Secrets are masked unless the unmasked JSON is asked for, which
+// --gjg-run-plan needs.
+func dryRun(log *slog.Logger, format string, p *launcher.LaunchPlan, redactor *redact.Redactor) int {
+	switch format {
+	case "text":
+		log.Info("Dry-run mode - not executing")
+		return 0
+	case "json", "json-unmasked":
+		if format == "json" {
+			p = p.Masked(redactor)
+		}
+		if err := p.Write(os.Stdout); err != nil {
+			log.Error("Failed to write plan", "error", err)
+			return 1
 		}
+		return 0
+	}
+	log.Error("Invalid --gjg-dry-run format (expected text, json or json-unmasked)", "format", format)
+	return 1
+}
 
-		logf(logFile, "Executing: %v", argv)
+// printHistory prints a summary of the launch history to stdout.
+func printHistory(log *slog.Logger) int {
+	cacheDir, err := paths.AppCacheDir()
+	if err != nil {
+		log.Error("Cannot determine cache directory", "error", err)
+		return 1
 	}
+	entries, err := history.File{Path: filepath.Join(cacheDir, history.FileName)}.Entries()
+	if err != nil {
+		log.Error("Failed to read launch history", "error", err)
+		return 1
+	}
+	if err := history.Summarize(entries, 5).WriteText(os.Stdout); err != nil {
+		log.Error("Failed to print launch history", "error", err)
+		return 1
+	}
+	return 0
+}
 
-	if dryRun {
-		logf(logFile, "Dry-run mode - not executing")
-		os.Exit(0)
+// prepare resolves cfg so that it can be planned, downloading the Java
+// runtime, JNLP jars and dependencies it still needs. A launch also installs
+// a downloaded update and prunes old versions first; a dry run leaves the
+// installation alone. Ctrl+C cancels.
+func prepare(cfg *launcher.Config, confPath string, opts launcher.Options, launch bool) (*launcher.Config, string, error) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	if launch {
+		return launcher.Prepare(ctx, cfg, confPath, opts)
 	}
+	return launcher.Resolve(ctx, cfg, confPath, opts)
+}
 
-	workDir := filepath.Dir(confPath)
-	code, err := runner.Run(argv, cfg.Env, workDir)
+// jnlpSource returns the --gjg-jnlp URL, or the file made absolute.
+func jnlpSource(src string) string {
+	if src == "" || strings.HasPrefix(src, "http://") || strings.HasPrefix(src, "https://") {
+		return src
+	}
+	if abs, err := filepath.Abs(src); err == nil {
+		return abs
+	}
+	return src
+}
+
+// rollbackVersion switches to the previous version for --gjg-rollback and
+// reloads the configuration for it.
+func rollbackVersion(log *slog.Logger, cfg *launcher.Config, opts launcher.Options) (*launcher.Config, string, error) {
+	version, err := launcher.RollbackVersion(cfg)
+	if err != nil {
+		return nil, "", fmt.Errorf("rollback failed: %w", err)
+	}
+	log.Info("Rolled back to the previous version", "version", version)
+	return launcher.Load(opts)
+}
+
+// printConfig writes the effective configuration to stdout in the given format.
+func printConfig(log *slog.Logger, format string, e effective.Config) int {
+	var err error
+	switch format {
+	case "text":
+		err = e.WriteText(os.Stdout)
+	case "json":
+		err = e.WriteJSON(os.Stdout)
+	default:
+		err = fmt.Errorf("invalid --gjg-print-config format %q (expected text or json)", format)
+	}
 	if err != nil {
-		logf(logFile, "ERROR: Execution failed: %v", err)
-		if code == 0 {
-			os.Exit(1)
+		log.Error("Failed to print configuration", "error", err)
+		return 1
+	}
+	return 0
+}
+
+// runDiagnose writes the support bundle and prints its path. It works with
+// whatever part of the configuration could be loaded.
+func runDiagnose(log *slog.Logger, redactor *redact.Redactor, base launcher.Options, cfg *launcher.Config, confPath string, confErr error, forwardArgs []string) int {
+	in := diagnose.Input{
+		LauncherVersion: version,
+		ConfigPath:      confPath,
+		ConfigErr:       confErr,
+		InheritedEnv:    os.Environ(),
+		Redactor:        redactor,
+	}
+	in.SearchPaths, _ = launcher.SearchPaths(base)
+	if confPath != "" {
+		in.WorkDir = filepath.Dir(confPath)
+	}
+
+	outDir := os.TempDir()
+	cacheDir, err := paths.AppCacheDir()
+	if err == nil {
+		outDir = cacheDir
+		logs := debugLogHistory(cacheDir).Files()
+		if len(logs) > 5 {
+			logs = logs[:5]
 		}
-		os.Exit(code)
+		in.LauncherLogs = append(logs, filepath.Join(cacheDir, launcher.FailureReportName), filepath.Join(cacheDir, history.FileName))
 	}
 
-	if debug && code != 0 {
-		logf(logFile, "Process exited with code: %d", code)
+	if cfg != nil {
+		in.JavaPath = cfg.JavaExecutableAbsolutePath
+		in.Argv = plan.Argv(cfg, forwardArgs)
+		in.Env = cfg.Env
+		if cfg.LogFile != "" {
+			in.LauncherLogs = append(in.LauncherLogs, cfg.LogFile)
+		}
+		for _, p := range []string{cfg.Console.StdoutLog, cfg.Console.StderrLog} {
+			if p != "" && !slices.Contains(in.ConsoleLogs, p) {
+				in.ConsoleLogs = append(in.ConsoleLogs, p, p+".1")
+			}
+		}
 	}
 
-	os.Exit(code)
+	zipPath := filepath.Join(outDir, "gjg-diagnostics-"+time.Now().Format("20060102-150405")+".zip")
+	if err := diagnose.Write(zipPath, in); err != nil {
+		log.Error("Failed to write diagnostics bundle", "error", err)
+		return 1
+	}
+	fmt.Println(zipPath)
+	return 0
 }
 
-func logf(logFile *os.File, format string, args ...interface{}) {
-	timestamp := time.Now().Format("2006-01-02 15:04:05")
-	msg := fmt.Sprintf("[%s] [GJG] "+format, append([]interface{}{timestamp}, args...)...)
-	if logFile != nil {
-		_, _ = logFile.WriteString(msg + "\n")
+// newLogger builds the launcher logger from the --gjg-log-* flags. Debug mode
+// lowers the default level to debug.
+func newLogger(flags args.Flags, outputs []io.Writer, redactor *redact.Redactor) (*slog.Logger, error) {
+	level := flags.LogLevel
+	if level == "" && flags.Debug {
+		level = "debug"
 	}
-	fmt.Println(msg)
+	return logging.New(logging.Options{Level: level, Format: flags.LogFormat, Outputs: outputs, Redactor: redactor})
 }
 
-func getExeName() string {
-	exePath, err := os.Executable()
+// openDebugLog starts a new per-launch debug log in the per-app cache directory.
+func openDebugLog() *os.File {
+	cacheDir, err := paths.AppCacheDir()
 	if err != nil {
-		return "gjg"
+		return nil
 	}
-	exeName := filepath.Base(exePath)
-	exeNameNoExt := strings.TrimSuffix(exeName, filepath.Ext(exeName))
+	f, _ := debugLogHistory(cacheDir).Create()
+	return f
+}
 
-	return exeNameNoExt
+// debugLogHistory keeps the last 20 debug logs, up to two weeks old.
+func debugLogHistory(cacheDir string) logfile.History {
+	return logfile.History{Dir: cacheDir, Prefix: "gjg-debug", Keep: 20, MaxAge: 14 * 24 * time.Hour}
 }
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"gjg/launcher"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func writeFile(t *testing.T, path, content string, mode os.FileMode) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), mode); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRunRedactsConfiguredPatterns(t *testing.T) {
+	root := t.TempDir()
+	javaName := "java"
+	if runtime.GOOS == "windows" {
+		javaName = "javaw.exe"
+	}
+	binDir := filepath.Join(root, "jdk", "bin")
+	writeFile(t, filepath.Join(binDir, javaName), "", 0755)
+	writeFile(t, filepath.Join(root, "app", "myapp.jar"), "", 0644)
+	writeFile(t, filepath.Join(root, "app", "myapp.gjg.conf"), "redact=dbpass\njvm_args=-Ddbpass=hunter2 -Xmx64m\n", 0644)
+
+	// Keep the per-launch debug log out of the user's folders
+	t.Setenv("HOME", root)
+	t.Setenv("XDG_CACHE_HOME", filepath.Join(root, "cache"))
+	t.Setenv("XDG_STATE_HOME", filepath.Join(root, "state"))
+	t.Setenv("LOCALAPPDATA", filepath.Join(root, "cache"))
+	stderr, err := os.Create(filepath.Join(root, "stderr.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stderr.Close()
+	saved := os.Stderr
+	os.Stderr = stderr
+	defer func() { os.Stderr = saved }()
+
+	code := run([]string{"--gjg-debug", "--gjg-dry-run"}, launcher.Options{
+		Executable: filepath.Join(root, "app", "myapp.exe"),
+		Root:       filepath.Join(root, "app"),
+		Environ:    []string{"PATH=" + binDir},
+		CacheDir:   filepath.Join(root, "app-cache"),
+	})
+	os.Stderr = saved
+	out, err := os.ReadFile(stderr.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code != 0 {
+		t.Fatalf("run() = %d, want 0:\n%s", code, out)
+	}
+	if strings.Contains(string(out), "hunter2") {
+		t.Errorf("debug output leaks a configured secret:\n%s", out)
+	}
+	if !strings.Contains(string(out), "-Ddbpass=***") {
+		t.Errorf("debug output does not show the masked argument:\n%s", out)
+	}
+}
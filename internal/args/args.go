@@ -2,17 +2,76 @@ package args
 
 import "strings"
 
-// ExtractSpecial parses special flags and returns debug, dryRun, and remaining args.
-func ExtractSpecial(in []string) (debug bool, dryRun bool, rest []string) {
+// Flags are the launcher's own --gjg-* flags.
+type Flags struct {
+	Debug     bool
+	DryRun    bool
+	Diagnose  bool
+	History   bool
+	LogLevel  string
+	LogFormat string
+	// DryRunFormat is "text", "json" or "json-unmasked"; json prints the
+	// launch plan with secrets masked instead of logging it.
+	DryRunFormat string
+	// RunPlan is a launch plan file to execute instead of the configuration.
+	RunPlan string
+	// PrintConfig is "text" or "json" when --gjg-print-config was given.
+	PrintConfig string
+	// UseVersion runs this version of a versioned layout instead of the current one.
+	UseVersion string
+	// Rollback switches a versioned layout back to the previous version.
+	Rollback bool
+	// JNLP is a .jnlp file or URL to launch instead of the configured one.
+	JNLP string
+}
+
+// Parse extracts the launcher flags and returns them with the remaining args.
+func Parse(in []string) (flags Flags, rest []string) {
 	rest = make([]string, 0, len(in))
 	for _, a := range in {
-		switch a {
-		case "--gjg-debug":
-			debug = true
+		switch {
+		case a == "--gjg-debug":
+			flags.Debug = true
+			continue
+		case a == "--gjg-dry-run":
+			flags.DryRun = true
+			flags.DryRunFormat = "text"
+			flags.Debug = true
+			continue
+		case strings.HasPrefix(a, "--gjg-dry-run="):
+			flags.DryRun = true
+			flags.DryRunFormat = strings.TrimPrefix(a, "--gjg-dry-run=")
+			flags.Debug = flags.Debug || flags.DryRunFormat == "text"
+			continue
+		case strings.HasPrefix(a, "--gjg-run-plan="):
+			flags.RunPlan = strings.TrimPrefix(a, "--gjg-run-plan=")
+			continue
+		case a == "--gjg-diagnose":
+			flags.Diagnose = true
+			continue
+		case a == "--gjg-history":
+			flags.History = true
+			continue
+		case a == "--gjg-print-config":
+			flags.PrintConfig = "text"
+			continue
+		case strings.HasPrefix(a, "--gjg-print-config="):
+			flags.PrintConfig = strings.TrimPrefix(a, "--gjg-print-config=")
+			continue
+		case strings.HasPrefix(a, "--gjg-use-version="):
+			flags.UseVersion = strings.TrimPrefix(a, "--gjg-use-version=")
+			continue
+		case a == "--gjg-rollback":
+			flags.Rollback = true
+			continue
+		case strings.HasPrefix(a, "--gjg-jnlp="):
+			flags.JNLP = strings.TrimPrefix(a, "--gjg-jnlp=")
+			continue
+		case strings.HasPrefix(a, "--gjg-log-level="):
+			flags.LogLevel = strings.TrimPrefix(a, "--gjg-log-level=")
 			continue
-		case "--gjg-dry-run":
-			dryRun = true
-			debug = true
+		case strings.HasPrefix(a, "--gjg-log-format="):
+			flags.LogFormat = strings.TrimPrefix(a, "--gjg-log-format=")
 			continue
 		}
 		rest = append(rest, a)
@@ -5,7 +5,7 @@ import (
 	"testing"
 )
 
-func TestExtractSpecial(t *testing.T) {
+func TestParseSpecial(t *testing.T) {
 	tests := []struct {
 		name        string
 		input       []string
@@ -66,18 +66,18 @@ func TestExtractSpecial(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			gotDebug, gotDryRun, gotForward := ExtractSpecial(tt.input)
+			flags, gotForward := Parse(tt.input)
 
-			if gotDebug != tt.wantDebug {
-				t.Errorf("ExtractSpecial() debug = %v, want %v", gotDebug, tt.wantDebug)
+			if flags.Debug != tt.wantDebug {
+				t.Errorf("Parse() debug = %v, want %v", flags.Debug, tt.wantDebug)
 			}
 
-			if gotDryRun != tt.wantDryRun {
-				t.Errorf("ExtractSpecial() dryRun = %v, want %v", gotDryRun, tt.wantDryRun)
+			if flags.DryRun != tt.wantDryRun {
+				t.Errorf("Parse() dryRun = %v, want %v", flags.DryRun, tt.wantDryRun)
 			}
 
 			if !reflect.DeepEqual(gotForward, tt.wantForward) {
-				t.Errorf("ExtractSpecial() forward = %v, want %v", gotForward, tt.wantForward)
+				t.Errorf("Parse() forward = %v, want %v", gotForward, tt.wantForward)
 			}
 		})
 	}
@@ -215,3 +215,68 @@ func TestTokenizeEdgeCases(t *testing.T) {
 		})
 	}
 }
+
+func TestParse(t *testing.T) {
+	flags, rest := Parse([]string{"--gjg-log-level=debug", "arg1", "--gjg-log-format=json", "--gjg-dry-run", "--gjg-diagnose", "--log-level=x"})
+
+	want := Flags{Debug: true, DryRun: true, Diagnose: true, LogLevel: "debug", LogFormat: "json", DryRunFormat: "text"}
+	if flags != want {
+		t.Errorf("Parse() flags = %+v, want %+v", flags, want)
+	}
+	if wantRest := []string{"arg1", "--log-level=x"}; !reflect.DeepEqual(rest, wantRest) {
+		t.Errorf("Parse() rest = %v, want %v", rest, wantRest)
+	}
+}
+
+func TestParseVersionFlags(t *testing.T) {
+	flags, rest := Parse([]string{"--gjg-use-version=1.4.2", "x", "--gjg-rollback", "--gjg-jnlp=https://example.com/app.jnlp"})
+	if flags.UseVersion != "1.4.2" || !flags.Rollback || flags.JNLP != "https://example.com/app.jnlp" {
+		t.Errorf("Parse() = %+v, want UseVersion 1.4.2, Rollback and JNLP", flags)
+	}
+	if !reflect.DeepEqual(rest, []string{"x"}) {
+		t.Errorf("Parse() rest = %v, want [x]", rest)
+	}
+}
+
+func TestParsePrintConfig(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"--gjg-print-config", "text"},
+		{"--gjg-print-config=json", "json"},
+		{"--gjg-print-config=text", "text"},
+	}
+	for _, tt := range tests {
+		flags, rest := Parse([]string{tt.in, "x"})
+		if flags.PrintConfig != tt.want {
+			t.Errorf("Parse(%q) PrintConfig = %q, want %q", tt.in, flags.PrintConfig, tt.want)
+		}
+		if len(rest) != 1 {
+			t.Errorf("Parse(%q) rest = %v", tt.in, rest)
+		}
+	}
+}
+
+func TestParseDryRunAndPlan(t *testing.T) {
+	tests := []struct {
+		in   []string
+		want Flags
+	}{
+		{[]string{"--gjg-dry-run=json"}, Flags{DryRun: true, DryRunFormat: "json"}},
+		{[]string{"--gjg-dry-run=json-unmasked"}, Flags{DryRun: true, DryRunFormat: "json-unmasked"}},
+		{[]string{"--gjg-dry-run=text"}, Flags{Debug: true, DryRun: true, DryRunFormat: "text"}},
+		{[]string{"--gjg-debug", "--gjg-dry-run=json"}, Flags{Debug: true, DryRun: true, DryRunFormat: "json"}},
+		{[]string{"--gjg-run-plan=plan.json"}, Flags{RunPlan: "plan.json"}},
+		{[]string{"--gjg-history"}, Flags{History: true}},
+	}
+	for _, tt := range tests {
+		flags, rest := Parse(tt.in)
+		if flags != tt.want {
+			t.Errorf("Parse(%q) = %+v, want %+v", tt.in, flags, tt.want)
+		}
+		if len(rest) != 0 {
+			t.Errorf("Parse(%q) rest = %v, want none", tt.in, rest)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package config
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"gjg/internal/signature"
+	"gjg/internal/winres"
+	"io"
+	"os"
+	"path"
+	"strings"
+)
+
+// BakedConfig is a base configuration compiled into the launcher, base64
+// encoded. App-specific builds set it with
+// -ldflags "-X gjg/internal/config.BakedConfig=<base64>".
+var BakedConfig string
+
+// bakedConfig returns the base configuration: Options.Baked, else the one
+// written into the executable by gjg stamp -config, else BakedConfig.
+// A stamped configuration must carry a valid signature when a public key is
+// set; one compiled in is part of the binary and trusted as such.
+func (o Options) bakedConfig() ([]byte, error) {
+	if o.Baked != nil {
+		return o.Baked, nil
+	}
+	data, sig, err := stampedConfig(o.Executable)
+	if err != nil {
+		return nil, fmt.Errorf("baked configuration: %w", err)
+	}
+	if data != nil {
+		if o.PublicKey != nil {
+			if sig == nil {
+				return nil, fmt.Errorf("baked configuration signature check failed: %w", signature.ErrUnsigned)
+			}
+			if err := signature.Verify(o.PublicKey, data, string(sig)); err != nil {
+				return nil, fmt.Errorf("baked configuration signature check failed: %w", err)
+			}
+		}
+		return data, nil
+	}
+	if BakedConfig == "" {
+		return nil, nil
+	}
+	data, err = base64.StdEncoding.DecodeString(BakedConfig)
+	if err != nil {
+		return nil, fmt.Errorf("invalid baked configuration: %w", err)
+	}
+	return data, nil
+}
+
+// stampedConfig returns the GJG_CONFIG resource of a Windows executable and
+// its signature, if any. Other files have none.
+func stampedConfig(exe string) (data, sig []byte, err error) {
+	f, err := os.Open(exe)
+	if err != nil {
+		return nil, nil, nil
+	}
+	magic := make([]byte, 2)
+	_, err = io.ReadFull(f, magic)
+	f.Close()
+	if err != nil || string(magic) != "MZ" {
+		return nil, nil, nil
+	}
+
+	set, err := winres.ReadFile(exe)
+	if err != nil {
+		if errors.Is(err, winres.ErrNotPE) {
+			return nil, nil, nil
+		}
+		return nil, nil, err
+	}
+	rcdata := winres.IntID(winres.TypeRCData)
+	conf, ok := set.Find(rcdata, winres.StringID(winres.ConfigName))
+	if !ok {
+		return nil, nil, nil
+	}
+	if s, ok := set.Find(rcdata, winres.StringID(winres.ConfigSigName)); ok {
+		sig = s.Data
+	}
+	return conf.Data, sig, nil
+}
+
+// lock adds the comma-separated key patterns of a lock line. Patterns use
+// path.Match syntax, so env_* locks every environment variable.
+func (l *layers) lock(val string) error {
+	for _, p := range strings.Split(val, ",") {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+		if _, err := path.Match(p, ""); err != nil {
+			return fmt.Errorf("%q: %w", p, err)
+		}
+		l.locked = append(l.locked, p)
+	}
+	return nil
+}
+
+// isLocked reports whether the baked configuration forbids changing key.
+func (l *layers) isLocked(key string) bool {
+	for _, p := range l.locked {
+		if ok, _ := path.Match(p, key); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -2,35 +2,357 @@ package config
 
 import (
 	"bufio"
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"gjg/internal/logfile"
+	"gjg/internal/manifest"
+	"gjg/internal/maven"
+	"gjg/internal/paths"
+	"gjg/internal/runtimes"
+	"gjg/internal/signature"
+	"gjg/internal/versions"
+	"io/fs"
+	"net/url"
 	"os"
-	"os/exec"
 	"path/filepath"
+	"regexp"
 	"runtime"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
 )
 
 type Config struct {
 	JavaExecutableAbsolutePath string
+	JavaLookup                 string // how Java was found: "java_dir", "PATH" or "java_download"
+	JavaDownload               JavaDownloadConfig
 	JarFileAbsolutePath        string
 	JVMArgs                    string
 	AppArgs                    string
 	Env                        []string
+	Restart                    RestartConfig
+	Console                    ConsoleConfig
+	HeapFallback               []string
+	SingleInstance             SingleInstanceConfig
+	Hooks                      HooksConfig
+	Verify                     VerifyConfig
+	// MainClass, when set, launches with -cp Classpath MainClass instead of
+	// -jar JarFileAbsolutePath.
+	MainClass string
+	Classpath []string
+	JNLP      JNLPConfig
+	Maven     MavenConfig
+	// Exec is off or auto: whether Java may replace the launcher process.
+	Exec   string
+	Update UpdateConfig
+	// Versions is the versioned layout; an empty Dir means jar_file and
+	// java_dir are relative to the configuration file.
+	Versions VersionsConfig
+	// LogFile is an additional launcher log destination (absolute path).
+	LogFile string
+	// Redact holds extra secret name patterns (repeatable redact key).
+	Redact []string
+	// Sources maps each key set in the baked configuration or the config
+	// file (env_ keys included) to the line that set it last, and jnlp to
+	// the flag when --gjg-jnlp overrides it.
+	Sources map[string]Source
 }
 
-func Load() (*Config, string, error) {
-	exe, err := os.Executable()
+// Source kinds.
+const (
+	SourceFile        = "file"
+	SourceDefault     = "default"
+	SourceEnvironment = "environment"
+	SourceFlag        = "flag"
+	SourceBaked       = "baked"
+)
+
+// Source tells where an effective setting came from.
+type Source struct {
+	Kind string `json:"kind"`
+	File string `json:"file,omitempty"`
+	Line int    `json:"line,omitempty"`
+}
+
+func (s Source) String() string {
+	switch {
+	case s.Kind == SourceFile:
+		return fmt.Sprintf("%s:%d", s.File, s.Line)
+	case s.Kind == SourceBaked && s.Line > 0:
+		return fmt.Sprintf("baked:%d", s.Line)
+	}
+	return s.Kind
+}
+
+// SourceOf returns where key was set, or a default source when the file does not set it.
+func (c *Config) SourceOf(key string) Source {
+	if s, ok := c.Sources[key]; ok {
+		return s
+	}
+	return Source{Kind: SourceDefault}
+}
+
+// VerifyConfig controls the gjg.manifest integrity check.
+type VerifyConfig struct {
+	// Mode is strict, warn or off.
+	Mode string
+	// Full hashes every file on each launch instead of trusting the stamp of
+	// the last verification when sizes and modification times are unchanged.
+	Full bool
+	// Manifest is the absolute manifest path, next to the configuration file.
+	Manifest string
+}
+
+// UpdateConfig holds the update_* keys. An empty URL disables updates.
+type UpdateConfig struct {
+	URL      string
+	Interval time.Duration
+	Timeout  time.Duration
+}
+
+// JNLPConfig holds the jnlp key. Once the descriptor is resolved, its JVM
+// options and arguments go before jvm_args and app_args.
+type JNLPConfig struct {
+	// Source is an http(s) URL or an absolute path; empty means no JNLP.
+	Source string
+	// CacheDir keeps the downloaded descriptor and jars.
+	CacheDir string
+	JVMArgs  []string
+	AppArgs  []string
+	// Resolved is set once the descriptor was read into MainClass,
+	// Classpath, JVMArgs and AppArgs.
+	Resolved bool
+}
+
+// MavenConfig holds the dependency and repository keys. The resolved jars
+// are added to Classpath at launch.
+type MavenConfig struct {
+	// Dependencies are group:artifact:version coordinates.
+	Dependencies []string
+	// Repositories are base URLs; empty means Maven Central.
+	Repositories []string
+	// Local is the shared local repository the jars are kept in.
+	Local string
+	// LockFile records the resolved versions and hashes, in the per-app
+	// cache directory where only the user can change it.
+	LockFile string
+	// Resolved is set once the jars were added to Classpath.
+	Resolved bool
+}
+
+// JavaDownloadConfig holds the java_download_* keys for this platform. An
+// empty URL disables runtime provisioning.
+type JavaDownloadConfig struct {
+	// URL is the runtime archive, with the template placeholders expanded.
+	URL     string
+	SHA256  string
+	Version string
+	// Dir is where the runtime is installed in the shared runtimes cache.
+	Dir string
+	// Pending is true when no suitable Java was found and the runtime is
+	// not installed yet; JavaExecutableAbsolutePath is then where it will be.
+	Pending bool
+}
+
+// VersionsConfig holds the versioned layout settings (versions_dir, keep_versions).
+type VersionsConfig struct {
+	// Dir is the absolute versions directory.
+	Dir string
+	// Keep is how many versions are kept installed; 0 keeps all.
+	Keep int
+	// Selected is the version that runs, in Dir.
+	Selected string
+	// Requested is true when Selected came from --gjg-use-version.
+	Requested bool
+}
+
+// HooksConfig holds the hook commands. pre_launch and post_exit may be repeated.
+type HooksConfig struct {
+	PreLaunch []string
+	PostExit  []string
+	OnFailure string
+	Timeout   time.Duration
+}
+
+// SingleInstanceConfig holds the single_instance* keys.
+type SingleInstanceConfig struct {
+	Scope  string
+	Policy string
+	// Inbox is the absolute path forwarded arguments are appended to.
+	Inbox string
+}
+
+var heapSizePattern = regexp.MustCompile(`^[0-9]+[kKmMgG]?$`)
+
+// ConsoleConfig holds the child output capture settings (*_log keys).
+// Paths are absolute; empty means the stream is not captured.
+type ConsoleConfig struct {
+	StdoutLog  string
+	StderrLog  string
+	MaxSize    int64
+	Keep       int
+	Timestamps bool
+}
+
+// RestartConfig holds the supervisor settings (restart* keys).
+type RestartConfig struct {
+	Mode      string
+	ExitCodes []int
+	Max       int
+	Window    time.Duration
+	Delay     time.Duration
+	MaxDelay  time.Duration
+}
+
+// Search policies say where the configuration file is looked for.
+const (
+	// SearchExe only accepts <exe>.gjg.conf next to the executable, or in the
+	// Resources folder of its macOS .app bundle.
+	SearchExe = "exe"
+	// SearchExeCwd also accepts <exe>.gjg.conf in the working directory.
+	SearchExeCwd = "exe+cwd"
+	// SearchDev also falls back to example.gjg.conf, for development.
+	SearchDev = "dev"
+)
+
+// SearchPolicy is the search policy of this build. Release builds bake it in
+// with -ldflags "-X gjg/internal/config.SearchPolicy=exe".
+var SearchPolicy = SearchDev
+
+// Options describes the launcher process a configuration is loaded for.
+// Zero fields use the current process.
+type Options struct {
+	// Executable is the launcher path; the config file name and the first
+	// search directory derive from it.
+	Executable string
+	// Root is the second search directory, normally the working directory.
+	Root string
+	// Environ is the inherited environment that env_ keys are merged into
+	// and whose PATH is searched for Java.
+	Environ []string
+	// CacheDir is where relative log and inbox paths are placed.
+	CacheDir string
+	// SearchPolicy overrides the search policy baked into the build.
+	SearchPolicy string
+	// PublicKey, when set, requires a valid detached signature next to the
+	// configuration file. Nil uses the key embedded at build time, if any.
+	PublicKey ed25519.PublicKey
+	// Baked is the base configuration the file is layered over. Nil uses the
+	// one built into the executable, if any; empty means none.
+	Baked []byte
+	// UseVersion runs this version of a versioned layout instead of the
+	// current one.
+	UseVersion string
+	// RuntimesDir is the shared cache of downloaded Java runtimes. Empty
+	// uses the per-user default.
+	RuntimesDir string
+	// JNLP overrides the jnlp key with a URL or absolute path. The
+	// configuration file is then optional, unless PublicKey is set.
+	JNLP string
+	// MavenDir is the shared local repository of dependency jars. Empty
+	// uses the per-user default.
+	MavenDir string
+}
+
+func (o Options) withDefaults() (Options, error) {
+	if o.Executable == "" {
+		exe, err := os.Executable()
+		if err != nil {
+			return o, fmt.Errorf("failed to get executable path: %w", err)
+		}
+		o.Executable = exe
+	}
+	if o.Root == "" {
+		o.Root = "."
+	}
+	if o.SearchPolicy == "" {
+		o.SearchPolicy = SearchPolicy
+	}
+	switch o.SearchPolicy {
+	case SearchExe, SearchExeCwd, SearchDev:
+	default:
+		return o, fmt.Errorf("invalid search policy %q (expected exe, exe+cwd or dev)", o.SearchPolicy)
+	}
+	if o.Environ == nil {
+		o.Environ = os.Environ()
+	}
+	if o.PublicKey == nil {
+		key, err := signature.EmbeddedKey()
+		if err != nil {
+			return o, err
+		}
+		o.PublicKey = key
+	}
+	return o, nil
+}
+
+// Load finds and parses the configuration. The file path is returned even
+// when parsing fails. With a baked configuration the file is optional; when
+// it is missing, the path is where it would be next to the executable.
+func (o Options) Load() (*Config, string, error) {
+	o, err := o.withDefaults()
+	if err != nil {
+		return nil, "", err
+	}
+	baked, err := o.bakedConfig()
 	if err != nil {
-		return nil, "", fmt.Errorf("failed to get executable path: %w", err)
+		return nil, "", err
+	}
+	confFilePath, err := o.Find()
+	if err != nil {
+		if baked == nil && o.JNLP == "" {
+			return nil, "", err
+		}
+		searchPaths, _ := o.SearchPaths()
+		if confFilePath, err = filepath.Abs(searchPaths[0]); err != nil {
+			return nil, "", err
+		}
 	}
 
-	exeBase := strings.TrimSuffix(filepath.Base(exe), filepath.Ext(exe))
-	exeDir := filepath.Dir(exe)
-	searchPaths := []string{
-		filepath.Join(exeDir, exeBase+".gjg.conf"),
-		filepath.Join(".", exeBase+".gjg.conf"),
-		filepath.Join(exeDir, "example.gjg.conf"),
-		filepath.Join(".", "example.gjg.conf"),
+	cfg, err := buildConfig(confFilePath, baked, o)
+	if err != nil {
+		return nil, confFilePath, err
+	}
+
+	return cfg, confFilePath, nil
+}
+
+// SearchPaths returns the candidate configuration files in lookup order,
+// as allowed by the search policy.
+func (o Options) SearchPaths() ([]string, error) {
+	o, err := o.withDefaults()
+	if err != nil {
+		return nil, err
+	}
+
+	exeBase := paths.BaseName(o.Executable)
+	exeDir := filepath.Dir(o.Executable)
+	searchPaths := []string{filepath.Join(exeDir, exeBase+".gjg.conf")}
+	if contents, ok := paths.BundleContents(o.Executable); ok {
+		searchPaths = append(searchPaths, filepath.Join(contents, "Resources", exeBase+".gjg.conf"))
+	}
+	if o.SearchPolicy == SearchExeCwd || o.SearchPolicy == SearchDev {
+		searchPaths = append(searchPaths, filepath.Join(o.Root, exeBase+".gjg.conf"))
+	}
+	if o.SearchPolicy == SearchDev {
+		searchPaths = append(searchPaths,
+			filepath.Join(exeDir, "example.gjg.conf"),
+			filepath.Join(o.Root, "example.gjg.conf"),
+		)
+	}
+	return searchPaths, nil
+}
+
+// Find returns the absolute path of the first existing configuration file.
+func (o Options) Find() (string, error) {
+	searchPaths, err := o.SearchPaths()
+	if err != nil {
+		return "", err
 	}
 
 	var confFilePath string
@@ -41,37 +363,192 @@ func Load() (*Config, string, error) {
 		}
 	}
 	if confFilePath == "" {
-		return nil, "", fmt.Errorf("configuration file not found. Searched for: %v", searchPaths)
+		return "", fmt.Errorf("configuration file not found. Searched for: %v", searchPaths)
 	}
 	confFilePath, err = filepath.Abs(confFilePath)
 	if err != nil {
-		return nil, "", fmt.Errorf("failed to get absolute path of configuration file: %w", err)
+		return "", fmt.Errorf("failed to get absolute path of configuration file: %w", err)
 	}
+	return confFilePath, nil
+}
 
-	cfg, err := buildConfig(confFilePath)
-	if err != nil {
-		return nil, "", err
+// buildConfig layers the configuration file over the baked configuration.
+// The file may be missing when there is a baked configuration.
+func buildConfig(configFilePath string, baked []byte, o Options) (*Config, error) {
+	data, err := os.ReadFile(configFilePath)
+	fileFound := err == nil
+	switch {
+	case fileFound:
+		if o.PublicKey != nil {
+			if err := signature.VerifyFile(o.PublicKey, configFilePath, data); err != nil {
+				return nil, fmt.Errorf("configuration signature check failed: %w", err)
+			}
+		}
+	case (baked == nil && o.JNLP == "") || !errors.Is(err, fs.ErrNotExist):
+		return nil, fmt.Errorf("configuration file error: %w", err)
 	}
 
-	return cfg, confFilePath, nil
-}
+	cfg := &Config{
+		Env:     slices.Clone(o.Environ),
+		Sources: make(map[string]Source),
+		Restart: RestartConfig{
+			Mode:     "never",
+			Max:      5,
+			Window:   time.Minute,
+			Delay:    time.Second,
+			MaxDelay: 30 * time.Second,
+		},
+		Console: ConsoleConfig{
+			MaxSize: 10 << 20,
+			Keep:    5,
+		},
+		SingleInstance: SingleInstanceConfig{
+			Scope:  "off",
+			Policy: "exit",
+			Inbox:  "forwarded-args.jsonl",
+		},
+		Hooks: HooksConfig{
+			OnFailure: "abort",
+			Timeout:   time.Minute,
+		},
+		Verify: VerifyConfig{
+			Mode:     "off",
+			Manifest: filepath.Join(filepath.Dir(configFilePath), manifest.FileName),
+		},
+		Exec: "off",
+		Update: UpdateConfig{
+			Interval: 24 * time.Hour,
+			Timeout:  10 * time.Second,
+		},
+		Versions: VersionsConfig{Keep: 3},
+	}
 
-func buildConfig(configFilePath string) (*Config, error) {
-	f, err := os.Open(configFilePath)
+	l := &layers{cfg: cfg, envOverrides: make(map[string]string)}
+	if baked != nil {
+		if err := l.parse(baked, Source{Kind: SourceBaked}); err != nil {
+			return nil, fmt.Errorf("baked configuration: %w", err)
+		}
+	}
+	if fileFound {
+		if err := l.parse(data, Source{Kind: SourceFile, File: configFilePath}); err != nil {
+			return nil, err
+		}
+	}
+
+	if o.JNLP != "" {
+		if o.PublicKey != nil && !fileFound {
+			// The descriptor picks the code to run; only a signed
+			// configuration may let the command line choose it
+			return nil, errors.New("--gjg-jnlp needs a signed configuration file when the launcher is built with a public key")
+		}
+		// It replaces the application a locked key names
+		for _, key := range []string{"jnlp", "jar_file", "main_class"} {
+			if l.isLocked(key) {
+				return nil, fmt.Errorf("--gjg-jnlp cannot be used: %s is locked by the launcher build", key)
+			}
+		}
+		l.jnlp = o.JNLP
+		cfg.Sources["jnlp"] = Source{Kind: SourceFlag}
+	}
+	if o.UseVersion != "" && l.isLocked("versions_dir") {
+		return nil, errors.New("--gjg-use-version cannot be used: versions_dir is locked by the launcher build")
+	}
+	if o.PublicKey != nil {
+		// A signed build checks its files too: the signed manifest covers
+		// the jar and runtime the signed configuration points at
+		cfg.Verify.Mode = "strict"
+		cfg.Sources["verify"] = Source{Kind: SourceBaked}
+	}
+	if strings.HasPrefix(cfg.Update.URL, "http:") && o.PublicKey == nil {
+		return nil, errors.New("update_url must use https unless the launcher is built with a public key to verify update manifests")
+	}
+	jarFile := l.jarFile
+	if jarFile == "" {
+		exeBase := strings.TrimSuffix(filepath.Base(configFilePath), ".gjg.conf")
+		jarFile = exeBase + ".jar"
+	}
+
+	configDir := filepath.Dir(configFilePath)
+	baseDir, err := selectVersion(cfg, l.versionsDir, configDir, o.UseVersion)
 	if err != nil {
-		return nil, fmt.Errorf("configuration file error: %w", err)
+		return nil, err
+	}
+	javaPath, err := resolveJava(l.javaDir, baseDir, o.Environ)
+	cfg.JavaLookup = "java_dir"
+	if strings.TrimSpace(l.javaDir) == "" {
+		cfg.JavaLookup = "PATH"
+	}
+	if l.downloadURL != "" && (err != nil || !runtimes.Suitable(javaPath, l.downloadVersion)) {
+		javaPath, err = l.downloadedJava(o)
+		cfg.JavaLookup = "java_download"
+	}
+	if err != nil {
+		return nil, fmt.Errorf("java resolution failed: %w", err)
 	}
-	defer f.Close()
+	cfg.JavaExecutableAbsolutePath = javaPath
 
-	cfg := &Config{
-		Env: os.Environ(),
+	switch {
+	case l.jnlp != "" && (len(cfg.Maven.Dependencies) > 0 || l.mainClass != ""):
+		return nil, errors.New("jnlp cannot be combined with dependency or main_class")
+	case l.jnlp != "":
+		if err := l.setJNLP(baseDir, o); err != nil {
+			return nil, err
+		}
+	case len(cfg.Maven.Dependencies) > 0:
+		if err := l.setMaven(jarFile, baseDir, configFilePath, o); err != nil {
+			return nil, err
+		}
+	default:
+		jarPath, err := resolveJar(jarFile, baseDir)
+		if err != nil {
+			return nil, fmt.Errorf("jar resolution failed: %w", err)
+		}
+		cfg.JarFileAbsolutePath = jarPath
+		if l.mainClass != "" {
+			cfg.MainClass = l.mainClass
+			cfg.Classpath = []string{jarPath}
+		}
+	}
+	cfg.Env = mergeEnv(cfg.Env, l.envOverrides)
+
+	if cfg.Console.StdoutLog == "" {
+		cfg.Console.StdoutLog = l.consoleLog
+	}
+	if cfg.Console.StderrLog == "" {
+		cfg.Console.StderrLog = l.consoleLog
+	}
+	for _, p := range []*string{&cfg.Console.StdoutLog, &cfg.Console.StderrLog, &cfg.SingleInstance.Inbox, &cfg.LogFile} {
+		if *p, err = resolveCachePath(*p, o); err != nil {
+			return nil, fmt.Errorf("path resolution failed: %w", err)
+		}
 	}
 
-	var javaDir string
-	var jarFile string
-	envOverrides := make(map[string]string)
+	return cfg, nil
+}
+
+// layers accumulates the settings of the baked configuration and then the
+// configuration file.
+type layers struct {
+	cfg         *Config
+	javaDir     string
+	jarFile     string
+	consoleLog  string
+	versionsDir string
+	jnlp        string
+	mainClass   string
+	// java_download_* settings; downloadSHA256 is the one for this platform
+	downloadURL     string
+	downloadVersion string
+	downloadSHA256  string
+	platformSHA256  bool
+	envOverrides    map[string]string
+	// locked holds the key patterns of the baked lock key.
+	locked []string
+}
 
-	scanner := bufio.NewScanner(f)
+// parse applies one layer; src is recorded as the source of its keys.
+func (l *layers) parse(data []byte, src Source) error {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
 	lineNo := 0
 	for scanner.Scan() {
 		lineNo++
@@ -83,55 +560,349 @@ func buildConfig(configFilePath string) (*Config, error) {
 
 		eq := strings.IndexRune(line, '=')
 		if eq <= 0 {
-			return nil, fmt.Errorf("invalid config line %d: %q", lineNo, line)
+			return fmt.Errorf("invalid config line %d: %q", lineNo, line)
 		}
 		key := strings.TrimSpace(line[:eq])
 		val := strings.TrimSpace(line[eq+1:])
 
-		switch {
-		case strings.HasPrefix(key, "env_"):
-			envKey := strings.TrimPrefix(key, "env_")
-			if envKey == "" {
-				return nil, fmt.Errorf("invalid env_ key at line %d", lineNo)
+		if key == "lock" {
+			if src.Kind != SourceBaked {
+				return fmt.Errorf("lock at line %d is only allowed in the baked configuration", lineNo)
 			}
-			envOverrides[envKey] = val
-		case key == "java_dir":
-			javaDir = val
-		case key == "jar_file":
-			jarFile = val
-		case key == "jvm_args":
-			cfg.JVMArgs = val
-		case key == "app_args":
-			cfg.AppArgs = val
-		default:
-			return nil, fmt.Errorf("unknown config key %q at line %d", key, lineNo)
+			if err := l.lock(val); err != nil {
+				return fmt.Errorf("invalid lock at line %d: %w", lineNo, err)
+			}
+			continue
 		}
+		if src.Kind != SourceBaked && l.isLocked(key) {
+			return fmt.Errorf("%s at line %d is locked by the launcher build and cannot be changed", key, lineNo)
+		}
+		if err := l.set(key, val, lineNo); err != nil {
+			return err
+		}
+		src.Line = lineNo
+		l.cfg.Sources[key] = src
 	}
 
 	if err := scanner.Err(); err != nil {
-		return nil, fmt.Errorf("error reading config: %w", err)
+		return fmt.Errorf("error reading config: %w", err)
 	}
+	return nil
+}
 
-	if jarFile == "" {
-		exeBase := strings.TrimSuffix(filepath.Base(configFilePath), ".gjg.conf")
-		jarFile = exeBase + ".jar"
+// set applies one key.
+func (l *layers) set(key, val string, lineNo int) error {
+	switch {
+	case strings.HasPrefix(key, "env_"):
+		envKey := strings.TrimPrefix(key, "env_")
+		if envKey == "" {
+			return fmt.Errorf("invalid env_ key at line %d", lineNo)
+		}
+		l.envOverrides[envKey] = val
+	case key == "java_dir":
+		l.javaDir = val
+	case key == "jar_file":
+		l.jarFile = val
+	case key == "jvm_args":
+		l.cfg.JVMArgs = val
+	case key == "app_args":
+		l.cfg.AppArgs = val
+	case key == "restart":
+		l.cfg.Restart.Mode = val
+	case key == "restart_exit_codes":
+		codes, err := parseIntList(val)
+		if err != nil {
+			return fmt.Errorf("invalid %s at line %d: %w", key, lineNo, err)
+		}
+		l.cfg.Restart.ExitCodes = codes
+	case key == "restart_max":
+		n, err := strconv.Atoi(val)
+		if err != nil || n < 0 {
+			return fmt.Errorf("invalid %s at line %d: %q", key, lineNo, val)
+		}
+		l.cfg.Restart.Max = n
+	case key == "restart_window", key == "restart_delay", key == "restart_max_delay":
+		d, err := time.ParseDuration(val)
+		if err != nil || d < 0 {
+			return fmt.Errorf("invalid %s at line %d: %q", key, lineNo, val)
+		}
+		switch key {
+		case "restart_window":
+			l.cfg.Restart.Window = d
+		case "restart_delay":
+			l.cfg.Restart.Delay = d
+		default:
+			l.cfg.Restart.MaxDelay = d
+		}
+	case key == "heap_fallback":
+		l.cfg.HeapFallback = nil
+		for _, size := range strings.Split(val, ",") {
+			size = strings.TrimSpace(size)
+			if size == "" {
+				continue
+			}
+			if !heapSizePattern.MatchString(size) {
+				return fmt.Errorf("invalid heap size %q in %s at line %d", size, key, lineNo)
+			}
+			l.cfg.HeapFallback = append(l.cfg.HeapFallback, size)
+		}
+	case key == "single_instance":
+		l.cfg.SingleInstance.Scope = val
+	case key == "single_instance_policy":
+		l.cfg.SingleInstance.Policy = val
+	case key == "single_instance_inbox":
+		l.cfg.SingleInstance.Inbox = val
+	case key == "pre_launch":
+		l.cfg.Hooks.PreLaunch = append(l.cfg.Hooks.PreLaunch, val)
+	case key == "post_exit":
+		l.cfg.Hooks.PostExit = append(l.cfg.Hooks.PostExit, val)
+	case key == "on_failure":
+		l.cfg.Hooks.OnFailure = val
+	case key == "verify":
+		l.cfg.Verify.Mode = val
+	case key == "verify_mode":
+		switch val {
+		case "fast":
+			l.cfg.Verify.Full = false
+		case "full":
+			l.cfg.Verify.Full = true
+		default:
+			return fmt.Errorf("invalid %s at line %d: %q (expected fast or full)", key, lineNo, val)
+		}
+	case key == "exec":
+		l.cfg.Exec = val
+	case key == "update_url":
+		u, err := url.Parse(val)
+		if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			return fmt.Errorf("invalid %s at line %d: %q (expected an http or https URL)", key, lineNo, val)
+		}
+		l.cfg.Update.URL = val
+	case key == "update_interval", key == "update_timeout":
+		d, err := time.ParseDuration(val)
+		if err != nil || d < 0 {
+			return fmt.Errorf("invalid %s at line %d: %q", key, lineNo, val)
+		}
+		if key == "update_interval" {
+			l.cfg.Update.Interval = d
+		} else {
+			l.cfg.Update.Timeout = d
+		}
+	case key == "jnlp":
+		l.jnlp = val
+	case key == "main_class":
+		l.mainClass = val
+	case key == "dependency":
+		c, err := maven.ParseCoord(val)
+		if err != nil {
+			return fmt.Errorf("invalid %s at line %d: %w", key, lineNo, err)
+		}
+		l.cfg.Maven.Dependencies = append(l.cfg.Maven.Dependencies, c.String())
+	case key == "repository":
+		u, err := url.Parse(val)
+		if err != nil || (u.Scheme != "https" && u.Scheme != "http" && u.Scheme != "file") || (u.Host == "" && u.Scheme != "file") {
+			return fmt.Errorf("invalid %s at line %d: %q (expected an http, https or file URL)", key, lineNo, val)
+		}
+		l.cfg.Maven.Repositories = append(l.cfg.Maven.Repositories, val)
+	case key == "java_download_url":
+		u, err := url.Parse(val)
+		if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			return fmt.Errorf("invalid %s at line %d: %q (expected an http or https URL)", key, lineNo, val)
+		}
+		l.downloadURL = val
+	case key == "java_download_version":
+		l.downloadVersion = val
+	case key == "java_download_sha256", strings.HasPrefix(key, "java_download_sha256_"):
+		if b, err := hex.DecodeString(val); err != nil || len(b) != sha256.Size {
+			return fmt.Errorf("invalid %s at line %d: %q (expected a hex SHA-256)", key, lineNo, val)
+		}
+		// The platform key wins over the plain one, whatever their order
+		switch platform := strings.TrimPrefix(key, "java_download_sha256_"); {
+		case platform == runtime.GOOS+"_"+runtime.GOARCH:
+			l.downloadSHA256, l.platformSHA256 = val, true
+		case key == "java_download_sha256" && !l.platformSHA256:
+			l.downloadSHA256 = val
+		}
+	case key == "versions_dir":
+		l.versionsDir = val
+	case key == "keep_versions":
+		n, err := strconv.Atoi(val)
+		if err != nil || n < 0 {
+			return fmt.Errorf("invalid %s at line %d: %q", key, lineNo, val)
+		}
+		l.cfg.Versions.Keep = n
+	case key == "hook_timeout":
+		d, err := time.ParseDuration(val)
+		if err != nil || d < 0 {
+			return fmt.Errorf("invalid %s at line %d: %q", key, lineNo, val)
+		}
+		l.cfg.Hooks.Timeout = d
+	case key == "redact":
+		l.cfg.Redact = append(l.cfg.Redact, val)
+	case key == "log_file":
+		l.cfg.LogFile = val
+	case key == "console_log":
+		l.consoleLog = val
+	case key == "stdout_log":
+		l.cfg.Console.StdoutLog = val
+	case key == "stderr_log":
+		l.cfg.Console.StderrLog = val
+	case key == "console_log_max_size":
+		n, err := logfile.ParseSize(val)
+		if err != nil {
+			return fmt.Errorf("invalid %s at line %d: %w", key, lineNo, err)
+		}
+		l.cfg.Console.MaxSize = n
+	case key == "console_log_keep":
+		n, err := strconv.Atoi(val)
+		if err != nil || n < 0 {
+			return fmt.Errorf("invalid %s at line %d: %q", key, lineNo, val)
+		}
+		l.cfg.Console.Keep = n
+	case key == "console_log_timestamps":
+		b, err := strconv.ParseBool(val)
+		if err != nil {
+			return fmt.Errorf("invalid %s at line %d: %q", key, lineNo, val)
+		}
+		l.cfg.Console.Timestamps = b
+	default:
+		return fmt.Errorf("unknown config key %q at line %d", key, lineNo)
 	}
+	return nil
+}
 
-	configDir := filepath.Dir(configFilePath)
-	javaPath, err := resolveJava(javaDir, configDir)
+// setJNLP records the JNLP descriptor to launch: a URL, or a path relative
+// to dir. Its jars are cached in the per-app cache directory.
+func (l *layers) setJNLP(dir string, o Options) error {
+	src := l.jnlp
+	if u, err := url.Parse(src); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		if !filepath.IsAbs(src) {
+			src = filepath.Join(dir, src)
+		}
+	}
+	cacheDir, err := resolveCachePath("jnlp", o)
 	if err != nil {
-		return nil, fmt.Errorf("java resolution failed: %w", err)
+		return fmt.Errorf("path resolution failed: %w", err)
 	}
-	cfg.JavaExecutableAbsolutePath = javaPath
+	l.cfg.JNLP.Source = src
+	l.cfg.JNLP.CacheDir = cacheDir
+	return nil
+}
 
-	jarPath, err := resolveJar(jarFile, configDir)
+// setMaven sets up classpath mode for the dependency keys: main_class is
+// required, and jar_file is added first to the classpath when it exists or
+// was set explicitly. The dependencies are resolved at launch.
+func (l *layers) setMaven(jarFile, dir, configFilePath string, o Options) error {
+	if l.mainClass == "" {
+		return errors.New("dependency needs main_class")
+	}
+	l.cfg.MainClass = l.mainClass
+	jarPath, err := resolveJar(jarFile, dir)
+	switch {
+	case err == nil:
+		l.cfg.JarFileAbsolutePath = jarPath
+		l.cfg.Classpath = []string{jarPath}
+	case l.jarFile != "":
+		return fmt.Errorf("jar resolution failed: %w", err)
+	}
+	local := o.MavenDir
+	if local == "" {
+		if local, err = paths.MavenDir(); err != nil {
+			return err
+		}
+	}
+	l.cfg.Maven.Local = local
+	// Next to the configuration, anyone able to write the install folder
+	// could pin other jars without touching the signed configuration
+	lockFile := strings.TrimSuffix(filepath.Base(configFilePath), ".conf") + ".lock"
+	if l.cfg.Maven.LockFile, err = resolveCachePath(lockFile, o); err != nil {
+		return err
+	}
+	return nil
+}
+
+// downloadedJava returns the java of the runtime java_download provides,
+// recording it in cfg.JavaDownload. When the runtime is not in the cache
+// yet, it returns where its java will be and marks the download pending.
+func (l *layers) downloadedJava(o Options) (string, error) {
+	if l.downloadVersion == "" {
+		return "", errors.New("java_download_url needs java_download_version")
+	}
+	cache := o.RuntimesDir
+	if cache == "" {
+		var err error
+		if cache, err = paths.RuntimesDir(); err != nil {
+			return "", err
+		}
+	}
+	dl := &l.cfg.JavaDownload
+	dl.URL = runtimes.ExpandURL(l.downloadURL, l.downloadVersion)
+	dl.SHA256 = l.downloadSHA256
+	dl.Version = l.downloadVersion
+	dir, err := runtimes.Dir(cache, runtimes.Spec{URL: dl.URL, SHA256: dl.SHA256, Version: dl.Version})
 	if err != nil {
-		return nil, fmt.Errorf("jar resolution failed: %w", err)
+		return "", err
+	}
+	dl.Dir = dir
+	if runtimes.Installed(dl.Dir, dl.SHA256) {
+		return resolveJava(dl.Dir, "", nil)
 	}
-	cfg.JarFileAbsolutePath = jarPath
-	cfg.Env = mergeEnv(cfg.Env, envOverrides)
+	dl.Pending = true
+	return filepath.Join(dl.Dir, "bin", javaExeName()), nil
+}
 
-	return cfg, nil
+// selectVersion picks the version of a versioned layout and returns the
+// directory jar_file and java_dir are relative to: the version folder, or
+// configDir without versions_dir.
+func selectVersion(cfg *Config, versionsDir, configDir, use string) (string, error) {
+	if versionsDir == "" {
+		if use != "" {
+			return "", errors.New("--gjg-use-version needs versions_dir in the configuration")
+		}
+		return configDir, nil
+	}
+	dir := versionsDir
+	if !filepath.IsAbs(dir) {
+		dir = filepath.Join(configDir, dir)
+	}
+	v, err := versions.Dir(dir).Select(use)
+	if err != nil {
+		return "", fmt.Errorf("version selection failed: %w", err)
+	}
+	cfg.Versions.Dir = dir
+	cfg.Versions.Selected = v
+	cfg.Versions.Requested = use != ""
+	return versions.Dir(dir).Path(v), nil
+}
+
+// resolveCachePath places relative paths under the per-app cache directory.
+func resolveCachePath(p string, o Options) (string, error) {
+	if p == "" || filepath.IsAbs(p) {
+		return p, nil
+	}
+	cacheDir := o.CacheDir
+	if cacheDir == "" {
+		var err error
+		if cacheDir, err = paths.CacheDirFor(o.Executable); err != nil {
+			return "", err
+		}
+	}
+	return filepath.Join(cacheDir, p), nil
+}
+
+func parseIntList(s string) ([]int, error) {
+	var out []int
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, n)
+	}
+	return out, nil
 }
 
 func mergeEnv(base []string, overrides map[string]string) []string {
@@ -160,14 +931,20 @@ func mergeEnv(base []string, overrides map[string]string) []string {
 	return result
 }
 
-func resolveJava(javaDir, configDir string) (string, error) {
-	exeName := "javaw.exe"
-	if runtime.GOOS != "windows" {
-		exeName = "java"
+// javaExeName is the Java launcher run for the app: javaw.exe on Windows,
+// so that no console window opens.
+func javaExeName() string {
+	if runtime.GOOS == "windows" {
+		return "javaw.exe"
 	}
+	return "java"
+}
+
+func resolveJava(javaDir, configDir string, environ []string) (string, error) {
+	exeName := javaExeName()
 
 	if strings.TrimSpace(javaDir) == "" {
-		if p, err := exec.LookPath(exeName); err == nil {
+		if p := lookPath(exeName, environ); p != "" {
 			return filepath.Abs(p)
 		}
 		return "", fmt.Errorf("java executable not found in PATH and not set on conf file")
@@ -180,12 +957,43 @@ func resolveJava(javaDir, configDir string) (string, error) {
 
 	javaPath := filepath.Join(base, "bin", exeName)
 	if _, err := os.Stat(javaPath); err != nil {
-		return "", fmt.Errorf("java executable not found: %s", javaPath)
+		// macOS runtimes (Name.jdk, or a bundled runtime) keep their home
+		// under Contents/Home
+		macPath := filepath.Join(base, "Contents", "Home", "bin", exeName)
+		if _, macErr := os.Stat(macPath); macErr != nil {
+			return "", fmt.Errorf("java executable not found: %s", javaPath)
+		}
+		javaPath = macPath
 	}
 
 	return filepath.Abs(javaPath)
 }
 
+// lookPath searches the PATH of environ for an executable file named name.
+func lookPath(name string, environ []string) string {
+	var pathList string
+	for _, kv := range environ {
+		if k, v, ok := strings.Cut(kv, "="); ok && (k == "PATH" || runtime.GOOS == "windows" && strings.EqualFold(k, "PATH")) {
+			pathList = v
+		}
+	}
+	for _, dir := range filepath.SplitList(pathList) {
+		if dir == "" || !filepath.IsAbs(dir) {
+			continue
+		}
+		p := filepath.Join(dir, name)
+		info, err := os.Stat(p)
+		if err != nil || info.IsDir() {
+			continue
+		}
+		if runtime.GOOS != "windows" && info.Mode()&0111 == 0 {
+			continue
+		}
+		return p
+	}
+	return ""
+}
+
 func resolveJar(jar, configDir string) (string, error) {
 	p := jar
 	if !filepath.IsAbs(p) {
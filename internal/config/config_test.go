@@ -0,0 +1,161 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0755); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// testOptions lays out an app with a jar, two installed versions and a java
+// on PATH, and returns the options loading its configuration.
+func testOptions(t *testing.T, baked, file string) Options {
+	t.Helper()
+	root := t.TempDir()
+	binDir := filepath.Join(root, "jdk", "bin")
+	writeFile(t, filepath.Join(binDir, javaExeName()), "")
+	writeFile(t, filepath.Join(root, "app", "myapp.jar"), "")
+	for _, v := range []string{"1.0", "1.1"} {
+		writeFile(t, filepath.Join(root, "app", "versions", v, "myapp.jar"), "")
+	}
+	writeFile(t, filepath.Join(root, "app", "versions", "current"), "1.1\n")
+	if file != "" {
+		writeFile(t, filepath.Join(root, "app", "myapp.gjg.conf"), file)
+	}
+	exe := "myapp"
+	if runtime.GOOS == "windows" {
+		exe += ".exe"
+	}
+	return Options{
+		Executable:   filepath.Join(root, "app", exe),
+		Root:         filepath.Join(root, "app"),
+		Environ:      []string{"PATH=" + binDir},
+		CacheDir:     filepath.Join(root, "cache"),
+		SearchPolicy: SearchExe,
+		Baked:        []byte(baked),
+	}
+}
+
+func TestLoadLayers(t *testing.T) {
+	tests := []struct {
+		name       string
+		baked      string
+		file       string
+		jnlp       string
+		useVersion string
+		// key and the source expected for it
+		key     string
+		want    Source
+		wantErr string
+	}{
+		{
+			name:  "baked only",
+			baked: "restart=always\n",
+			key:   "restart",
+			want:  Source{Kind: SourceBaked, Line: 1},
+		},
+		{
+			name:  "file over baked",
+			baked: "restart=always\n",
+			file:  "# app settings\nrestart=on-failure\n",
+			key:   "restart",
+			want:  Source{Kind: SourceFile, Line: 2},
+		},
+		{
+			name: "default",
+			file: "restart=always\n",
+			key:  "exec",
+			want: Source{Kind: SourceDefault},
+		},
+		{
+			name:  "flag over file",
+			baked: "lock=update_url\n",
+			file:  "jnlp=app.jnlp\n",
+			jnlp:  "https://example.com/app.jnlp",
+			key:   "jnlp",
+			want:  Source{Kind: SourceFlag},
+		},
+		{
+			name:    "locked key in file",
+			baked:   "restart=always\nlock=restart\n",
+			file:    "restart=never\n",
+			wantErr: "restart at line 1 is locked",
+		},
+		{
+			name:    "locked pattern in file",
+			baked:   "lock=env_*\n",
+			file:    "env_PATH=/tmp\n",
+			wantErr: "env_PATH at line 1 is locked",
+		},
+		{
+			name:    "lock in file",
+			file:    "lock=jvm_args\n",
+			wantErr: "only allowed in the baked configuration",
+		},
+		{
+			name:    "jnlp flag with locked jar_file",
+			baked:   "jar_file=myapp.jar\nlock=jar_file\n",
+			jnlp:    "https://example.com/app.jnlp",
+			wantErr: "--gjg-jnlp cannot be used: jar_file is locked",
+		},
+		{
+			name:    "jnlp flag with locked jnlp",
+			baked:   "jnlp=https://example.com/app.jnlp\nlock=jnlp\n",
+			jnlp:    "https://example.com/other.jnlp",
+			wantErr: "--gjg-jnlp cannot be used: jnlp is locked",
+		},
+		{
+			name:       "version flag",
+			baked:      "versions_dir=versions\n",
+			useVersion: "1.0",
+			key:        "versions_dir",
+			want:       Source{Kind: SourceBaked, Line: 1},
+		},
+		{
+			name:       "version flag with locked versions_dir",
+			baked:      "versions_dir=versions\nlock=versions_dir\n",
+			useVersion: "1.0",
+			wantErr:    "--gjg-use-version cannot be used",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := testOptions(t, tt.baked, tt.file)
+			o.JNLP, o.UseVersion = tt.jnlp, tt.useVersion
+			cfg, confPath, err := o.Load()
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Load() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Load() error = %v", err)
+			}
+			want := tt.want
+			if want.Kind == SourceFile {
+				want.File = confPath
+			}
+			if got := cfg.SourceOf(tt.key); got != want {
+				t.Errorf("SourceOf(%q) = %+v, want %+v", tt.key, got, want)
+			}
+			if tt.jnlp != "" && cfg.JNLP.Source != tt.jnlp {
+				t.Errorf("jnlp = %q, want the flag's %q", cfg.JNLP.Source, tt.jnlp)
+			}
+			if tt.useVersion != "" && cfg.Versions.Selected != tt.useVersion {
+				t.Errorf("version = %q, want %q", cfg.Versions.Selected, tt.useVersion)
+			}
+		})
+	}
+}
@@ -0,0 +1,196 @@
+package crash
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxLineLen caps each line a Tail keeps; the rest of a longer line, such as
+// binary output without newlines, is dropped.
+const maxLineLen = 4 << 10
+
+// Tail keeps the last lines written to it, each cut to 4 KiB. It is safe for
+// concurrent use.
+type Tail struct {
+	mu    sync.Mutex
+	max   int
+	lines []string
+	part  strings.Builder
+}
+
+// NewTail returns a Tail that keeps at most max lines.
+func NewTail(max int) *Tail {
+	return &Tail{max: max}
+}
+
+func (t *Tail) Write(p []byte) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, c := range p {
+		if c == '\n' {
+			t.push(strings.TrimRight(t.part.String(), "\r"))
+			t.part.Reset()
+			continue
+		}
+		if t.part.Len() < maxLineLen {
+			t.part.WriteByte(c)
+		}
+	}
+	return len(p), nil
+}
+
+func (t *Tail) push(line string) {
+	t.lines = append(t.lines, line)
+	if len(t.lines) > t.max {
+		t.lines = t.lines[len(t.lines)-t.max:]
+	}
+}
+
+// Lines returns the buffered lines, including a trailing unterminated line.
+func (t *Tail) Lines() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	out := append([]string(nil), t.lines...)
+	if t.part.Len() > 0 {
+		out = append(out, t.part.String())
+	}
+	return out
+}
+
+// Reset discards all buffered lines.
+func (t *Tail) Reset() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.lines = nil
+	t.part.Reset()
+}
+
+// Signature is a known JVM failure message and its likely cause.
+type Signature struct {
+	Pattern string
+	Cause   string
+}
+
+// Signatures are checked in order; more specific messages come first because
+// the JVM usually follows them with "Could not create the Java Virtual Machine".
+var Signatures = []Signature{
+	{"Could not reserve enough space", "The JVM could not reserve the requested heap (-Xmx). Lower -Xmx or use a 64-bit runtime."},
+	{"Invalid maximum heap size", "The -Xmx value in jvm_args is invalid or too large for this runtime (32-bit runtimes are limited to about 1.5GB)."},
+	{"Invalid initial heap size", "The -Xms value in jvm_args is invalid."},
+	{"Initial heap size set to a larger value than the maximum heap size", "-Xms is larger than -Xmx in jvm_args."},
+	{"Unrecognized option", "jvm_args contains an option this Java version does not support."},
+	{"UnsupportedClassVersionError", "The application was compiled for a newer Java version than the configured runtime. Update java_dir."},
+	{"Error: Unable to access jarfile", "The jar file could not be read. Check jar_file and file permissions."},
+	{"no main manifest attribute", "The jar has no Main-Class in its manifest."},
+	{"Could not find or load main class", "The main class could not be loaded. The jar may be corrupt or incomplete."},
+	{"Error occurred during initialization of boot layer", "A required Java module is missing. The runtime may be incomplete or corrupt."},
+	{"java.lang.OutOfMemoryError", "The application ran out of memory. Consider increasing -Xmx."},
+	{"Could not create the Java Virtual Machine", "The JVM failed to initialize. Check jvm_args and the Java runtime."},
+}
+
+// Match returns the first signature found in lines.
+func Match(lines []string) (Signature, bool) {
+	for _, sig := range Signatures {
+		for _, line := range lines {
+			if strings.Contains(line, sig.Pattern) {
+				return sig, true
+			}
+		}
+	}
+	return Signature{}, false
+}
+
+// FindCrashFiles returns hs_err_pid*.log and replay_pid*.log files in dir
+// modified at or after since.
+func FindCrashFiles(dir string, since time.Time) []string {
+	var found []string
+	for _, pattern := range []string{"hs_err_pid*.log", "replay_pid*.log"} {
+		matches, _ := filepath.Glob(filepath.Join(dir, pattern))
+		for _, m := range matches {
+			if info, err := os.Stat(m); err == nil && !info.ModTime().Before(since) {
+				found = append(found, m)
+			}
+		}
+	}
+	sort.Strings(found)
+	return found
+}
+
+// Report describes a failed child run.
+type Report struct {
+	Time       time.Time
+	ExitCode   int
+	Err        error
+	Uptime     time.Duration
+	Argv       []string
+	WorkDir    string
+	Cause      string
+	CrashFiles []string
+	Stderr     []string
+}
+
+// Analyze builds a report from the captured stderr and the working directory.
+func Analyze(code int, err error, started time.Time, argv []string, workDir string, stderr []string) Report {
+	r := Report{
+		Time:       time.Now(),
+		ExitCode:   code,
+		Err:        err,
+		Uptime:     time.Since(started),
+		Argv:       argv,
+		WorkDir:    workDir,
+		CrashFiles: FindCrashFiles(workDir, started),
+		Stderr:     stderr,
+	}
+	if sig, ok := Match(stderr); ok {
+		r.Cause = sig.Cause
+	} else if len(r.CrashFiles) > 0 {
+		r.Cause = "The JVM crashed with a fatal error. See the crash log for details."
+	}
+	return r
+}
+
+// WriteReport writes r as a human-readable text file.
+func WriteReport(path string, r Report) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "GJG failure report - %s\n\n", r.Time.Format("2006-01-02 15:04:05"))
+	if r.Cause != "" {
+		fmt.Fprintf(&b, "Suggested cause: %s\n\n", r.Cause)
+	} else {
+		fmt.Fprintf(&b, "Suggested cause: unknown (see stderr below)\n\n")
+	}
+	if r.Err != nil {
+		fmt.Fprintf(&b, "Error: %v\n", r.Err)
+	}
+	fmt.Fprintf(&b, "Exit code: %d\n", r.ExitCode)
+	fmt.Fprintf(&b, "Uptime: %s\n", r.Uptime.Round(time.Millisecond))
+	fmt.Fprintf(&b, "Working directory: %s\n", r.WorkDir)
+	fmt.Fprintf(&b, "Command: %v\n", r.Argv)
+
+	if len(r.CrashFiles) > 0 {
+		fmt.Fprintf(&b, "\nCrash files:\n")
+		for _, f := range r.CrashFiles {
+			fmt.Fprintf(&b, "  %s\n", f)
+		}
+	}
+
+	fmt.Fprintf(&b, "\nLast stderr lines:\n")
+	if len(r.Stderr) == 0 {
+		fmt.Fprintf(&b, "  (none)\n")
+	}
+	for _, line := range r.Stderr {
+		fmt.Fprintf(&b, "  %s\n", line)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, []byte(b.String()), 0644)
+}
@@ -0,0 +1,96 @@
+package crash
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestTail(t *testing.T) {
+	tail := NewTail(2)
+	_, _ = tail.Write([]byte("one\r\ntwo\nthr"))
+	_, _ = tail.Write([]byte("ee\nfour"))
+
+	want := []string{"two", "three", "four"}
+	if got := tail.Lines(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Lines() = %q, want %q", got, want)
+	}
+
+	tail.Reset()
+	if got := tail.Lines(); len(got) != 0 {
+		t.Errorf("Lines() after Reset = %q, want empty", got)
+	}
+
+	// Output without newlines does not grow the tail
+	for range 1000 {
+		_, _ = tail.Write(bytes.Repeat([]byte("x"), 1000))
+	}
+	_, _ = tail.Write([]byte("\nlast"))
+	if got := tail.Lines(); len(got) != 2 || len(got[0]) != maxLineLen || got[1] != "last" {
+		t.Errorf("Lines() = %d lines of %d bytes, want one cut to %d and \"last\"", len(got), len(got[0]), maxLineLen)
+	}
+}
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		name    string
+		lines   []string
+		want    string
+		wantHit bool
+	}{
+		{
+			name:    "heap error wins over generic message",
+			lines:   []string{"Invalid maximum heap size: -Xmx9g", "Error: Could not create the Java Virtual Machine."},
+			want:    "Invalid maximum heap size",
+			wantHit: true,
+		},
+		{
+			name:    "class version",
+			lines:   []string{"Exception in thread \"main\" java.lang.UnsupportedClassVersionError: App has been compiled by a more recent version"},
+			want:    "UnsupportedClassVersionError",
+			wantHit: true,
+		},
+		{
+			name:    "missing jar",
+			lines:   []string{"Error: Unable to access jarfile app.jar"},
+			want:    "Error: Unable to access jarfile",
+			wantHit: true,
+		},
+		{
+			name:  "unknown output",
+			lines: []string{"something else"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sig, ok := Match(tt.lines)
+			if ok != tt.wantHit || sig.Pattern != tt.want {
+				t.Errorf("Match() = %q, %v, want %q, %v", sig.Pattern, ok, tt.want, tt.wantHit)
+			}
+		})
+	}
+}
+
+func TestFindCrashFiles(t *testing.T) {
+	dir := t.TempDir()
+	old := filepath.Join(dir, "hs_err_pid1.log")
+	fresh := filepath.Join(dir, "hs_err_pid2.log")
+	replay := filepath.Join(dir, "replay_pid2.log")
+	for _, p := range []string{old, fresh, replay, filepath.Join(dir, "other.log")} {
+		if err := os.WriteFile(p, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	since := time.Now().Add(-time.Minute)
+	if err := os.Chtimes(old, since.Add(-time.Hour), since.Add(-time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{fresh, replay}
+	if got := FindCrashFiles(dir, since); !reflect.DeepEqual(got, want) {
+		t.Errorf("FindCrashFiles() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,298 @@
+package diagnose
+
+import (
+	"archive/zip"
+	"bufio"
+	"context"
+	"fmt"
+	"gjg/internal/redact"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Input is everything the launcher knows when --gjg-diagnose is requested.
+// Only LauncherVersion is required; the rest is filled as far as config
+// loading got.
+type Input struct {
+	LauncherVersion string
+	SearchPaths     []string
+	ConfigPath      string
+	ConfigErr       error
+	JavaPath        string
+	Argv            []string
+	InheritedEnv    []string
+	Env             []string
+	WorkDir         string
+	LauncherLogs    []string
+	ConsoleLogs     []string
+	// Redactor hides secrets in the config, argv and environment. Nil uses the
+	// built-in patterns.
+	Redactor *redact.Redactor
+}
+
+// maxCrashFiles limits how many hs_err files are bundled.
+const maxCrashFiles = 5
+
+// Write creates the diagnostics zip at path.
+func Write(path string, in Input) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create diagnostics bundle: %w", err)
+	}
+	defer f.Close()
+
+	r := in.Redactor
+	if r == nil {
+		r = redact.Default()
+	}
+
+	zw := zip.NewWriter(f)
+	now := time.Now()
+	add := func(name, content string) error {
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: now})
+		if err != nil {
+			return err
+		}
+		_, err = io.WriteString(w, content)
+		return err
+	}
+	addFile := func(name, src string) error {
+		data, err := os.ReadFile(src)
+		if err != nil {
+			return nil
+		}
+		return add(name, string(data))
+	}
+
+	files := []struct{ name, content string }{
+		{"summary.txt", summary(in)},
+		{"config-search.txt", configSearch(in)},
+		{"config.txt", redactedConfig(in.ConfigPath, r)},
+		{"argv.txt", strings.Join(r.Args(in.Argv), "\n") + "\n"},
+		{"env-diff.txt", envDiff(in.InheritedEnv, in.Env, r)},
+		{"java.txt", javaInfo(in.JavaPath)},
+	}
+	for _, file := range files {
+		if err := add(file.name, file.content); err != nil {
+			return err
+		}
+	}
+
+	for _, p := range in.LauncherLogs {
+		if err := addFile("logs/"+filepath.Base(p), p); err != nil {
+			return err
+		}
+	}
+	for _, p := range in.ConsoleLogs {
+		if err := addFile("console/"+filepath.Base(p), p); err != nil {
+			return err
+		}
+	}
+	for _, p := range crashFiles(in.WorkDir) {
+		if err := addFile("crash/"+filepath.Base(p), p); err != nil {
+			return err
+		}
+	}
+
+	if err := zw.Close(); err != nil {
+		return fmt.Errorf("failed to write diagnostics bundle: %w", err)
+	}
+	return f.Close()
+}
+
+func summary(in Input) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Generated: %s\n", time.Now().Format(time.RFC3339))
+	fmt.Fprintf(&b, "Launcher version: %s\n", in.LauncherVersion)
+	if exe, err := os.Executable(); err == nil {
+		fmt.Fprintf(&b, "Launcher executable: %s\n", exe)
+	}
+	if cwd, err := os.Getwd(); err == nil {
+		fmt.Fprintf(&b, "Current directory: %s\n", cwd)
+	}
+	fmt.Fprintf(&b, "OS/Arch: %s/%s\n", runtime.GOOS, runtime.GOARCH)
+	fmt.Fprintf(&b, "CPUs: %d\n", runtime.NumCPU())
+	fmt.Fprintf(&b, "Memory: %s\n", memoryInfo())
+	fmt.Fprintf(&b, "Config file: %s\n", valueOr(in.ConfigPath, "(not found)"))
+	if in.ConfigErr != nil {
+		fmt.Fprintf(&b, "Config error: %v\n", in.ConfigErr)
+	} else {
+		fmt.Fprintf(&b, "Config error: none\n")
+	}
+	fmt.Fprintf(&b, "Working directory: %s\n", valueOr(in.WorkDir, "(unknown)"))
+	return b.String()
+}
+
+func configSearch(in Input) string {
+	var b strings.Builder
+	for _, p := range in.SearchPaths {
+		abs, _ := filepath.Abs(p)
+		status := "not found"
+		if _, err := os.Stat(p); err == nil {
+			status = "found"
+		}
+		if abs == in.ConfigPath {
+			status += " (used)"
+		}
+		fmt.Fprintf(&b, "%s: %s\n", abs, status)
+	}
+	return b.String()
+}
+
+func redactedConfig(path string, r *redact.Redactor) string {
+	if path == "" {
+		return "(no configuration file)\n"
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Sprintf("(cannot read %s: %v)\n", path, err)
+	}
+	defer f.Close()
+
+	var b strings.Builder
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		key, val, ok := strings.Cut(line, "=")
+		trimmedKey := strings.TrimSpace(key)
+		switch {
+		case !ok || strings.HasPrefix(strings.TrimSpace(line), "#"):
+		case strings.HasPrefix(trimmedKey, "env_") && r.IsSecret(strings.TrimPrefix(trimmedKey, "env_")):
+			line = key + "=" + redact.Mask
+		default:
+			line = key + "=" + r.String(val)
+		}
+		b.WriteString(line + "\n")
+	}
+	return b.String()
+}
+
+// envDiff lists variables the launcher added or changed compared to the
+// inherited environment, and inherited ones it dropped.
+func envDiff(inherited, final []string, r *redact.Redactor) string {
+	if len(final) == 0 {
+		return "(environment not resolved)\n"
+	}
+	before := envMap(inherited)
+	after := envMap(final)
+
+	var lines []string
+	for k, v := range after {
+		old, ok := before[k]
+		switch {
+		case !ok:
+			lines = append(lines, "+ "+r.Env([]string{k + "=" + v})[0])
+		case old != v:
+			lines = append(lines, "~ "+r.Env([]string{k + "=" + v})[0])
+		}
+	}
+	for k := range before {
+		if _, ok := after[k]; !ok {
+			lines = append(lines, "- "+k)
+		}
+	}
+	sort.Slice(lines, func(i, j int) bool { return lines[i][2:] < lines[j][2:] })
+	if len(lines) == 0 {
+		return "(no changes)\n"
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+func envMap(env []string) map[string]string {
+	m := make(map[string]string, len(env))
+	for _, kv := range env {
+		if k, v, ok := strings.Cut(kv, "="); ok {
+			m[k] = v
+		}
+	}
+	return m
+}
+
+// javaInfo reports the configured Java and the one on PATH, with their -version output.
+func javaInfo(configured string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Configured java: %s\n", valueOr(configured, "(not resolved)"))
+
+	candidates := []string{configured}
+	for _, name := range []string{"javaw.exe", "java"} {
+		if p, err := exec.LookPath(name); err == nil {
+			fmt.Fprintf(&b, "On PATH (%s): %s\n", name, p)
+			candidates = append(candidates, p)
+		}
+	}
+	if home := os.Getenv("JAVA_HOME"); home != "" {
+		fmt.Fprintf(&b, "JAVA_HOME: %s\n", home)
+	}
+
+	seen := map[string]bool{}
+	for _, c := range candidates {
+		if c == "" || seen[c] {
+			continue
+		}
+		seen[c] = true
+		fmt.Fprintf(&b, "\n$ %s -version\n%s", c, javaVersion(c))
+	}
+	return b.String()
+}
+
+func javaVersion(java string) string {
+	// javaw has no console output; use the java binary next to it
+	if strings.EqualFold(filepath.Base(java), "javaw.exe") {
+		if p := filepath.Join(filepath.Dir(java), "java.exe"); fileExists(p) {
+			java = p
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, java, "-version").CombinedOutput()
+	if err != nil {
+		return fmt.Sprintf("%s(error: %v)\n", out, err)
+	}
+	return string(out)
+}
+
+// crashFiles returns the newest JVM crash files in dir.
+func crashFiles(dir string) []string {
+	if dir == "" {
+		return nil
+	}
+	var files []string
+	for _, pattern := range []string{"hs_err_pid*.log", "replay_pid*.log"} {
+		matches, _ := filepath.Glob(filepath.Join(dir, pattern))
+		files = append(files, matches...)
+	}
+	sort.Slice(files, func(i, j int) bool { return modTime(files[i]).After(modTime(files[j])) })
+	if len(files) > maxCrashFiles {
+		files = files[:maxCrashFiles]
+	}
+	return files
+}
+
+func modTime(p string) time.Time {
+	info, err := os.Stat(p)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
+
+func fileExists(p string) bool {
+	_, err := os.Stat(p)
+	return err == nil
+}
+
+func valueOr(v, fallback string) string {
+	if v == "" {
+		return fallback
+	}
+	return v
+}
@@ -0,0 +1,66 @@
+package diagnose
+
+import (
+	"archive/zip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWriteRedactsSecrets(t *testing.T) {
+	dir := t.TempDir()
+	confPath := filepath.Join(dir, "app.gjg.conf")
+	conf := "jvm_args=-Xmx1g \"-Ddb.password=hunter2\"\nenv_API_TOKEN=abc\nenv_FOO=bar\n"
+	if err := os.WriteFile(confPath, []byte(conf), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "hs_err_pid7.log"), []byte("crash"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	zipPath := filepath.Join(dir, "out", "diag.zip")
+	err := Write(zipPath, Input{
+		LauncherVersion: "test",
+		ConfigPath:      confPath,
+		Argv:            []string{"java", "-Ddb.password=hunter2", "--api-key=abc", "-jar", "app.jar"},
+		InheritedEnv:    []string{"HOME=/home/me", "GONE=1"},
+		Env:             []string{"HOME=/home/me", "API_TOKEN=abc", "FOO=bar"},
+		WorkDir:         dir,
+	})
+	if err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+
+	zr, err := zip.OpenReader(zipPath)
+	if err != nil {
+		t.Fatalf("OpenReader() error = %v", err)
+	}
+	defer zr.Close()
+
+	contents := map[string]string{}
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := io.ReadAll(rc)
+		rc.Close()
+		contents[f.Name] = string(data)
+	}
+
+	for _, name := range []string{"summary.txt", "config-search.txt", "config.txt", "argv.txt", "env-diff.txt", "java.txt", "crash/hs_err_pid7.log"} {
+		if _, ok := contents[name]; !ok {
+			t.Errorf("bundle is missing %s", name)
+		}
+	}
+	for name, content := range contents {
+		if strings.Contains(content, "hunter2") || strings.Contains(content, "=abc") {
+			t.Errorf("%s leaks a secret:\n%s", name, content)
+		}
+	}
+	if want := "+ API_TOKEN=***\n+ FOO=bar\n- GONE\n"; contents["env-diff.txt"] != want {
+		t.Errorf("env-diff.txt = %q, want %q", contents["env-diff.txt"], want)
+	}
+}
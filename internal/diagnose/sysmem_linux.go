@@ -0,0 +1,31 @@
+//go:build linux
+
+package diagnose
+
+import (
+	"bufio"
+	"os"
+	"strings"
+)
+
+// memoryInfo returns total and available memory as reported by /proc/meminfo.
+func memoryInfo() string {
+	f, err := os.Open("/proc/meminfo")
+	if err != nil {
+		return "unknown"
+	}
+	defer f.Close()
+
+	var parts []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "MemTotal:") || strings.HasPrefix(line, "MemAvailable:") {
+			parts = append(parts, strings.Join(strings.Fields(line), " "))
+		}
+	}
+	if len(parts) == 0 {
+		return "unknown"
+	}
+	return strings.Join(parts, ", ")
+}
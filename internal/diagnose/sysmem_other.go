@@ -0,0 +1,7 @@
+//go:build !linux && !windows
+
+package diagnose
+
+func memoryInfo() string {
+	return "unknown"
+}
@@ -0,0 +1,34 @@
+//go:build windows
+
+package diagnose
+
+import (
+	"fmt"
+	"syscall"
+	"unsafe"
+)
+
+type memoryStatusEx struct {
+	Length               uint32
+	MemoryLoad           uint32
+	TotalPhys            uint64
+	AvailPhys            uint64
+	TotalPageFile        uint64
+	AvailPageFile        uint64
+	TotalVirtual         uint64
+	AvailVirtual         uint64
+	AvailExtendedVirtual uint64
+}
+
+var procGlobalMemoryStatusEx = syscall.NewLazyDLL("kernel32.dll").NewProc("GlobalMemoryStatusEx")
+
+// memoryInfo returns physical and virtual memory from GlobalMemoryStatusEx.
+// The virtual address space matters for 32-bit runtimes.
+func memoryInfo() string {
+	var m memoryStatusEx
+	m.Length = uint32(unsafe.Sizeof(m))
+	if r, _, _ := procGlobalMemoryStatusEx.Call(uintptr(unsafe.Pointer(&m))); r == 0 {
+		return "unknown"
+	}
+	return fmt.Sprintf("MemTotal: %d MB, MemAvailable: %d MB, Virtual: %d MB", m.TotalPhys>>20, m.AvailPhys>>20, m.TotalVirtual>>20)
+}
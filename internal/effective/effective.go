@@ -0,0 +1,267 @@
+package effective
+
+import (
+	"encoding/json"
+	"fmt"
+	"gjg/internal/args"
+	"gjg/internal/config"
+	"gjg/internal/maven"
+	"gjg/internal/redact"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Setting is one effective value and where it came from.
+type Setting struct {
+	Name   string        `json:"name"`
+	Value  any           `json:"value"`
+	Source config.Source `json:"source"`
+	Note   string        `json:"note,omitempty"`
+}
+
+// EnvChange is an environment variable the launcher added, overrode or
+// removed compared to the inherited environment.
+type EnvChange struct {
+	Name   string        `json:"name"`
+	Value  string        `json:"value,omitempty"`
+	Change string        `json:"change"`
+	Source config.Source `json:"source"`
+}
+
+// Config is the effective configuration of a launch.
+type Config struct {
+	ConfigFile string      `json:"configFile"`
+	Settings   []Setting   `json:"settings"`
+	Command    []string    `json:"command"`
+	Env        []EnvChange `json:"env"`
+}
+
+// Build describes cfg, the resulting argv and the environment changes, with
+// secrets redacted.
+func Build(cfg *config.Config, confPath string, argv, forwardArgs, inheritedEnv []string, r *redact.Redactor) Config {
+	e := Config{ConfigFile: confPath, Command: r.Args(argv)}
+	add := func(name string, value any, src config.Source, note string) {
+		e.Settings = append(e.Settings, Setting{Name: name, Value: value, Source: src, Note: note})
+	}
+	file := cfg.SourceOf
+	flag := config.Source{Kind: config.SourceFlag}
+	def := config.Source{Kind: config.SourceDefault}
+
+	switch {
+	case cfg.JavaLookup == "java_download" && cfg.JavaDownload.Pending:
+		add("java", cfg.JavaExecutableAbsolutePath, file("java_download_url"), "downloaded on launch")
+	case cfg.JavaLookup == "java_download":
+		add("java", cfg.JavaExecutableAbsolutePath, file("java_download_url"), "from the shared runtimes cache")
+	case cfg.JavaLookup == "PATH":
+		add("java", cfg.JavaExecutableAbsolutePath, config.Source{Kind: config.SourceEnvironment}, "found on PATH")
+	default:
+		add("java", cfg.JavaExecutableAbsolutePath, file("java_dir"), "resolved from java_dir")
+	}
+	jarNote := ""
+	if _, ok := cfg.Sources["jar_file"]; !ok {
+		jarNote = "derived from the executable name"
+	}
+	if cfg.JNLP.Source != "" {
+		src := file("jnlp")
+		add("jnlp", cfg.JNLP.Source, src, "")
+		if cfg.JNLP.Resolved {
+			add("main_class", cfg.MainClass, src, "from the JNLP file")
+			add("classpath", nonNil(cfg.Classpath), src, "cached JNLP jars")
+		} else {
+			add("main_class", cfg.MainClass, src, "read from the JNLP file on launch")
+			add("classpath", nonNil(cfg.Classpath), src, "JNLP jars fetched on launch")
+		}
+	} else {
+		if cfg.JarFileAbsolutePath != "" || cfg.MainClass == "" {
+			add("jar_file", cfg.JarFileAbsolutePath, file("jar_file"), jarNote)
+		}
+		if cfg.MainClass != "" {
+			add("main_class", cfg.MainClass, file("main_class"), "")
+			cpNote := "jar_file, then the resolved dependencies"
+			if len(cfg.Maven.Dependencies) > 0 && !cfg.Maven.Resolved {
+				cpNote = "jar_file; the dependencies are resolved on launch"
+			}
+			add("classpath", nonNil(cfg.Classpath), def, cpNote)
+		}
+		if len(cfg.Maven.Dependencies) > 0 {
+			repos, reposSrc := cfg.Maven.Repositories, file("repository")
+			if len(repos) == 0 {
+				repos, reposSrc = []string{maven.Central}, def
+			}
+			add("dependency", cfg.Maven.Dependencies, file("dependency"), "")
+			add("repository", repos, reposSrc, "")
+			add("maven_local", cfg.Maven.Local, def, "shared local repository")
+			add("lock_file", cfg.Maven.LockFile, def, "per-app cache directory")
+		}
+	}
+	add("jvm_args", r.Args(args.Tokenize(cfg.JVMArgs)), file("jvm_args"), "")
+	add("app_args", r.Args(args.Tokenize(cfg.AppArgs)), file("app_args"), "")
+	add("forward_args", r.Args(nonNil(forwardArgs)), flag, "command-line arguments")
+	add("working_dir", filepath.Dir(confPath), def, "configuration file directory")
+
+	add("restart", cfg.Restart.Mode, file("restart"), "")
+	add("restart_exit_codes", nonNil(cfg.Restart.ExitCodes), file("restart_exit_codes"), "")
+	add("restart_max", cfg.Restart.Max, file("restart_max"), "")
+	add("restart_window", cfg.Restart.Window.String(), file("restart_window"), "")
+	add("restart_delay", cfg.Restart.Delay.String(), file("restart_delay"), "")
+	add("restart_max_delay", cfg.Restart.MaxDelay.String(), file("restart_max_delay"), "")
+
+	add("stdout_log", cfg.Console.StdoutLog, consoleSource(cfg, "stdout_log"), "")
+	add("stderr_log", cfg.Console.StderrLog, consoleSource(cfg, "stderr_log"), "")
+	add("console_log_max_size", cfg.Console.MaxSize, file("console_log_max_size"), "bytes")
+	add("console_log_keep", cfg.Console.Keep, file("console_log_keep"), "")
+	add("console_log_timestamps", cfg.Console.Timestamps, file("console_log_timestamps"), "")
+
+	add("heap_fallback", nonNil(cfg.HeapFallback), file("heap_fallback"), "")
+
+	add("single_instance", cfg.SingleInstance.Scope, file("single_instance"), "")
+	add("single_instance_policy", cfg.SingleInstance.Policy, file("single_instance_policy"), "")
+	add("single_instance_inbox", cfg.SingleInstance.Inbox, file("single_instance_inbox"), "")
+
+	add("pre_launch", redactAll(r, cfg.Hooks.PreLaunch), file("pre_launch"), "")
+	add("post_exit", redactAll(r, cfg.Hooks.PostExit), file("post_exit"), "")
+	add("on_failure", cfg.Hooks.OnFailure, file("on_failure"), "")
+	add("hook_timeout", cfg.Hooks.Timeout.String(), file("hook_timeout"), "")
+
+	add("verify", cfg.Verify.Mode, file("verify"), "")
+	verifyMode := "fast"
+	if cfg.Verify.Full {
+		verifyMode = "full"
+	}
+	add("verify_mode", verifyMode, file("verify_mode"), "")
+
+	add("exec", cfg.Exec, file("exec"), "")
+
+	add("update_url", cfg.Update.URL, file("update_url"), "")
+	add("update_interval", cfg.Update.Interval.String(), file("update_interval"), "")
+	add("update_timeout", cfg.Update.Timeout.String(), file("update_timeout"), "")
+
+	add("versions_dir", cfg.Versions.Dir, file("versions_dir"), "")
+	add("keep_versions", cfg.Versions.Keep, file("keep_versions"), "")
+	if cfg.Versions.Requested {
+		add("version", cfg.Versions.Selected, flag, "--gjg-use-version")
+	} else if cfg.Versions.Dir != "" {
+		add("version", cfg.Versions.Selected, def, "current version")
+	}
+
+	add("log_file", cfg.LogFile, file("log_file"), "")
+	add("redact", nonNil(cfg.Redact), file("redact"), "")
+
+	e.Env = envChanges(cfg, inheritedEnv, r)
+	return e
+}
+
+func consoleSource(cfg *config.Config, key string) config.Source {
+	if _, ok := cfg.Sources[key]; !ok {
+		if _, ok := cfg.Sources["console_log"]; ok {
+			return cfg.SourceOf("console_log")
+		}
+	}
+	return cfg.SourceOf(key)
+}
+
+func redactAll(r *redact.Redactor, list []string) []string {
+	out := make([]string, len(list))
+	for i, s := range list {
+		out[i] = r.String(s)
+	}
+	return out
+}
+
+func nonNil[T any](s []T) []T {
+	if s == nil {
+		return []T{}
+	}
+	return s
+}
+
+func envChanges(cfg *config.Config, inherited []string, r *redact.Redactor) []EnvChange {
+	before := envMap(inherited)
+	after := envMap(cfg.Env)
+
+	changes := []EnvChange{}
+	for k, v := range after {
+		old, ok := before[k]
+		if ok && old == v {
+			continue
+		}
+		change := "added"
+		if ok {
+			change = "overridden"
+		}
+		changes = append(changes, EnvChange{
+			Name:   k,
+			Value:  strings.TrimPrefix(r.Env([]string{k + "=" + v})[0], k+"="),
+			Change: change,
+			Source: cfg.SourceOf("env_" + k),
+		})
+	}
+	for k := range before {
+		if _, ok := after[k]; !ok {
+			changes = append(changes, EnvChange{Name: k, Change: "removed", Source: config.Source{Kind: config.SourceEnvironment}})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Name < changes[j].Name })
+	return changes
+}
+
+func envMap(env []string) map[string]string {
+	m := make(map[string]string, len(env))
+	for _, kv := range env {
+		if k, v, ok := strings.Cut(kv, "="); ok {
+			m[k] = v
+		}
+	}
+	return m
+}
+
+// WriteJSON writes e as indented JSON.
+func (e Config) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(e)
+}
+
+// WriteText writes e as aligned "name = value  [source]" lines.
+func (e Config) WriteText(w io.Writer) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Configuration file: %s\n\n", e.ConfigFile)
+
+	width := 0
+	for _, s := range e.Settings {
+		width = max(width, len(s.Name))
+	}
+	for _, s := range e.Settings {
+		src := s.Source.String()
+		if s.Note != "" {
+			src += ", " + s.Note
+		}
+		fmt.Fprintf(&b, "%-*s = %v  [%s]\n", width, s.Name, s.Value, src)
+	}
+
+	fmt.Fprintf(&b, "\nCommand:\n")
+	for _, a := range e.Command {
+		fmt.Fprintf(&b, "  %s\n", a)
+	}
+
+	fmt.Fprintf(&b, "\nEnvironment changes:\n")
+	if len(e.Env) == 0 {
+		fmt.Fprintf(&b, "  (none)\n")
+	}
+	for _, c := range e.Env {
+		if c.Change == "removed" {
+			fmt.Fprintf(&b, "  - %s  [%s]\n", c.Name, c.Source)
+			continue
+		}
+		sign := "+"
+		if c.Change == "overridden" {
+			sign = "~"
+		}
+		fmt.Fprintf(&b, "  %s %s=%s  [%s]\n", sign, c.Name, c.Value, c.Source)
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
@@ -0,0 +1,117 @@
+package effective
+
+import (
+	"bytes"
+	"encoding/json"
+	"gjg/internal/config"
+	"gjg/internal/redact"
+	"strings"
+	"testing"
+)
+
+func TestBuild(t *testing.T) {
+	src := func(line int) config.Source {
+		return config.Source{Kind: config.SourceFile, File: "/app/app.gjg.conf", Line: line}
+	}
+	cfg := &config.Config{
+		JavaExecutableAbsolutePath: "/usr/bin/java",
+		JavaLookup:                 "PATH",
+		JarFileAbsolutePath:        "/app/app.jar",
+		JVMArgs:                    `-Xmx1g "-Ddb.password=hunter 2"`,
+		Env:                        []string{"HOME=/home/me", "API_TOKEN=abc", "LANG=C"},
+		Sources: map[string]config.Source{
+			"jvm_args":      src(2),
+			"env_API_TOKEN": src(3),
+			"env_LANG":      src(4),
+		},
+	}
+	inherited := []string{"HOME=/home/me", "LANG=en_US", "TMP=/tmp"}
+
+	e := Build(cfg, "/app/app.gjg.conf", []string{"/usr/bin/java"}, []string{"--open"}, inherited, redact.Default())
+
+	settings := map[string]Setting{}
+	for _, s := range e.Settings {
+		settings[s.Name] = s
+	}
+	if s := settings["java"]; s.Source.Kind != config.SourceEnvironment {
+		t.Errorf("java source = %v, want environment", s.Source)
+	}
+	if s := settings["jar_file"]; s.Source.Kind != config.SourceDefault || s.Note == "" {
+		t.Errorf("jar_file = %+v, want default with note", s)
+	}
+	jvm := settings["jvm_args"]
+	if jvm.Source != src(2) {
+		t.Errorf("jvm_args source = %v, want %v", jvm.Source, src(2))
+	}
+	if got := jvm.Value.([]string); len(got) != 2 || got[1] != "-Ddb.password=***" {
+		t.Errorf("jvm_args value = %q", got)
+	}
+	if s := settings["forward_args"]; s.Source.Kind != config.SourceFlag {
+		t.Errorf("forward_args source = %v, want flag", s.Source)
+	}
+	if s := settings["working_dir"]; s.Value != "/app" {
+		t.Errorf("working_dir = %v, want /app", s.Value)
+	}
+
+	want := []EnvChange{
+		{Name: "API_TOKEN", Value: "***", Change: "added", Source: src(3)},
+		{Name: "LANG", Value: "C", Change: "overridden", Source: src(4)},
+		{Name: "TMP", Change: "removed", Source: config.Source{Kind: config.SourceEnvironment}},
+	}
+	if len(e.Env) != len(want) {
+		t.Fatalf("Env = %+v, want %+v", e.Env, want)
+	}
+	for i := range want {
+		if e.Env[i] != want[i] {
+			t.Errorf("Env[%d] = %+v, want %+v", i, e.Env[i], want[i])
+		}
+	}
+}
+
+func TestWrite(t *testing.T) {
+	cfg := &config.Config{
+		JavaExecutableAbsolutePath: "/usr/bin/java",
+		JavaLookup:                 "java_dir",
+		Sources:                    map[string]config.Source{"java_dir": {Kind: config.SourceFile, File: "app.gjg.conf", Line: 1}},
+	}
+	e := Build(cfg, "/app/app.gjg.conf", []string{"/usr/bin/java", "-jar", "app.jar"}, nil, nil, redact.Default())
+
+	var text bytes.Buffer
+	if err := e.WriteText(&text); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(text.String(), "[app.gjg.conf:1, resolved from java_dir]") {
+		t.Errorf("WriteText() missing java source:\n%s", text.String())
+	}
+
+	var out bytes.Buffer
+	if err := e.WriteJSON(&out); err != nil {
+		t.Fatal(err)
+	}
+	var decoded Config
+	if err := json.Unmarshal(out.Bytes(), &decoded); err != nil {
+		t.Fatalf("WriteJSON() produced invalid JSON: %v", err)
+	}
+	if decoded.Settings[0].Source.Line != 1 || len(decoded.Command) != 3 {
+		t.Errorf("WriteJSON() round trip = %+v", decoded)
+	}
+}
+
+func TestBuildUnresolved(t *testing.T) {
+	cfg := &config.Config{
+		JavaExecutableAbsolutePath: "/cache/gjg-runtimes/17/bin/java",
+		JavaLookup:                 "java_download",
+		JavaDownload:               config.JavaDownloadConfig{Pending: true},
+		JNLP:                       config.JNLPConfig{Source: "https://example.com/app.jnlp"},
+	}
+	e := Build(cfg, "/app/app.gjg.conf", []string{"/cache/gjg-runtimes/17/bin/java"}, nil, nil, redact.Default())
+	notes := map[string]string{}
+	for _, s := range e.Settings {
+		notes[s.Name] = s.Note
+	}
+	for name, want := range map[string]string{"java": "downloaded on launch", "classpath": "JNLP jars fetched on launch"} {
+		if notes[name] != want {
+			t.Errorf("%s note = %q, want %q", name, notes[name], want)
+		}
+	}
+}
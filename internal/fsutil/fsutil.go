@@ -0,0 +1,73 @@
+// Package fsutil holds the file helpers shared by the launcher's caches,
+// installers and state files.
+package fsutil
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+)
+
+// WriteFile replaces path atomically: data goes to a temporary file in the
+// same directory, which is then renamed over path, so readers never see a
+// partial file and concurrent writers do not share a temporary name.
+// Missing parent directories are created.
+func WriteFile(path string, data []byte, perm os.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), perm); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// SHA256 returns the hex SHA-256 of the file at path.
+func SHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// FromURL returns the local path of a file: URL.
+func FromURL(u *url.URL) string {
+	p := u.Path
+	if len(p) > 2 && p[0] == '/' && p[2] == ':' && runtime.GOOS == "windows" {
+		// /C:/apps/app.jnlp
+		p = p[1:]
+	}
+	return filepath.FromSlash(p)
+}
+
+// ToURL returns the file: URL of the absolute path p.
+func ToURL(p string) *url.URL {
+	u := &url.URL{Scheme: "file", Path: filepath.ToSlash(p)}
+	if filepath.VolumeName(p) != "" {
+		// file:///C:/apps/app.jnlp
+		u.Path = "/" + u.Path
+	}
+	return u
+}
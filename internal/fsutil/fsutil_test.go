@@ -0,0 +1,43 @@
+package fsutil
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sub", "state.json")
+	for _, data := range []string{"first", "second"} {
+		if err := WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatalf("WriteFile() error = %v", err)
+		}
+		if got, err := os.ReadFile(path); err != nil || string(got) != data {
+			t.Errorf("file = %q, %v; want %q", got, err, data)
+		}
+	}
+	entries, _ := os.ReadDir(filepath.Dir(path))
+	if len(entries) != 1 {
+		t.Errorf("directory holds %d entries, want no temporary files left", len(entries))
+	}
+}
+
+func TestSHA256(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "a")
+	os.WriteFile(path, []byte("abc"), 0644)
+	got, err := SHA256(path)
+	if want := "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"; err != nil || got != want {
+		t.Errorf("SHA256() = %s, %v; want %s", got, err, want)
+	}
+}
+
+func TestURLRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	u := ToURL(dir)
+	if u.Scheme != "file" {
+		t.Fatalf("ToURL(%q) = %s", dir, u)
+	}
+	if got := FromURL(u); got != dir {
+		t.Errorf("FromURL(ToURL(%q)) = %q", dir, got)
+	}
+}
@@ -0,0 +1,238 @@
+package history
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"gjg/internal/fsutil"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// FileName is the history file name in the per-app cache directory.
+const FileName = "history.jsonl"
+
+// DefaultMaxSize caps the history file; older launches are dropped beyond it.
+const DefaultMaxSize = 1 << 20
+
+// Entry describes one launch.
+type Entry struct {
+	Time            time.Time `json:"time"`
+	LauncherVersion string    `json:"launcherVersion"`
+	// Profile is the configuration the launch used, e.g. "myapp" for myapp.gjg.conf.
+	Profile     string `json:"profile,omitempty"`
+	JavaVersion string `json:"javaVersion,omitempty"`
+	// ArgvHash identifies the command line without storing it.
+	ArgvHash   string `json:"argvHash"`
+	DurationMs int64  `json:"durationMs"`
+	ExitCode   int    `json:"exitCode"`
+	Signal     string `json:"signal,omitempty"`
+	Restarts   int    `json:"restarts"`
+	Error      string `json:"error,omitempty"`
+	// Stopped is set when the launcher stopped Java itself (Ctrl+C, replaced).
+	Stopped bool `json:"stopped,omitempty"`
+	// Exec is set when Java replaced the launcher (exec mode): the entry is
+	// written before Java starts, so its duration and outcome are unknown.
+	Exec bool `json:"exec,omitempty"`
+}
+
+// Duration returns how long the launch ran.
+func (e Entry) Duration() time.Duration {
+	return time.Duration(e.DurationMs) * time.Millisecond
+}
+
+// Failed reports whether the launch ended with an error, a signal or a
+// non-zero exit code that the launcher did not cause. Exec'd launches never
+// count as failed since their outcome is not known.
+func (e Entry) Failed() bool {
+	return !e.Stopped && !e.Exec && (e.ExitCode != 0 || e.Signal != "" || e.Error != "")
+}
+
+// HashArgv returns a short stable hash of argv.
+func HashArgv(argv []string) string {
+	sum := sha256.Sum256([]byte(strings.Join(argv, "\x00")))
+	return hex.EncodeToString(sum[:8])
+}
+
+// File is an append-only JSON lines history.
+type File struct {
+	Path string
+	// MaxSize is the size above which the oldest half of the entries is
+	// dropped. Zero uses DefaultMaxSize.
+	MaxSize int64
+}
+
+// Append adds e to the history, trimming it when it grows past MaxSize.
+func (f File) Append(e Entry) error {
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(f.Path), 0755); err != nil {
+		return err
+	}
+	out, err := os.OpenFile(f.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open history: %w", err)
+	}
+	_, err = out.Write(append(line, '\n'))
+	info, statErr := out.Stat()
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write history: %w", err)
+	}
+
+	maxSize := f.MaxSize
+	if maxSize <= 0 {
+		maxSize = DefaultMaxSize
+	}
+	if statErr == nil && info.Size() > maxSize {
+		return f.trim(maxSize / 2)
+	}
+	return nil
+}
+
+// trim keeps the newest lines that fit in size bytes.
+func (f File) trim(size int64) error {
+	data, err := os.ReadFile(f.Path)
+	if err != nil {
+		return err
+	}
+	lines := bytes.SplitAfter(data, []byte("\n"))
+	var kept int64
+	start := len(lines)
+	for start > 0 && kept+int64(len(lines[start-1])) <= size {
+		start--
+		kept += int64(len(lines[start]))
+	}
+	return fsutil.WriteFile(f.Path, bytes.Join(lines[start:], nil), 0644)
+}
+
+// Entries returns the recorded launches, oldest first. Unreadable lines are skipped.
+func (f File) Entries() ([]Entry, error) {
+	in, err := os.Open(f.Path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer in.Close()
+
+	var entries []Entry
+	scanner := bufio.NewScanner(in)
+	for scanner.Scan() {
+		var e Entry
+		if json.Unmarshal(scanner.Bytes(), &e) == nil {
+			entries = append(entries, e)
+		}
+	}
+	return entries, scanner.Err()
+}
+
+// Summary aggregates a history.
+type Summary struct {
+	Launches int
+	// Execs counts the launches that replaced the launcher with Java; they are
+	// left out of failures and uptime.
+	Execs        int
+	Failures     int
+	Restarts     int
+	Since        time.Time
+	MedianUptime time.Duration
+	// LastFailures are the most recent failed launches, newest first.
+	LastFailures []Entry
+}
+
+// FailureRate is the share of launches with a known outcome that failed,
+// from 0 to 1.
+func (s Summary) FailureRate() float64 {
+	if s.Launches == s.Execs {
+		return 0
+	}
+	return float64(s.Failures) / float64(s.Launches-s.Execs)
+}
+
+// Summarize aggregates entries, keeping up to lastFailures failed launches.
+func Summarize(entries []Entry, lastFailures int) Summary {
+	s := Summary{Launches: len(entries)}
+	if len(entries) == 0 {
+		return s
+	}
+	s.Since = entries[0].Time
+
+	durations := make([]time.Duration, 0, len(entries))
+	for i := len(entries) - 1; i >= 0; i-- {
+		e := entries[i]
+		if e.Exec {
+			s.Execs++
+			continue
+		}
+		durations = append(durations, e.Duration())
+		s.Restarts += e.Restarts
+		if e.Failed() {
+			s.Failures++
+			if len(s.LastFailures) < lastFailures {
+				s.LastFailures = append(s.LastFailures, e)
+			}
+		}
+	}
+	slices.Sort(durations)
+	switch n := len(durations); {
+	case n == 0:
+		// Only exec'd launches, whose uptime is unknown
+	case n%2 == 1:
+		s.MedianUptime = durations[n/2]
+	default:
+		s.MedianUptime = (durations[n/2-1] + durations[n/2]) / 2
+	}
+	return s
+}
+
+// WriteText writes a human-readable summary.
+func (s Summary) WriteText(w io.Writer) error {
+	var b strings.Builder
+	if s.Launches == 0 {
+		b.WriteString("No launches recorded.\n")
+		_, err := io.WriteString(w, b.String())
+		return err
+	}
+	fmt.Fprintf(&b, "Launches:      %d (since %s)\n", s.Launches, s.Since.Local().Format(time.DateTime))
+	if s.Execs > 0 {
+		fmt.Fprintf(&b, "Exec'd:        %d (outcome not recorded)\n", s.Execs)
+	}
+	fmt.Fprintf(&b, "Failures:      %d (%.1f%%)\n", s.Failures, 100*s.FailureRate())
+	fmt.Fprintf(&b, "Restarts:      %d\n", s.Restarts)
+	fmt.Fprintf(&b, "Median uptime: %s\n", s.MedianUptime.Round(time.Second))
+	if len(s.LastFailures) > 0 {
+		b.WriteString("\nLast failures:\n")
+		for _, e := range s.LastFailures {
+			fmt.Fprintf(&b, "  %s  %s  uptime %s", e.Time.Local().Format(time.DateTime), describeExit(e), e.Duration().Round(time.Second))
+			if e.JavaVersion != "" {
+				fmt.Fprintf(&b, "  java %s", e.JavaVersion)
+			}
+			b.WriteString("\n")
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func describeExit(e Entry) string {
+	switch {
+	case e.Signal != "":
+		return "signal " + e.Signal
+	case e.Error != "":
+		return "error: " + e.Error
+	}
+	return fmt.Sprintf("exit code %d", e.ExitCode)
+}
@@ -0,0 +1,96 @@
+package history
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAppendEntries(t *testing.T) {
+	f := File{Path: filepath.Join(t.TempDir(), "cache", FileName)}
+	for i := range 3 {
+		if err := f.Append(Entry{ExitCode: i, ArgvHash: HashArgv([]string{"java"})}); err != nil {
+			t.Fatalf("Append() error = %v", err)
+		}
+	}
+	entries, err := f.Entries()
+	if err != nil {
+		t.Fatalf("Entries() error = %v", err)
+	}
+	if len(entries) != 3 || entries[2].ExitCode != 2 {
+		t.Errorf("Entries() = %+v", entries)
+	}
+}
+
+func TestAppendTrims(t *testing.T) {
+	f := File{Path: filepath.Join(t.TempDir(), FileName), MaxSize: 1000}
+	for i := range 50 {
+		if err := f.Append(Entry{ExitCode: i}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	info, err := os.Stat(f.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size() > f.MaxSize {
+		t.Errorf("history size = %d, want <= %d", info.Size(), f.MaxSize)
+	}
+	entries, _ := f.Entries()
+	if len(entries) == 0 || entries[len(entries)-1].ExitCode != 49 {
+		t.Errorf("newest entry should be kept, got %+v", entries)
+	}
+}
+
+func TestEntriesMissingFile(t *testing.T) {
+	entries, err := File{Path: filepath.Join(t.TempDir(), FileName)}.Entries()
+	if err != nil || entries != nil {
+		t.Errorf("Entries() = %v, %v; want nil, nil", entries, err)
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	entries := []Entry{
+		{Time: start, DurationMs: 1000},
+		{Time: start.Add(time.Hour), DurationMs: 5000, ExitCode: 1, Restarts: 2},
+		{Time: start.Add(2 * time.Hour), DurationMs: 3000, Signal: "killed"},
+		{Time: start.Add(3 * time.Hour), DurationMs: 2000, ExitCode: -1, Stopped: true},
+		{Time: start.Add(4 * time.Hour), Exec: true},
+	}
+	s := Summarize(entries, 1)
+	if s.Launches != 5 || s.Execs != 1 || s.Failures != 2 || s.Restarts != 2 {
+		t.Errorf("Summarize() = %+v", s)
+	}
+	if s.MedianUptime != 2500*time.Millisecond {
+		t.Errorf("MedianUptime = %s, want 2.5s", s.MedianUptime)
+	}
+	if len(s.LastFailures) != 1 || s.LastFailures[0].Signal != "killed" {
+		t.Errorf("LastFailures = %+v, want the signalled launch", s.LastFailures)
+	}
+	if s.FailureRate() != 0.5 {
+		t.Errorf("FailureRate() = %v, want 0.5", s.FailureRate())
+	}
+
+	var b strings.Builder
+	if err := s.WriteText(&b); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"Launches:      5", "Exec'd:        1", "50.0%", "signal killed"} {
+		if !strings.Contains(b.String(), want) {
+			t.Errorf("WriteText() missing %q:\n%s", want, b.String())
+		}
+	}
+}
+
+func TestHashArgv(t *testing.T) {
+	a := HashArgv([]string{"java", "-jar", "a b"})
+	if a != HashArgv([]string{"java", "-jar", "a b"}) {
+		t.Error("HashArgv() is not stable")
+	}
+	if a == HashArgv([]string{"java", "-jar", "a", "b"}) {
+		t.Error("HashArgv() should distinguish argument boundaries")
+	}
+}
@@ -0,0 +1,98 @@
+package hooks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"gjg/internal/args"
+	"gjg/internal/runner"
+	"io"
+	"log/slog"
+	"os/exec"
+	"path/filepath"
+	"time"
+)
+
+// OnFailure selects what happens when a hook fails.
+type OnFailure string
+
+const (
+	// Abort stops running further hooks; a failed pre-launch hook also stops the launch.
+	Abort OnFailure = "abort"
+	// Continue logs the failure and carries on.
+	Continue OnFailure = "continue"
+)
+
+// ParseOnFailure validates an on_failure value.
+func ParseOnFailure(s string) (OnFailure, error) {
+	switch f := OnFailure(s); f {
+	case Abort, Continue:
+		return f, nil
+	}
+	return "", fmt.Errorf("invalid on_failure %q (expected abort or continue)", s)
+}
+
+// Options control how hook commands are run.
+type Options struct {
+	Env       []string
+	WorkDir   string
+	Timeout   time.Duration
+	OnFailure OnFailure
+	Stdout    io.Writer
+	Stderr    io.Writer
+}
+
+// Run executes each command line in order. Command lines are split with
+// args.Tokenize. An executable given as a relative path, such as
+// scripts/check.sh, is resolved against WorkDir; a bare name is looked up in
+// PATH.
+// With Abort, the first failure is returned and remaining hooks are skipped;
+// with Continue, failures are logged and Run returns nil.
+func Run(ctx context.Context, name string, commands []string, opts Options, log *slog.Logger) error {
+	for _, line := range commands {
+		err := runOne(ctx, line, opts)
+		if err == nil {
+			continue
+		}
+		err = fmt.Errorf("%s hook %q failed: %w", name, line, err)
+		if opts.OnFailure != Continue {
+			return err
+		}
+		log.Warn("Hook failed", "error", err)
+	}
+	return nil
+}
+
+func runOne(ctx context.Context, line string, opts Options) error {
+	argv := args.Tokenize(line)
+	if len(argv) == 0 {
+		return errors.New("empty command")
+	}
+
+	if opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.Timeout)
+		defer cancel()
+	}
+
+	name := argv[0]
+	if opts.WorkDir != "" && !filepath.IsAbs(name) && filepath.Base(name) != name {
+		name = filepath.Join(opts.WorkDir, name)
+	}
+	cmd := exec.CommandContext(ctx, name, argv[1:]...)
+	cmd.Env = opts.Env
+	cmd.Dir = opts.WorkDir
+	cmd.Stdout = opts.Stdout
+	cmd.Stderr = opts.Stderr
+	runner.Isolate(cmd)
+
+	err := cmd.Run()
+	if ctx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("timed out after %s", opts.Timeout)
+	}
+	if errors.Is(err, exec.ErrWaitDelay) {
+		// It succeeded, leaving a background command with its output
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,177 @@
+package hooks
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestHelperProcess stands in for hook commands.
+func TestHelperProcess(t *testing.T) {
+	if os.Getenv("GJG_TEST_HELPER") != "1" {
+		return
+	}
+	args := os.Args
+	for i, a := range args {
+		if a == "--" {
+			args = args[i+1:]
+			break
+		}
+	}
+	switch args[0] {
+	case "fail":
+		os.Exit(2)
+	case "sleep":
+		time.Sleep(time.Minute)
+	case "nap":
+		time.Sleep(5 * time.Second)
+	case "spawn":
+		// Leave a sleeping child holding the hook's output, then hang
+		child := exec.Command(os.Args[0], "-test.run=TestHelperProcess", "--", "nap")
+		child.Stdout, child.Stderr = os.Stdout, os.Stderr
+		if err := child.Start(); err != nil {
+			os.Exit(3)
+		}
+		if len(args) > 1 && args[1] == "exit" {
+			os.Exit(0)
+		}
+		time.Sleep(time.Minute)
+	case "pwd":
+		wd, _ := os.Getwd()
+		fmt.Println(wd)
+	case "echo":
+		fmt.Println(strings.Join(args[1:], " "))
+	}
+	os.Exit(0)
+}
+
+// helper returns the command line running TestHelperProcess with args.
+func helper(exe string, args ...string) string {
+	return "'" + exe + "' -test.run=TestHelperProcess -- " + strings.Join(args, " ")
+}
+
+func options(out io.Writer) Options {
+	return Options{
+		Env:       append(os.Environ(), "GJG_TEST_HELPER=1"),
+		OnFailure: Abort,
+		Timeout:   time.Minute,
+		Stdout:    out,
+		Stderr:    out,
+	}
+}
+
+func TestRunOnFailure(t *testing.T) {
+	commands := []string{helper(os.Args[0], "fail"), helper(os.Args[0], "echo", "second")}
+	tests := []struct {
+		onFailure  OnFailure
+		wantErr    bool
+		wantSecond bool
+	}{
+		{Abort, true, false},
+		{Continue, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.onFailure), func(t *testing.T) {
+			var out, logs bytes.Buffer
+			opts := options(&out)
+			opts.OnFailure = tt.onFailure
+			err := Run(context.Background(), "pre-launch", commands, opts, slog.New(slog.NewTextHandler(&logs, nil)))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Run() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got := strings.Contains(out.String(), "second"); got != tt.wantSecond {
+				t.Errorf("second hook ran = %v, want %v", got, tt.wantSecond)
+			}
+			if warned := strings.Contains(logs.String(), "Hook failed"); warned != !tt.wantErr {
+				t.Errorf("logs = %q, want a warning only when the launch goes on", logs.String())
+			}
+		})
+	}
+}
+
+func TestRunTimeout(t *testing.T) {
+	opts := options(io.Discard)
+	opts.Timeout = 200 * time.Millisecond
+	started := time.Now()
+	err := Run(context.Background(), "pre-launch", []string{helper(os.Args[0], "sleep")}, opts, slog.New(slog.DiscardHandler))
+	if err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Errorf("Run() error = %v, want a timeout", err)
+	}
+	if took := time.Since(started); took > 30*time.Second {
+		t.Errorf("Run() took %s, want the hook killed", took)
+	}
+}
+
+func TestRunBackgroundChild(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		timeout time.Duration
+		wantErr string
+		// Unix kills the child with the hook; elsewhere the output is waited for
+		// two seconds at most.
+		maxTook time.Duration
+	}{
+		{"timed out", []string{"spawn"}, 200 * time.Millisecond, "timed out", time.Second},
+		{"exited", []string{"spawn", "exit"}, time.Minute, "", 3 * time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			opts := options(&out)
+			opts.Timeout = tt.timeout
+			started := time.Now()
+			err := Run(context.Background(), "pre-launch", []string{helper(os.Args[0], tt.args...)}, opts, slog.New(slog.DiscardHandler))
+			if tt.wantErr == "" && err != nil || tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("Run() error = %v, want %q", err, tt.wantErr)
+			}
+			maxTook := tt.maxTook
+			if runtime.GOOS == "windows" {
+				maxTook = 3 * time.Second
+			}
+			if took := time.Since(started); took > maxTook {
+				t.Errorf("Run() took %s, want at most %s", took, maxTook)
+			}
+		})
+	}
+}
+
+func TestRunWorkDir(t *testing.T) {
+	work := t.TempDir()
+	name := "hook"
+	if runtime.GOOS == "windows" {
+		name += ".exe"
+	}
+	// A copy of the test binary stands in for a script shipped with the app
+	data, err := os.ReadFile(os.Args[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(work, "bin"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(work, "bin", name), data, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	opts := options(&out)
+	opts.WorkDir = work
+	if err := Run(context.Background(), "pre-launch", []string{helper("bin/"+name, "pwd")}, opts, slog.New(slog.DiscardHandler)); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	got, _ := filepath.EvalSymlinks(strings.TrimSpace(out.String()))
+	want, _ := filepath.EvalSymlinks(work)
+	if got != want {
+		t.Errorf("hook ran in %q, want %q", got, want)
+	}
+}
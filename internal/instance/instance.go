@@ -0,0 +1,238 @@
+package instance
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gjg/internal/lockfile"
+	"gjg/internal/paths"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Scope selects whether instances are unique per user or per machine.
+type Scope string
+
+const (
+	ScopeOff     Scope = "off"
+	ScopeUser    Scope = "user"
+	ScopeMachine Scope = "machine"
+)
+
+// Policy selects what a second launch does when an instance is already running.
+type Policy string
+
+const (
+	// PolicyExit prints a message and exits.
+	PolicyExit Policy = "exit"
+	// PolicyForward hands the arguments to the running instance and exits.
+	PolicyForward Policy = "forward"
+	// PolicyReplace stops the running instance and takes its place.
+	PolicyReplace Policy = "replace"
+)
+
+// ParseScope validates a single_instance value.
+func ParseScope(s string) (Scope, error) {
+	switch sc := Scope(s); sc {
+	case ScopeOff, ScopeUser, ScopeMachine:
+		return sc, nil
+	}
+	return "", fmt.Errorf("invalid single_instance %q (expected off, user or machine)", s)
+}
+
+// ParsePolicy validates a single_instance_policy value.
+func ParsePolicy(s string) (Policy, error) {
+	switch p := Policy(s); p {
+	case PolicyExit, PolicyForward, PolicyReplace:
+		return p, nil
+	}
+	return "", fmt.Errorf("invalid single_instance_policy %q (expected exit, forward or replace)", s)
+}
+
+// ErrAlreadyRunning is returned by Acquire when another instance holds the lock.
+var ErrAlreadyRunning = errors.New("another instance is already running")
+
+// Dir returns the directory holding the lock file and socket for app.
+// User scope lives under the per-user cache directory, machine scope in a
+// directory shared by all users (see paths.MachineDir).
+func Dir(scope Scope, app, userCacheDir string) string {
+	if scope == ScopeMachine {
+		return paths.MachineDir(app)
+	}
+	return filepath.Join(userCacheDir, "instance")
+}
+
+// Message is sent by a second launch to the running instance.
+type Message struct {
+	Action  Policy   `json:"action"`
+	Args    []string `json:"args,omitempty"`
+	WorkDir string   `json:"workDir,omitempty"`
+}
+
+type reply struct {
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+}
+
+// Instance is the running (primary) instance. It holds the lock and serves
+// requests from later launches over a local socket.
+type Instance struct {
+	dir      string
+	scope    Scope
+	lock     *lockfile.Lock
+	listener net.Listener
+}
+
+// Acquire takes the instance lock in dir, returning ErrAlreadyRunning when it
+// is held. In machine scope the directory, lock file and socket are made
+// usable by every user.
+func Acquire(dir string, scope Scope) (*Instance, error) {
+	path, err := lockPath(dir, scope)
+	if err != nil {
+		return nil, err
+	}
+	l, err := lockfile.TryAcquire(path)
+	if errors.Is(err, lockfile.ErrLocked) {
+		return nil, ErrAlreadyRunning
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &Instance{dir: dir, scope: scope, lock: l}, nil
+}
+
+// AcquireWait waits for the instance lock, e.g. while a replaced instance shuts down.
+func AcquireWait(ctx context.Context, dir string, scope Scope) (*Instance, error) {
+	path, err := lockPath(dir, scope)
+	if err != nil {
+		return nil, err
+	}
+	l, err := lockfile.Acquire(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	return &Instance{dir: dir, scope: scope, lock: l}, nil
+}
+
+// lockPath returns the lock file in dir, first sharing both in machine scope.
+func lockPath(dir string, scope Scope) (string, error) {
+	path := filepath.Join(dir, "instance.lock")
+	if scope != ScopeMachine {
+		return path, nil
+	}
+	if err := shareDir(dir); err != nil {
+		return "", fmt.Errorf("failed to create shared directory %s: %w", dir, err)
+	}
+	if err := shareFile(path); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+func socketPath(dir string) string {
+	return filepath.Join(dir, "instance.sock")
+}
+
+// Serve listens for messages from later launches and passes them to handle
+// until Close is called. Unix domain sockets are also available on Windows 10+.
+func (in *Instance) Serve(handle func(Message) error) error {
+	path := socketPath(in.dir)
+	// We hold the lock, so any existing socket is stale
+	_ = os.Remove(path)
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", path, err)
+	}
+	in.listener = ln
+	if in.scope == ScopeMachine {
+		// Later launches of other users connect too
+		if err := shareSocket(path); err != nil {
+			ln.Close()
+			return err
+		}
+	}
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go serveConn(conn, handle)
+		}
+	}()
+	return nil
+}
+
+func serveConn(conn net.Conn, handle func(Message) error) {
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(10 * time.Second))
+
+	var msg Message
+	if err := json.NewDecoder(bufio.NewReader(conn)).Decode(&msg); err != nil {
+		return
+	}
+	r := reply{OK: true}
+	if err := handle(msg); err != nil {
+		r = reply{Error: err.Error()}
+	}
+	_ = json.NewEncoder(conn).Encode(r)
+}
+
+// Close stops serving and releases the lock.
+func (in *Instance) Close() error {
+	if in.listener != nil {
+		_ = in.listener.Close()
+		_ = os.Remove(socketPath(in.dir))
+	}
+	return in.lock.Release()
+}
+
+// Send delivers msg to the instance running in dir and waits for its reply.
+func Send(dir string, msg Message, timeout time.Duration) error {
+	conn, err := net.DialTimeout("unix", socketPath(dir), timeout)
+	if err != nil {
+		return fmt.Errorf("failed to contact running instance: %w", err)
+	}
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(timeout))
+
+	if err := json.NewEncoder(conn).Encode(msg); err != nil {
+		return fmt.Errorf("failed to send to running instance: %w", err)
+	}
+	var r reply
+	if err := json.NewDecoder(conn).Decode(&r); err != nil {
+		return fmt.Errorf("no reply from running instance: %w", err)
+	}
+	if !r.OK {
+		return fmt.Errorf("running instance refused request: %s", r.Error)
+	}
+	return nil
+}
+
+// AppendInbox records forwarded arguments as one JSON line in path, where the
+// application can pick them up.
+func AppendInbox(path string, msg Message) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	line, err := json.Marshal(struct {
+		Time    time.Time `json:"time"`
+		Args    []string  `json:"args"`
+		WorkDir string    `json:"workDir,omitempty"`
+	}{time.Now(), msg.Args, msg.WorkDir})
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = f.Write(append(line, '\n'))
+	return err
+}
@@ -0,0 +1,144 @@
+package instance
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAcquireAndSend(t *testing.T) {
+	dir := t.TempDir()
+
+	primary, err := Acquire(dir, ScopeUser)
+	if err != nil {
+		t.Fatalf("Acquire() error = %v", err)
+	}
+	defer primary.Close()
+
+	if _, err := Acquire(dir, ScopeUser); !errors.Is(err, ErrAlreadyRunning) {
+		t.Fatalf("second Acquire() error = %v, want ErrAlreadyRunning", err)
+	}
+
+	received := make(chan Message, 1)
+	if err := primary.Serve(func(msg Message) error {
+		received <- msg
+		return nil
+	}); err != nil {
+		t.Fatalf("Serve() error = %v", err)
+	}
+
+	want := Message{Action: PolicyForward, Args: []string{"--open", "file with spaces.txt"}, WorkDir: "/tmp"}
+	if err := Send(dir, want, time.Second); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	if got := <-received; !reflect.DeepEqual(got, want) {
+		t.Errorf("received %+v, want %+v", got, want)
+	}
+
+	if err := primary.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	again, err := Acquire(dir, ScopeUser)
+	if err != nil {
+		t.Fatalf("Acquire() after Close error = %v", err)
+	}
+	again.Close()
+}
+
+func TestAcquireMachineShared(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("access lists are checked by hand on Windows")
+	}
+	dir := filepath.Join(t.TempDir(), "gjg-app")
+	primary, err := Acquire(dir, ScopeMachine)
+	if err != nil {
+		t.Fatalf("Acquire() error = %v", err)
+	}
+	defer primary.Close()
+	if err := primary.Serve(func(Message) error { return nil }); err != nil {
+		t.Fatalf("Serve() error = %v", err)
+	}
+
+	// Other users must be able to open the lock and connect to the socket
+	want := map[string]fs.FileMode{
+		dir:                                 0777 | fs.ModeSticky,
+		filepath.Join(dir, "instance.lock"): 0666,
+		filepath.Join(dir, "instance.sock"): 0666,
+	}
+	for path, mode := range want {
+		fi, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := fi.Mode() & (fs.ModePerm | fs.ModeSticky); got != mode {
+			t.Errorf("%s mode = %v, want %v", filepath.Base(path), got, mode)
+		}
+	}
+}
+
+func TestAcquireMachineRefuses(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("access lists are checked by hand on Windows")
+	}
+	tests := []struct {
+		name    string
+		prepare func(dir string) error
+		wantErr string
+	}{
+		{
+			name: "not sticky",
+			prepare: func(dir string) error {
+				if err := os.Mkdir(dir, 0755); err != nil {
+					return err
+				}
+				return os.Chmod(dir, 0777)
+			},
+			wantErr: "without the sticky bit",
+		},
+		{
+			name: "symlink",
+			prepare: func(dir string) error {
+				return os.Symlink(t.TempDir(), dir)
+			},
+			wantErr: "not a directory",
+		},
+		{
+			name: "other user",
+			prepare: func(dir string) error {
+				if os.Getuid() != 0 {
+					t.Skip("only root can create a directory for another user")
+				}
+				if err := os.Mkdir(dir, 0755); err != nil {
+					return err
+				}
+				if err := os.Chmod(dir, 0777|fs.ModeSticky); err != nil {
+					return err
+				}
+				return os.Chown(dir, 12345, 12345)
+			},
+			wantErr: "owned by uid 12345",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := filepath.Join(t.TempDir(), "gjg-app")
+			if err := tt.prepare(dir); err != nil {
+				t.Fatal(err)
+			}
+			in, err := Acquire(dir, ScopeMachine)
+			if err == nil {
+				in.Close()
+				t.Fatalf("Acquire() succeeded, want %q", tt.wantErr)
+			}
+			if !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Acquire() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,64 @@
+//go:build unix
+
+package instance
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"syscall"
+)
+
+// shareDir creates dir world-writable with the sticky bit, like /tmp: every
+// user can add files, only their owner can remove them. An existing dir must
+// be owned by the current user or root: another user could have created it
+// to hold the lock or to receive the arguments of other users' launches.
+func shareDir(dir string) error {
+	if err := os.Mkdir(dir, 0755); err == nil {
+		if err := os.Chmod(dir, 0777|fs.ModeSticky); err != nil {
+			return err
+		}
+	} else if !errors.Is(err, fs.ErrExist) {
+		return err
+	}
+	fi, err := os.Lstat(dir)
+	if err != nil {
+		return err
+	}
+	if !fi.IsDir() {
+		return errors.New("not a directory")
+	}
+	if fi.Mode()&0022 == 0 {
+		return nil
+	}
+	if st, ok := fi.Sys().(*syscall.Stat_t); ok && st.Uid != 0 && int(st.Uid) != os.Getuid() {
+		return fmt.Errorf("owned by uid %d and writable by other users; remove it, or create it as root with mode 1777 to share it between users", st.Uid)
+	}
+	if fi.Mode()&fs.ModeSticky == 0 {
+		return errors.New("writable by other users without the sticky bit")
+	}
+	return nil
+}
+
+// shareFile creates path readable and writable by every user, unless it
+// exists already.
+func shareFile(path string) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_RDWR, 0666)
+	if errors.Is(err, fs.ErrExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	err = f.Chmod(0666)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// shareSocket lets every user connect to the socket at path.
+func shareSocket(path string) error {
+	return os.Chmod(path, 0666)
+}
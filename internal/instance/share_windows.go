@@ -0,0 +1,68 @@
+package instance
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"syscall"
+	"unsafe"
+)
+
+var (
+	advapi32                                = syscall.NewLazyDLL("advapi32.dll")
+	procConvertStringSecurityDescriptorToSD = advapi32.NewProc("ConvertStringSecurityDescriptorToSecurityDescriptorW")
+	procSetFileSecurity                     = advapi32.NewProc("SetFileSecurityW")
+)
+
+// sharedSDDL gives authenticated users, SYSTEM and administrators full
+// control of the directory and, by inheritance, of the files created in it.
+const sharedSDDL = "D:(A;OICI;GA;;;AU)(A;OICI;GA;;;SY)(A;OICI;GA;;;BA)"
+
+const (
+	sddlRevision1           = 1
+	daclSecurityInformation = 4
+)
+
+// shareDir creates dir with an access list that lets every user create,
+// open and remove the files in it. Files created under %ProgramData% are
+// otherwise read-only to other users.
+func shareDir(dir string) error {
+	if err := os.MkdirAll(filepath.Dir(dir), 0755); err != nil {
+		return err
+	}
+	if err := os.Mkdir(dir, 0755); err != nil {
+		if errors.Is(err, fs.ErrExist) {
+			return nil
+		}
+		return err
+	}
+	sddl, err := syscall.UTF16PtrFromString(sharedSDDL)
+	if err != nil {
+		return err
+	}
+	var sd uintptr
+	if r, _, err := procConvertStringSecurityDescriptorToSD.Call(uintptr(unsafe.Pointer(sddl)), sddlRevision1, uintptr(unsafe.Pointer(&sd)), 0); r == 0 {
+		return fmt.Errorf("invalid security descriptor: %w", err)
+	}
+	defer syscall.LocalFree(syscall.Handle(sd))
+	p, err := syscall.UTF16PtrFromString(dir)
+	if err != nil {
+		return err
+	}
+	if r, _, err := procSetFileSecurity.Call(uintptr(unsafe.Pointer(p)), daclSecurityInformation, sd); r == 0 {
+		return fmt.Errorf("failed to share %s: %w", dir, err)
+	}
+	return nil
+}
+
+// shareFile does nothing: files inherit the access list of shareDir.
+func shareFile(path string) error {
+	return nil
+}
+
+// shareSocket does nothing: the socket inherits the access list of shareDir.
+func shareSocket(path string) error {
+	return nil
+}
@@ -0,0 +1,290 @@
+package jnlp
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gjg/internal/fsutil"
+	"gjg/internal/lockfile"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Cache keeps downloaded descriptors and jars. Each file is revalidated with
+// a conditional request on every fetch, and the cached copy is used when the
+// server cannot be reached. Jars no resolved descriptor lists any more are
+// removed.
+type Cache struct {
+	Dir    string
+	Client *http.Client
+}
+
+// entry is the validator metadata stored next to a cached file.
+type entry struct {
+	URL          string `json:"url"`
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"lastModified,omitempty"`
+	// Descriptor marks the record of a resolved descriptor, local or
+	// downloaded, and Jars lists the URLs of its jars.
+	Descriptor bool     `json:"descriptor,omitempty"`
+	Jars       []string `json:"jars,omitempty"`
+}
+
+// lockName is the lock file serializing the launches sharing a cache.
+const lockName = ".lock"
+
+// Fetch returns a local path holding the resource at rawURL. file: URLs are
+// used in place. stale is set when the server could not be reached and an
+// earlier copy is returned.
+func (c Cache) Fetch(ctx context.Context, rawURL string) (file string, stale bool, err error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", false, err
+	}
+	switch u.Scheme {
+	case "file":
+		p := fsutil.FromURL(u)
+		if _, err := os.Stat(p); err != nil {
+			return "", false, err
+		}
+		return p, false, nil
+	case "http", "https":
+	default:
+		return "", false, fmt.Errorf("unsupported URL %s", rawURL)
+	}
+
+	file = c.path(rawURL)
+	var cached entry
+	if data, err := os.ReadFile(file + ".json"); err == nil {
+		json.Unmarshal(data, &cached)
+	}
+	_, statErr := os.Stat(file)
+	hasCopy := statErr == nil && cached.URL == rawURL
+
+	err = c.download(ctx, rawURL, file, cached, hasCopy)
+	if err != nil && hasCopy && ctx.Err() == nil {
+		return file, true, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	return file, false, nil
+}
+
+// download fetches rawURL into file unless the server says the cached copy
+// is current.
+func (c Cache) download(ctx context.Context, rawURL, file string, cached entry, hasCopy bool) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return err
+	}
+	if hasCopy {
+		if cached.ETag != "" {
+			req.Header.Set("If-None-Match", cached.ETag)
+		}
+		if cached.LastModified != "" {
+			req.Header.Set("If-Modified-Since", cached.LastModified)
+		}
+	}
+	client := c.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusNotModified && hasCopy:
+		return nil
+	case resp.StatusCode != http.StatusOK:
+		return fmt.Errorf("%s: %s", rawURL, resp.Status)
+	}
+
+	if err := os.MkdirAll(c.Dir, 0755); err != nil {
+		return err
+	}
+	part := file + ".part"
+	f, err := os.Create(part)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(f, resp.Body)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(part, file)
+	}
+	if err != nil {
+		os.Remove(part)
+		return err
+	}
+	e := entry{URL: rawURL, ETag: resp.Header.Get("ETag"), LastModified: resp.Header.Get("Last-Modified")}
+	if cached.URL == rawURL {
+		// A descriptor keeps its jars until it is resolved again
+		e.Descriptor, e.Jars = cached.Descriptor, cached.Jars
+	}
+	meta, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	return fsutil.WriteFile(file+".json", meta, 0644)
+}
+
+// App is a JNLP application ready to launch from the cache.
+type App struct {
+	*Launch
+	// Classpath holds the local paths of Launch.Jars.
+	Classpath []string
+	// Offline is set when some files could not be revalidated and earlier
+	// copies are used.
+	Offline bool
+}
+
+// Resolve reads the descriptor at src, a URL or a local path, and fetches
+// its jars. A missing main-class is taken from the main jar's manifest.
+// Launches sharing the cache resolve one at a time.
+func (c Cache) Resolve(ctx context.Context, src string) (*App, error) {
+	lock, err := lockfile.Acquire(ctx, filepath.Join(c.Dir, lockName))
+	if err != nil {
+		return nil, err
+	}
+	defer lock.Release()
+
+	srcURL, err := url.Parse(src)
+	if err != nil || (srcURL.Scheme != "http" && srcURL.Scheme != "https" && srcURL.Scheme != "file") {
+		abs, err := filepath.Abs(src)
+		if err != nil {
+			return nil, err
+		}
+		srcURL = fsutil.ToURL(abs)
+	}
+	file, offline, err := c.Fetch(ctx, srcURL.String())
+	if err != nil {
+		return nil, fmt.Errorf("JNLP file: %w", err)
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	d, err := Parse(data)
+	if err != nil {
+		return nil, err
+	}
+	l, err := d.Launch(srcURL)
+	if err != nil {
+		return nil, err
+	}
+
+	app := &App{Launch: l, Offline: offline}
+	var mainJar string
+	for _, jar := range l.Jars {
+		p, stale, err := c.Fetch(ctx, jar)
+		if err != nil {
+			return nil, fmt.Errorf("JNLP jar: %w", err)
+		}
+		app.Offline = app.Offline || stale
+		app.Classpath = append(app.Classpath, p)
+		if jar == l.MainJar {
+			mainJar = p
+		}
+	}
+	if l.MainClass == "" {
+		if l.MainClass, err = ManifestMainClass(mainJar); err != nil {
+			return nil, fmt.Errorf("main jar %s: %w", l.MainJar, err)
+		}
+		if l.MainClass == "" {
+			return nil, fmt.Errorf("JNLP file has no main-class and %s has no Main-Class", l.MainJar)
+		}
+	}
+	if err := c.record(srcURL.String(), l.Jars); err != nil {
+		return nil, err
+	}
+	c.prune()
+	return app, nil
+}
+
+// record notes the jars of the descriptor at src so that prune keeps them.
+func (c Cache) record(src string, jars []string) error {
+	meta := c.path(src) + ".json"
+	var e entry
+	if data, err := os.ReadFile(meta); err == nil {
+		json.Unmarshal(data, &e)
+	}
+	e.URL, e.Descriptor, e.Jars = src, true, jars
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	return fsutil.WriteFile(meta, data, 0644)
+}
+
+// prune removes the cached jars that no recorded descriptor lists, the
+// records of local descriptors that are gone, and interrupted downloads.
+// Files it cannot remove, e.g. jars a running app holds open on Windows,
+// are left for a later launch.
+func (c Cache) prune() {
+	entries, err := os.ReadDir(c.Dir)
+	if err != nil {
+		return
+	}
+	keep := make(map[string]bool)
+	var jars []string
+	for _, de := range entries {
+		name := de.Name()
+		if strings.HasSuffix(name, ".part") {
+			os.Remove(filepath.Join(c.Dir, name))
+			continue
+		}
+		if !strings.HasSuffix(name, ".json") {
+			continue
+		}
+		meta := filepath.Join(c.Dir, name)
+		data, err := os.ReadFile(meta)
+		var e entry
+		if err != nil || json.Unmarshal(data, &e) != nil {
+			continue
+		}
+		if !e.Descriptor {
+			jars = append(jars, strings.TrimSuffix(meta, ".json"))
+			continue
+		}
+		if u, err := url.Parse(e.URL); err == nil && u.Scheme == "file" {
+			if _, err := os.Stat(fsutil.FromURL(u)); errors.Is(err, fs.ErrNotExist) {
+				os.Remove(meta)
+				continue
+			}
+		}
+		for _, jar := range e.Jars {
+			keep[c.path(jar)] = true
+		}
+	}
+	for _, jar := range jars {
+		if !keep[jar] {
+			os.Remove(jar)
+			os.Remove(jar + ".json")
+		}
+	}
+}
+
+// path is where the resource at rawURL is cached: a hash of the URL keeps
+// equally named jars of different apps apart, the name keeps it readable.
+func (c Cache) path(rawURL string) string {
+	h := sha256.Sum256([]byte(rawURL))
+	name := "resource"
+	if u, err := url.Parse(rawURL); err == nil && path.Base(u.Path) != "/" && path.Base(u.Path) != "." {
+		name = path.Base(u.Path)
+	}
+	return filepath.Join(c.Dir, hex.EncodeToString(h[:8])+"-"+name)
+}
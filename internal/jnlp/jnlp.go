@@ -0,0 +1,244 @@
+// Package jnlp reads Java Web Start descriptors, so that apps distributed as
+// .jnlp files can be launched with a plain classpath and main class.
+package jnlp
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/url"
+	"runtime"
+	"slices"
+	"strings"
+)
+
+// Descriptor is the subset of a JNLP file the launcher understands.
+type Descriptor struct {
+	Codebase    string       `xml:"codebase,attr"`
+	Href        string       `xml:"href,attr"`
+	Resources   []Resources  `xml:"resources"`
+	Application *Application `xml:"application-desc"`
+	Applet      *struct{}    `xml:"applet-desc"`
+	Installer   *struct{}    `xml:"installer-desc"`
+	Component   *struct{}    `xml:"component-desc"`
+	JavaFX      *struct{}    `xml:"javafx-desc"`
+	Security    *struct{}    `xml:"security"`
+}
+
+// Resources is one <resources> element, optionally limited to some
+// platforms.
+type Resources struct {
+	OS         string      `xml:"os,attr"`
+	Arch       string      `xml:"arch,attr"`
+	Java       []Java      `xml:"java"`
+	J2SE       []Java      `xml:"j2se"`
+	Jars       []Jar       `xml:"jar"`
+	Properties []Property  `xml:"property"`
+	NativeLibs []Reference `xml:"nativelib"`
+	Extensions []Reference `xml:"extension"`
+}
+
+// Java is a <java> or <j2se> element: the Java version and JVM options.
+type Java struct {
+	Version         string `xml:"version,attr"`
+	JavaVMArgs      string `xml:"java-vm-args,attr"`
+	InitialHeapSize string `xml:"initial-heap-size,attr"`
+	MaxHeapSize     string `xml:"max-heap-size,attr"`
+}
+
+// Jar is a classpath entry.
+type Jar struct {
+	Href string `xml:"href,attr"`
+	Main bool   `xml:"main,attr"`
+}
+
+// Property is a system property set with -D.
+type Property struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value,attr"`
+}
+
+// Reference is an element that only points to another resource.
+type Reference struct {
+	Href string `xml:"href,attr"`
+}
+
+// Application is the <application-desc> element.
+type Application struct {
+	MainClass string   `xml:"main-class,attr"`
+	Arguments []string `xml:"argument"`
+}
+
+// Launch is what a descriptor asks for on this platform, with resource URLs
+// resolved against the codebase.
+type Launch struct {
+	// Jars are the classpath URLs; MainJar is the one holding the main
+	// class, and is also in Jars.
+	Jars    []string
+	MainJar string
+	// MainClass may be empty when the main jar's manifest names it.
+	MainClass   string
+	Args        []string
+	JVMArgs     []string
+	JavaVersion string
+	// Unsupported lists the features of the descriptor that are ignored.
+	Unsupported []string
+}
+
+// Parse decodes a JNLP document.
+func Parse(data []byte) (*Descriptor, error) {
+	var d Descriptor
+	if err := xml.Unmarshal(data, &d); err != nil {
+		return nil, fmt.Errorf("invalid JNLP file: %w", err)
+	}
+	return &d, nil
+}
+
+// Launch resolves the descriptor for this platform. src is where it was
+// read from; relative URLs use the codebase, or src without one. Features
+// the launcher cannot run at all are errors; ignored ones are listed in
+// Launch.Unsupported.
+func (d *Descriptor) Launch(src *url.URL) (*Launch, error) {
+	switch {
+	case d.Applet != nil:
+		return nil, errors.New("JNLP applets (applet-desc) are not supported")
+	case d.Installer != nil:
+		return nil, errors.New("JNLP installers (installer-desc) are not supported")
+	case d.Component != nil:
+		return nil, errors.New("JNLP component extensions (component-desc) are not supported; launch the application's JNLP file")
+	case d.JavaFX != nil:
+		return nil, errors.New("JavaFX descriptors (javafx-desc) are not supported")
+	case d.Application == nil:
+		return nil, errors.New("JNLP file has no application-desc")
+	}
+
+	base := src
+	if d.Codebase != "" {
+		cb, err := url.Parse(d.Codebase)
+		if err != nil {
+			return nil, fmt.Errorf("invalid JNLP codebase %q: %w", d.Codebase, err)
+		}
+		base = src.ResolveReference(cb)
+		if !strings.HasSuffix(base.Path, "/") {
+			// A codebase is a directory, even without the trailing slash
+			base.Path += "/"
+		}
+	}
+
+	l := &Launch{MainClass: d.Application.MainClass, Args: d.Application.Arguments}
+	javaSeen := false
+	for _, r := range d.Resources {
+		if !matches(r.OS, osNames()) || !matches(r.Arch, archNames()) {
+			continue
+		}
+		for _, j := range slices.Concat(r.Java, r.J2SE) {
+			// The first version listed is the preferred one
+			if javaSeen {
+				continue
+			}
+			javaSeen = true
+			l.JavaVersion = j.Version
+			l.JVMArgs = append(l.JVMArgs, strings.Fields(j.JavaVMArgs)...)
+			if j.InitialHeapSize != "" {
+				l.JVMArgs = append(l.JVMArgs, "-Xms"+j.InitialHeapSize)
+			}
+			if j.MaxHeapSize != "" {
+				l.JVMArgs = append(l.JVMArgs, "-Xmx"+j.MaxHeapSize)
+			}
+		}
+		for _, p := range r.Properties {
+			l.JVMArgs = append(l.JVMArgs, "-D"+p.Name+"="+p.Value)
+		}
+		for _, j := range r.Jars {
+			u, err := base.Parse(j.Href)
+			if err != nil {
+				return nil, fmt.Errorf("invalid jar href %q: %w", j.Href, err)
+			}
+			l.Jars = append(l.Jars, u.String())
+			if j.Main && l.MainJar == "" {
+				l.MainJar = u.String()
+			}
+		}
+		for _, n := range r.NativeLibs {
+			l.Unsupported = append(l.Unsupported, "native libraries (nativelib "+n.Href+")")
+		}
+		for _, e := range r.Extensions {
+			l.Unsupported = append(l.Unsupported, "extensions (extension "+e.Href+")")
+		}
+	}
+	if len(l.Jars) == 0 {
+		return nil, errors.New("JNLP file lists no jars for this platform")
+	}
+	if l.MainJar == "" {
+		l.MainJar = l.Jars[0]
+	}
+	if d.Security != nil {
+		l.Unsupported = append(l.Unsupported, "security (jar signatures are not checked and the app runs with full permissions)")
+	}
+	return l, nil
+}
+
+// matches reports whether a space-separated os or arch attribute applies
+// to this platform. Values are prefixes, as in "Windows" or "Mac OS X".
+func matches(attr string, names []string) bool {
+	if strings.TrimSpace(attr) == "" {
+		return true
+	}
+	for _, v := range strings.Fields(attr) {
+		for _, n := range names {
+			if strings.HasPrefix(strings.ToLower(n), strings.ToLower(v)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// osNames returns the os.name values Java reports on this platform.
+func osNames() []string {
+	switch runtime.GOOS {
+	case "windows":
+		return []string{"Windows"}
+	case "darwin":
+		return []string{"Mac OS X"}
+	case "linux":
+		return []string{"Linux"}
+	}
+	return []string{runtime.GOOS}
+}
+
+// archNames returns the os.arch values Java reports on this platform.
+func archNames() []string {
+	switch runtime.GOARCH {
+	case "amd64":
+		return []string{"amd64", "x86_64"}
+	case "386":
+		return []string{"x86", "i386"}
+	case "arm64":
+		return []string{"aarch64", "arm64"}
+	}
+	return []string{runtime.GOARCH}
+}
+
+// ManifestMainClass returns the Main-Class of a jar's manifest, or "".
+func ManifestMainClass(jar string) (string, error) {
+	r, err := zip.OpenReader(jar)
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+	f, err := r.Open("META-INF/MANIFEST.MF")
+	if err != nil {
+		return "", nil
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		if v, ok := strings.CutPrefix(sc.Text(), "Main-Class:"); ok {
+			return strings.TrimSpace(v), nil
+		}
+	}
+	return "", sc.Err()
+}
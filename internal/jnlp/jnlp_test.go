@@ -0,0 +1,228 @@
+package jnlp
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+const descriptor = `<?xml version="1.0" encoding="utf-8"?>
+<jnlp spec="1.0+" codebase="%s" href="app.jnlp">
+  <information><title>App</title><offline-allowed/></information>
+  <resources>
+    <j2se version="1.8+" java-vm-args="-Xss2m" initial-heap-size="64m" max-heap-size="512m"/>
+    <jar href="lib/app.jar" main="true"/>
+    <jar href="lib/dep.jar"/>
+    <property name="app.mode" value="prod"/>
+  </resources>
+  <resources os="NoSuchOS">
+    <jar href="lib/other.jar"/>
+  </resources>
+  <application-desc>
+    <argument>--server</argument>
+    <argument>a b</argument>
+  </application-desc>
+</jnlp>`
+
+func mustParseURL(t *testing.T, s string) *url.URL {
+	t.Helper()
+	u, err := url.Parse(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u
+}
+
+func jarWithMain(t *testing.T, mainClass string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	w, _ := zw.Create("META-INF/MANIFEST.MF")
+	w.Write([]byte("Manifest-Version: 1.0\r\nMain-Class: " + mainClass + "\r\n"))
+	zw.Close()
+	return buf.Bytes()
+}
+
+func TestLaunch(t *testing.T) {
+	d, err := Parse([]byte(strings.Replace(descriptor, "%s", "https://apps.example.com/app", 1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, err := d.Launch(mustParseURL(t, "https://apps.example.com/start/app.jnlp"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantJars := []string{"https://apps.example.com/app/lib/app.jar", "https://apps.example.com/app/lib/dep.jar"}
+	if !slices.Equal(l.Jars, wantJars) || l.MainJar != wantJars[0] {
+		t.Errorf("jars = %q (main %q), want %q", l.Jars, l.MainJar, wantJars)
+	}
+	if want := []string{"-Xss2m", "-Xms64m", "-Xmx512m", "-Dapp.mode=prod"}; !slices.Equal(l.JVMArgs, want) {
+		t.Errorf("JVMArgs = %q, want %q", l.JVMArgs, want)
+	}
+	if want := []string{"--server", "a b"}; !slices.Equal(l.Args, want) {
+		t.Errorf("Args = %q, want %q", l.Args, want)
+	}
+	if l.JavaVersion != "1.8+" || l.MainClass != "" || len(l.Unsupported) != 0 {
+		t.Errorf("Launch() = %+v", l)
+	}
+}
+
+func TestLaunchUnsupported(t *testing.T) {
+	tests := []struct {
+		name        string
+		body        string
+		wantErr     string
+		unsupported int
+	}{
+		{"applet", `<applet-desc main-class="A" name="a" width="1" height="1"/>`, "applet-desc", 0},
+		{"installer", `<installer-desc/>`, "installer-desc", 0},
+		{"no application", ``, "no application-desc", 0},
+		{"native libs and security", `<security><all-permissions/></security>
+			<resources><nativelib href="native.jar"/></resources>
+			<application-desc main-class="A"/>`, "", 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, err := Parse([]byte(`<jnlp><resources><jar href="a.jar"/></resources>` + tt.body + `</jnlp>`))
+			if err != nil {
+				t.Fatal(err)
+			}
+			l, err := d.Launch(mustParseURL(t, "https://example.com/a.jnlp"))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("Launch() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(l.Unsupported) != tt.unsupported {
+				t.Errorf("Unsupported = %q, want %d entries", l.Unsupported, tt.unsupported)
+			}
+		})
+	}
+}
+
+func TestResolve(t *testing.T) {
+	var jarHits, notModified atomic.Int32
+	var down atomic.Bool
+	jar := jarWithMain(t, "com.example.Main")
+	mux := http.NewServeMux()
+	mux.HandleFunc("/app/app.jnlp", func(w http.ResponseWriter, r *http.Request) {
+		if down.Load() {
+			http.Error(w, "down", http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(strings.Replace(descriptor, "%s", "http://"+r.Host+"/app/", 1)))
+	})
+	mux.HandleFunc("/app/lib/", func(w http.ResponseWriter, r *http.Request) {
+		if down.Load() {
+			http.Error(w, "down", http.StatusServiceUnavailable)
+			return
+		}
+		jarHits.Add(1)
+		w.Header().Set("ETag", `"v1"`)
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			notModified.Add(1)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Write(jar)
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+	c := Cache{Dir: t.TempDir()}
+
+	app, err := c.Resolve(context.Background(), srv.URL+"/app/app.jnlp")
+	if err != nil {
+		t.Fatalf("Resolve() error = %v", err)
+	}
+	if app.MainClass != "com.example.Main" || len(app.Classpath) != 2 || app.Offline {
+		t.Fatalf("Resolve() = %+v, want main class from the manifest and two jars", app)
+	}
+	for _, p := range app.Classpath {
+		if !strings.HasPrefix(p, c.Dir) {
+			t.Errorf("classpath entry %q not in the cache", p)
+		}
+	}
+
+	if _, err := c.Resolve(context.Background(), srv.URL+"/app/app.jnlp"); err != nil {
+		t.Fatal(err)
+	}
+	if jarHits.Load() != 4 || notModified.Load() != 2 {
+		t.Errorf("jar requests = %d (%d not modified), want 4 with the second two conditional", jarHits.Load(), notModified.Load())
+	}
+
+	down.Store(true)
+	app, err = c.Resolve(context.Background(), srv.URL+"/app/app.jnlp")
+	if err != nil || !app.Offline {
+		t.Errorf("Resolve() with the server down = %+v, %v; want cached files", app, err)
+	}
+}
+
+func TestResolvePrunes(t *testing.T) {
+	var updated atomic.Bool
+	jar := jarWithMain(t, "com.example.Main")
+	mux := http.NewServeMux()
+	mux.HandleFunc("/app/app.jnlp", func(w http.ResponseWriter, r *http.Request) {
+		d := strings.Replace(descriptor, "%s", "http://"+r.Host+"/app/", 1)
+		if updated.Load() {
+			d = strings.Replace(d, "lib/dep.jar", "lib/dep-2.jar", 1)
+		}
+		w.Write([]byte(d))
+	})
+	mux.HandleFunc("/app/lib/", func(w http.ResponseWriter, r *http.Request) {
+		w.Write(jar)
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+	c := Cache{Dir: t.TempDir()}
+
+	old, err := c.Resolve(context.Background(), srv.URL+"/app/app.jnlp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	updated.Store(true)
+	app, err := c.Resolve(context.Background(), srv.URL+"/app/app.jnlp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range app.Classpath {
+		if _, err := os.Stat(p); err != nil {
+			t.Errorf("listed jar removed: %v", err)
+		}
+	}
+	if _, err := os.Stat(old.Classpath[1]); !os.IsNotExist(err) {
+		t.Errorf("jar no longer listed kept in the cache: %v", err)
+	}
+	if _, err := os.Stat(old.Classpath[0]); err != nil {
+		t.Errorf("jar still listed removed: %v", err)
+	}
+}
+
+func TestResolveLocalFile(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "lib"), 0755)
+	os.WriteFile(filepath.Join(dir, "lib", "app.jar"), jarWithMain(t, "Main"), 0644)
+	os.WriteFile(filepath.Join(dir, "lib", "dep.jar"), nil, 0644)
+	jnlpFile := filepath.Join(dir, "app.jnlp")
+	os.WriteFile(jnlpFile, []byte(strings.Replace(descriptor, ` codebase="%s"`, "", 1)), 0644)
+
+	app, err := Cache{Dir: t.TempDir()}.Resolve(context.Background(), jnlpFile)
+	if err != nil {
+		t.Fatalf("Resolve() error = %v", err)
+	}
+	if want := filepath.Join(dir, "lib", "app.jar"); app.Classpath[0] != want {
+		t.Errorf("classpath = %q, want local jars used in place", app.Classpath)
+	}
+}
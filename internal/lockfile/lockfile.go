@@ -0,0 +1,85 @@
+package lockfile
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ErrLocked is returned by TryAcquire when another process holds the lock.
+var ErrLocked = errors.New("lock is held by another process")
+
+// Lock is an exclusive, process-wide file lock. The operating system releases
+// it when the holding process exits, so crashed holders never leave stale locks.
+type Lock struct {
+	path string
+	f    *os.File
+}
+
+// TryAcquire takes the lock at path without waiting.
+func TryAcquire(path string) (*Lock, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create lock directory: %w", err)
+	}
+	f, err := lockFile(path)
+	if err != nil {
+		return nil, err
+	}
+	_ = f.Truncate(0)
+	_, _ = fmt.Fprintf(f, "%d\n", os.Getpid())
+	return &Lock{path: path, f: f}, nil
+}
+
+// TryAcquireShared takes the lock at path in shared mode without waiting:
+// any number of processes may hold it together, and TryAcquire fails while
+// they do.
+func TryAcquireShared(path string) (*Lock, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create lock directory: %w", err)
+	}
+	f, err := lockFileShared(path)
+	if err != nil {
+		return nil, err
+	}
+	return &Lock{path: path, f: f}, nil
+}
+
+// Acquire waits until the lock at path is free or ctx is done.
+func Acquire(ctx context.Context, path string) (*Lock, error) {
+	for {
+		l, err := TryAcquire(path)
+		if !errors.Is(err, ErrLocked) {
+			return l, err
+		}
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("waiting for lock %s: %w", path, ctx.Err())
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+}
+
+// Release unlocks and closes the lock file.
+func (l *Lock) Release() error {
+	if l == nil || l.f == nil {
+		return nil
+	}
+	err := unlockFile(l.f)
+	if cerr := l.f.Close(); err == nil {
+		err = cerr
+	}
+	l.f = nil
+	return err
+}
+
+// KeepOnExec makes the lock outlive an exec of the process: the new program
+// holds it until it exits. It does nothing where exec is not supported.
+func (l *Lock) KeepOnExec() error {
+	if l == nil || l.f == nil {
+		return nil
+	}
+	return keepOnExec(l.f)
+}
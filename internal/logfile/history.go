@@ -0,0 +1,83 @@
+package logfile
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// History keeps one log file per launch in Dir, named
+// <Prefix>-<yyyymmdd-hhmmss>-<pid>.log, and prunes old ones.
+type History struct {
+	Dir    string
+	Prefix string
+	// Keep is the maximum number of files kept, including the new one.
+	Keep int
+	// MaxAge removes files older than this. Zero disables age pruning.
+	MaxAge time.Duration
+}
+
+// LatestName is the name of the pointer file holding the newest log file name.
+func (h History) LatestName() string {
+	return h.Prefix + "-latest.txt"
+}
+
+// Create starts a new log file, points the latest file at it and prunes old files.
+func (h History) Create() (*os.File, error) {
+	if err := os.MkdirAll(h.Dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create log directory: %w", err)
+	}
+	name := fmt.Sprintf("%s-%s-%d.log", h.Prefix, time.Now().Format("20060102-150405"), os.Getpid())
+	f, err := os.Create(filepath.Join(h.Dir, name))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create log file: %w", err)
+	}
+	_ = os.WriteFile(filepath.Join(h.Dir, h.LatestName()), []byte(name+"\n"), 0644)
+	h.prune(name)
+	return f, nil
+}
+
+// Files returns the existing log files, newest first.
+func (h History) Files() []string {
+	matches, _ := filepath.Glob(filepath.Join(h.Dir, h.Prefix+"-*.log"))
+	// Timestamped names sort chronologically
+	sort.Sort(sort.Reverse(sort.StringSlice(matches)))
+	return matches
+}
+
+// Latest returns the path of the newest log file, or "" when there is none.
+func (h History) Latest() string {
+	data, err := os.ReadFile(filepath.Join(h.Dir, h.LatestName()))
+	if err == nil {
+		if name := strings.TrimSpace(string(data)); name != "" {
+			return filepath.Join(h.Dir, name)
+		}
+	}
+	if files := h.Files(); len(files) > 0 {
+		return files[0]
+	}
+	return ""
+}
+
+func (h History) prune(current string) {
+	cutoff := time.Now().Add(-h.MaxAge)
+	kept := 0
+	for _, f := range h.Files() {
+		if filepath.Base(f) == current {
+			kept++
+			continue
+		}
+		info, err := os.Stat(f)
+		if err != nil {
+			continue
+		}
+		if (h.Keep > 0 && kept >= h.Keep) || (h.MaxAge > 0 && info.ModTime().Before(cutoff)) {
+			_ = os.Remove(f)
+			continue
+		}
+		kept++
+	}
+}
@@ -0,0 +1,230 @@
+package logfile
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Writer is a log file that rotates when it grows past MaxSize.
+// Rotated files are named path.1 (newest) to path.<keep> (oldest).
+type Writer struct {
+	mu      sync.Mutex
+	path    string
+	maxSize int64
+	keep    int
+	f       *os.File
+	size    int64
+}
+
+// Open opens (appending) or creates the log file at path, creating parent directories.
+// A maxSize <= 0 disables rotation.
+func Open(path string, maxSize int64, keep int) (*Writer, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create log directory: %w", err)
+	}
+	w := &Writer{path: path, maxSize: maxSize, keep: keep}
+	if err := w.open(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+func (w *Writer) open() error {
+	f, err := os.OpenFile(w.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open log file: %w", err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("failed to stat log file: %w", err)
+	}
+	w.f = f
+	w.size = info.Size()
+	return nil
+}
+
+// Path returns the path of the active log file.
+func (w *Writer) Path() string {
+	return w.path
+}
+
+func (w *Writer) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.f == nil {
+		return 0, os.ErrClosed
+	}
+	if w.maxSize > 0 && w.size > 0 && w.size+int64(len(p)) > w.maxSize {
+		if err := w.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := w.f.Write(p)
+	w.size += int64(n)
+	return n, err
+}
+
+func (w *Writer) rotate() error {
+	if err := w.f.Close(); err != nil {
+		return err
+	}
+	w.f = nil
+
+	if w.keep <= 0 {
+		_ = os.Remove(w.path)
+	} else {
+		_ = os.Remove(w.path + "." + strconv.Itoa(w.keep))
+		for i := w.keep - 1; i >= 1; i-- {
+			_ = os.Rename(w.path+"."+strconv.Itoa(i), w.path+"."+strconv.Itoa(i+1))
+		}
+		if err := os.Rename(w.path, w.path+".1"); err != nil {
+			return fmt.Errorf("failed to rotate log file: %w", err)
+		}
+	}
+	return w.open()
+}
+
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.f == nil {
+		return nil
+	}
+	err := w.f.Close()
+	w.f = nil
+	return err
+}
+
+// Timestamped prefixes every line written to w with the current time.
+func Timestamped(w io.Writer) io.Writer {
+	return &stampWriter{w: w, lineStart: true}
+}
+
+type stampWriter struct {
+	mu        sync.Mutex
+	w         io.Writer
+	lineStart bool
+}
+
+func (s *stampWriter) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var b strings.Builder
+	for _, c := range p {
+		if s.lineStart {
+			b.WriteString(time.Now().Format("2006-01-02 15:04:05.000 "))
+			s.lineStart = false
+		}
+		b.WriteByte(c)
+		if c == '\n' {
+			s.lineStart = true
+		}
+	}
+	if _, err := io.WriteString(s.w, b.String()); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// maxPartialLine is how much of an unterminated line a Lines stream holds
+// back before writing it anyway.
+const maxPartialLine = 64 << 10
+
+// Lines serializes several streams into one writer a line at a time, so that
+// lines written concurrently by different streams never interleave. Each
+// stream holds back its unterminated last line until the newline arrives,
+// the line grows past 64 KiB, or Flush is called.
+type Lines struct {
+	mu      sync.Mutex
+	w       io.Writer
+	streams []*lineStream
+}
+
+// NewLines returns a Lines writing to w.
+func NewLines(w io.Writer) *Lines {
+	return &Lines{w: w}
+}
+
+// Stream returns a new stream writing to l.
+func (l *Lines) Stream() io.Writer {
+	s := &lineStream{lines: l}
+	l.mu.Lock()
+	l.streams = append(l.streams, s)
+	l.mu.Unlock()
+	return s
+}
+
+// Flush writes the lines the streams are holding back.
+func (l *Lines) Flush() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, s := range l.streams {
+		if err := s.write(len(s.partial)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type lineStream struct {
+	lines   *Lines
+	partial []byte // guarded by lines.mu
+}
+
+func (s *lineStream) Write(p []byte) (int, error) {
+	s.lines.mu.Lock()
+	defer s.lines.mu.Unlock()
+	s.partial = append(s.partial, p...)
+	n := bytes.LastIndexByte(s.partial, '\n') + 1
+	if len(s.partial)-n > maxPartialLine {
+		n = len(s.partial)
+	}
+	if err := s.write(n); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// write writes the first n bytes held back.
+func (s *lineStream) write(n int) error {
+	if n == 0 {
+		return nil
+	}
+	_, err := s.lines.w.Write(s.partial[:n])
+	s.partial = append(s.partial[:0], s.partial[n:]...)
+	return err
+}
+
+// ParseSize parses sizes such as "512k", "10MB" or "1048576" into bytes.
+func ParseSize(s string) (int64, error) {
+	v := strings.ToLower(strings.TrimSpace(s))
+	v = strings.TrimSuffix(v, "b")
+	mult := int64(1)
+	switch {
+	case strings.HasSuffix(v, "k"):
+		mult = 1 << 10
+	case strings.HasSuffix(v, "m"):
+		mult = 1 << 20
+	case strings.HasSuffix(v, "g"):
+		mult = 1 << 30
+	}
+	if mult > 1 {
+		v = v[:len(v)-1]
+	}
+	n, err := strconv.ParseInt(strings.TrimSpace(v), 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return n * mult, nil
+}
@@ -0,0 +1,158 @@
+package logfile
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriterRotates(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "console.log")
+	w, err := Open(path, 10, 2)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	for _, line := range []string{"first\n", "second\n", "third\n", "fourth\n"} {
+		if _, err := w.Write([]byte(line)); err != nil {
+			t.Fatalf("Write() error = %v", err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	want := map[string]string{
+		path:        "fourth\n",
+		path + ".1": "third\n",
+		path + ".2": "second\n",
+	}
+	for p, content := range want {
+		got, err := os.ReadFile(p)
+		if err != nil {
+			t.Fatalf("ReadFile(%s) error = %v", p, err)
+		}
+		if string(got) != content {
+			t.Errorf("%s = %q, want %q", filepath.Base(p), got, content)
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Errorf("expected %s.3 to be pruned", filepath.Base(path))
+	}
+}
+
+func TestTimestamped(t *testing.T) {
+	var b strings.Builder
+	w := Timestamped(&b)
+	_, _ = w.Write([]byte("one\ntw"))
+	_, _ = w.Write([]byte("o\n"))
+
+	lines := strings.Split(strings.TrimSuffix(b.String(), "\n"), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("got %d lines, want 2: %q", len(lines), b.String())
+	}
+	for i, want := range []string{"one", "two"} {
+		// "2006-01-02 15:04:05.000 " is 24 characters
+		if len(lines[i]) < 24 || lines[i][24:] != want {
+			t.Errorf("line %d = %q, want timestamp + %q", i, lines[i], want)
+		}
+	}
+}
+
+func TestLines(t *testing.T) {
+	var b strings.Builder
+	l := NewLines(&b)
+	stdout, stderr := l.Stream(), l.Stream()
+	_, _ = stdout.Write([]byte("out one\nout "))
+	_, _ = stderr.Write([]byte("err one\n"))
+	_, _ = stdout.Write([]byte("two\n"))
+	_, _ = stderr.Write([]byte("err partial"))
+	if want := "out one\nerr one\nout two\n"; b.String() != want {
+		t.Errorf("written = %q, want %q", b.String(), want)
+	}
+	if err := l.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(b.String(), "\nerr partial") {
+		t.Errorf("Flush() did not write the partial line: %q", b.String())
+	}
+
+	// A line without end is written once it gets too long
+	b.Reset()
+	_, _ = stdout.Write(bytes.Repeat([]byte("x"), maxPartialLine+1))
+	if b.Len() != maxPartialLine+1 {
+		t.Errorf("written %d bytes, want the long partial line", b.Len())
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    int64
+		wantErr bool
+	}{
+		{"1048576", 1048576, false},
+		{"512k", 512 << 10, false},
+		{"10MB", 10 << 20, false},
+		{"1g", 1 << 30, false},
+		{"ten", 0, true},
+		{"-1", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseSize(tt.input)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseSize(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseSize(%q) = %d, want %d", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestHistory(t *testing.T) {
+	dir := t.TempDir()
+	h := History{Dir: dir, Prefix: "gjg-debug", Keep: 3, MaxAge: 24 * time.Hour}
+
+	old := []string{
+		"gjg-debug-20240101-100000-1.log",
+		"gjg-debug-20240102-100000-1.log",
+		"gjg-debug-20240103-100000-1.log",
+		"gjg-debug-20240104-100000-1.log",
+	}
+	for i, name := range old {
+		p := filepath.Join(dir, name)
+		if err := os.WriteFile(p, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+		// Only the first file is older than MaxAge
+		mtime := time.Now().Add(-time.Duration(len(old)-i) * time.Minute)
+		if i == 0 {
+			mtime = time.Now().Add(-48 * time.Hour)
+		}
+		if err := os.Chtimes(p, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	f, err := h.Create()
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	f.Close()
+
+	if got := h.Latest(); got != f.Name() {
+		t.Errorf("Latest() = %s, want %s", got, f.Name())
+	}
+
+	var names []string
+	for _, p := range h.Files() {
+		names = append(names, filepath.Base(p))
+	}
+	want := []string{filepath.Base(f.Name()), old[3], old[2]}
+	if strings.Join(names, ",") != strings.Join(want, ",") {
+		t.Errorf("Files() = %v, want %v", names, want)
+	}
+}
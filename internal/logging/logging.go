@@ -0,0 +1,135 @@
+package logging
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"gjg/internal/redact"
+	"io"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+// Options configure the launcher logger.
+type Options struct {
+	// Level is debug, info, warn or error.
+	Level string
+	// Format is text or json.
+	Format string
+	// Outputs receive every record at or above Level. Nil entries are skipped.
+	Outputs []io.Writer
+	// Redactor hides secrets in string, []string and error attribute values.
+	// Nil uses the built-in patterns.
+	Redactor *redact.Redactor
+}
+
+// ParseLevel converts a --gjg-log-level value into a slog level.
+func ParseLevel(s string) (slog.Level, error) {
+	switch strings.ToLower(s) {
+	case "debug":
+		return slog.LevelDebug, nil
+	case "", "info":
+		return slog.LevelInfo, nil
+	case "warn", "warning":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
+	}
+	return 0, fmt.Errorf("invalid log level %q (expected debug, info, warn or error)", s)
+}
+
+// New builds a logger writing to all outputs in the requested format.
+func New(opts Options) (*slog.Logger, error) {
+	level, err := ParseLevel(opts.Level)
+	if err != nil {
+		return nil, err
+	}
+	r := opts.Redactor
+	if r == nil {
+		r = redact.Default()
+	}
+	redactAttr := func(groups []string, a slog.Attr) slog.Attr {
+		if len(groups) == 0 && (a.Key == slog.MessageKey || a.Key == slog.LevelKey || a.Key == slog.TimeKey) {
+			return a
+		}
+		switch a.Value.Kind() {
+		case slog.KindString:
+			a.Value = slog.StringValue(r.String(a.Value.String()))
+		case slog.KindAny:
+			switch v := a.Value.Any().(type) {
+			case []string:
+				a.Value = slog.AnyValue(r.Args(v))
+			case error:
+				a.Value = slog.StringValue(r.String(v.Error()))
+			}
+		}
+		return a
+	}
+	jsonOpts := &slog.HandlerOptions{Level: level, ReplaceAttr: redactAttr}
+	textOpts := &slog.HandlerOptions{
+		Level: level,
+		// Keep text logs short; JSON keeps RFC 3339 timestamps for log aggregators
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if a.Key == slog.TimeKey && len(groups) == 0 {
+				a.Value = slog.StringValue(a.Value.Time().Format(time.DateTime))
+				return a
+			}
+			return redactAttr(groups, a)
+		},
+	}
+
+	var handlers []slog.Handler
+	for _, w := range opts.Outputs {
+		if w == nil {
+			continue
+		}
+		switch opts.Format {
+		case "", "text":
+			handlers = append(handlers, slog.NewTextHandler(w, textOpts))
+		case "json":
+			handlers = append(handlers, slog.NewJSONHandler(w, jsonOpts))
+		default:
+			return nil, fmt.Errorf("invalid log format %q (expected text or json)", opts.Format)
+		}
+	}
+	return slog.New(fanout(handlers)), nil
+}
+
+// fanout sends each record to every handler that accepts its level.
+type fanout []slog.Handler
+
+func (f fanout) Enabled(ctx context.Context, level slog.Level) bool {
+	for _, h := range f {
+		if h.Enabled(ctx, level) {
+			return true
+		}
+	}
+	return false
+}
+
+func (f fanout) Handle(ctx context.Context, r slog.Record) error {
+	var errs []error
+	for _, h := range f {
+		if h.Enabled(ctx, r.Level) {
+			errs = append(errs, h.Handle(ctx, r.Clone()))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (f fanout) WithAttrs(attrs []slog.Attr) slog.Handler {
+	out := make(fanout, len(f))
+	for i, h := range f {
+		out[i] = h.WithAttrs(attrs)
+	}
+	return out
+}
+
+func (f fanout) WithGroup(name string) slog.Handler {
+	out := make(fanout, len(f))
+	for i, h := range f {
+		out[i] = h.WithGroup(name)
+	}
+	return out
+}
@@ -0,0 +1,60 @@
+package logging
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestNewFansOutByLevel(t *testing.T) {
+	var a, b strings.Builder
+	log, err := New(Options{Level: "warn", Format: "json", Outputs: []io.Writer{&a, nil, &b}})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	log.Info("hidden")
+	log.Warn("shown", "key", "value")
+
+	for name, out := range map[string]string{"first": a.String(), "second": b.String()} {
+		lines := strings.Split(strings.TrimSpace(out), "\n")
+		if len(lines) != 1 {
+			t.Fatalf("%s output has %d lines, want 1: %q", name, len(lines), out)
+		}
+		var rec map[string]any
+		if err := json.Unmarshal([]byte(lines[0]), &rec); err != nil {
+			t.Fatalf("%s output is not JSON: %v", name, err)
+		}
+		if rec["msg"] != "shown" || rec["key"] != "value" || rec["level"] != "WARN" {
+			t.Errorf("%s record = %v", name, rec)
+		}
+	}
+}
+
+func TestNewRejectsInvalidOptions(t *testing.T) {
+	if _, err := New(Options{Level: "loud"}); err == nil {
+		t.Errorf("New() with invalid level: expected error")
+	}
+	if _, err := New(Options{Format: "xml", Outputs: []io.Writer{&strings.Builder{}}}); err == nil {
+		t.Errorf("New() with invalid format: expected error")
+	}
+}
+
+func TestNewRedactsAttributes(t *testing.T) {
+	var b strings.Builder
+	log, err := New(Options{Outputs: []io.Writer{&b}})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	log.Info("Executing", "argv", []string{"java", "-Ddb.password=hunter2"}, "jvmArgs", "-Dapi.token=abc -Xmx1g")
+	log.Error("Java failed", "error", fmt.Errorf("exec %s: not found", "--secret=s3cr3t"))
+
+	out := b.String()
+	if strings.Contains(out, "hunter2") || strings.Contains(out, "abc") || strings.Contains(out, "s3cr3t") {
+		t.Errorf("log output leaks a secret: %s", out)
+	}
+	if !strings.Contains(out, "-Ddb.password=***") || !strings.Contains(out, "-Dapi.token=***") || !strings.Contains(out, "--secret=***") {
+		t.Errorf("log output is missing redacted values: %s", out)
+	}
+}
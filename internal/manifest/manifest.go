@@ -0,0 +1,274 @@
+package manifest
+
+import (
+	"bufio"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gjg/internal/signature"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// FileName is the manifest name, looked up next to the configuration file.
+const FileName = "gjg.manifest"
+
+// Mode says what happens when verification fails.
+type Mode string
+
+const (
+	ModeOff    Mode = "off"
+	ModeWarn   Mode = "warn"
+	ModeStrict Mode = "strict"
+)
+
+// ParseMode validates a verify mode read from configuration.
+func ParseMode(s string) (Mode, error) {
+	switch m := Mode(s); m {
+	case ModeOff, ModeWarn, ModeStrict:
+		return m, nil
+	}
+	return "", fmt.Errorf("invalid verify mode %q (expected strict, warn or off)", s)
+}
+
+// Entry is one file listed in the manifest. Path is relative to the manifest
+// directory and uses forward slashes.
+type Entry struct {
+	Path   string
+	Size   int64
+	SHA256 string
+}
+
+// Manifest lists the files of an installation with their hashes.
+type Manifest struct {
+	Entries []Entry
+}
+
+// Generate hashes files, which may be directories to include recursively.
+// Relative names are resolved against root, and all paths are recorded
+// relative to it.
+func Generate(root string, files []string) (*Manifest, error) {
+	seen := map[string]bool{}
+	m := &Manifest{}
+	for _, name := range files {
+		p := name
+		if !filepath.IsAbs(p) {
+			p = filepath.Join(root, p)
+		}
+		err := filepath.WalkDir(p, func(path string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return err
+			}
+			rel, err := filepath.Rel(root, path)
+			if err != nil || !filepath.IsLocal(rel) {
+				return fmt.Errorf("%s is outside %s", path, root)
+			}
+			rel = filepath.ToSlash(rel)
+			if seen[rel] || rel == FileName {
+				return nil
+			}
+			seen[rel] = true
+			size, sum, err := hashFile(path)
+			if err != nil {
+				return err
+			}
+			m.Entries = append(m.Entries, Entry{Path: rel, Size: size, SHA256: sum})
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	sort.Slice(m.Entries, func(i, j int) bool { return m.Entries[i].Path < m.Entries[j].Path })
+	return m, nil
+}
+
+// Write writes m as "<sha256>  <size>  <path>" lines.
+func (m *Manifest) Write(w io.Writer) error {
+	var b strings.Builder
+	for _, e := range m.Entries {
+		fmt.Fprintf(&b, "%s  %d  %s\n", e.SHA256, e.Size, e.Path)
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// Parse reads a manifest written by Write. Blank lines and # comments are ignored.
+func Parse(r io.Reader) (*Manifest, error) {
+	m := &Manifest{}
+	scanner := bufio.NewScanner(r)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.SplitN(line, "  ", 3)
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("invalid manifest line %d", lineNo)
+		}
+		size, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil || len(fields[0]) != sha256.Size*2 {
+			return nil, fmt.Errorf("invalid manifest line %d", lineNo)
+		}
+		if !filepath.IsLocal(filepath.FromSlash(fields[2])) {
+			return nil, fmt.Errorf("invalid path at manifest line %d: %q", lineNo, fields[2])
+		}
+		m.Entries = append(m.Entries, Entry{Path: fields[2], Size: size, SHA256: strings.ToLower(fields[0])})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Load reads the manifest at path.
+func Load(path string) (*Manifest, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Parse(f)
+}
+
+// MismatchError lists the files that did not match the manifest.
+type MismatchError struct {
+	Problems []string
+}
+
+func (e *MismatchError) Error() string {
+	return "integrity check failed: " + strings.Join(e.Problems, "; ")
+}
+
+// Verifier checks an installation against its manifest.
+type Verifier struct {
+	// Manifest is the manifest path; listed files are relative to its directory.
+	Manifest string
+	// StampPath caches the result of the last full verification. Empty
+	// disables the fast path.
+	StampPath string
+	// Full hashes every file even when the stamp matches.
+	Full bool
+	// PublicKey, when set, requires a valid detached signature of the manifest.
+	PublicKey ed25519.PublicKey
+}
+
+// Verify returns nil when every file matches. It returns a *MismatchError
+// when files were changed, and other errors when the manifest is unusable.
+func (v Verifier) Verify() error {
+	data, err := os.ReadFile(v.Manifest)
+	if err != nil {
+		return fmt.Errorf("failed to read manifest: %w", err)
+	}
+	if v.PublicKey != nil {
+		if err := signature.VerifyFile(v.PublicKey, v.Manifest, data); err != nil {
+			return fmt.Errorf("manifest signature check failed: %w", err)
+		}
+	}
+	m, err := Parse(strings.NewReader(string(data)))
+	if err != nil {
+		return fmt.Errorf("%s: %w", v.Manifest, err)
+	}
+	manifestSum := sha256.Sum256(data)
+	root := filepath.Dir(v.Manifest)
+
+	current := stamp{Manifest: hex.EncodeToString(manifestSum[:]), Files: map[string]fileStamp{}}
+	for _, e := range m.Entries {
+		if info, err := os.Stat(filepath.Join(root, filepath.FromSlash(e.Path))); err == nil {
+			current.Files[e.Path] = fileStamp{Size: info.Size(), ModTime: info.ModTime().UnixNano()}
+		}
+	}
+	if !v.Full && v.StampPath != "" && readStamp(v.StampPath).equal(current) {
+		return nil
+	}
+
+	var problems []string
+	for _, e := range m.Entries {
+		size, sum, err := hashFile(filepath.Join(root, filepath.FromSlash(e.Path)))
+		switch {
+		case errors.Is(err, fs.ErrNotExist):
+			problems = append(problems, e.Path+" is missing")
+		case err != nil:
+			problems = append(problems, fmt.Sprintf("%s cannot be read: %v", e.Path, err))
+		case size != e.Size || sum != e.SHA256:
+			problems = append(problems, e.Path+" was modified")
+		}
+	}
+	if len(problems) > 0 {
+		if v.StampPath != "" {
+			_ = os.Remove(v.StampPath)
+		}
+		return &MismatchError{Problems: problems}
+	}
+	if v.StampPath != "" {
+		_ = writeStamp(v.StampPath, current)
+	}
+	return nil
+}
+
+// stamp records the sizes and modification times seen at the last
+// successful full verification of a manifest.
+type stamp struct {
+	Manifest string               `json:"manifest"`
+	Files    map[string]fileStamp `json:"files"`
+}
+
+type fileStamp struct {
+	Size    int64 `json:"size"`
+	ModTime int64 `json:"modTime"`
+}
+
+func (s stamp) equal(o stamp) bool {
+	if s.Manifest != o.Manifest || len(s.Files) != len(o.Files) {
+		return false
+	}
+	for k, v := range s.Files {
+		if o.Files[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+func readStamp(path string) stamp {
+	var s stamp
+	if data, err := os.ReadFile(path); err == nil {
+		_ = json.Unmarshal(data, &s)
+	}
+	return s
+}
+
+func writeStamp(path string, s stamp) error {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+func hashFile(path string) (int64, string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	n, err := io.Copy(h, f)
+	if err != nil {
+		return 0, "", err
+	}
+	return n, hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,201 @@
+package manifest
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"gjg/internal/signature"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func setup(t *testing.T) string {
+	t.Helper()
+	root := t.TempDir()
+	files := map[string]string{
+		"app.jar":              "jar",
+		"app.gjg.conf":         "jvm_args=-Xmx1g\n",
+		"runtime/bin/java":     "java",
+		"runtime/lib/modules":  "modules",
+		"unlisted/readme.txt":  "not in manifest",
+		"runtime/conf/jvm.cfg": "cfg",
+	}
+	for name, content := range files {
+		p := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	m, err := Generate(root, []string{"app.jar", "app.gjg.conf", "runtime"})
+	if err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+	f, err := os.Create(filepath.Join(root, FileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := m.Write(f); err != nil {
+		t.Fatal(err)
+	}
+	return root
+}
+
+func TestGenerateWriteParse(t *testing.T) {
+	root := setup(t)
+	m, err := Load(filepath.Join(root, FileName))
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	var paths []string
+	for _, e := range m.Entries {
+		paths = append(paths, e.Path)
+	}
+	want := []string{"app.gjg.conf", "app.jar", "runtime/bin/java", "runtime/conf/jvm.cfg", "runtime/lib/modules"}
+	if !reflect.DeepEqual(paths, want) {
+		t.Errorf("entries = %q, want %q", paths, want)
+	}
+
+	var buf bytes.Buffer
+	if err := m.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	again, err := Parse(&buf)
+	if err != nil || !reflect.DeepEqual(again, m) {
+		t.Errorf("Parse(Write()) = %+v, %v", again, err)
+	}
+}
+
+func TestParseRejects(t *testing.T) {
+	sum := strings.Repeat("a", 64)
+	tests := []string{
+		"garbage",
+		sum + "  x  app.jar",
+		"abc  3  app.jar",
+		sum + "  3  ../outside.jar",
+	}
+	for _, in := range tests {
+		if _, err := Parse(strings.NewReader(in)); err == nil {
+			t.Errorf("Parse(%q) expected error", in)
+		}
+	}
+}
+
+func TestVerify(t *testing.T) {
+	tests := []struct {
+		name    string
+		change  func(root string)
+		problem string
+	}{
+		{"unchanged", func(string) {}, ""},
+		{"unlisted file changed", func(root string) {
+			os.WriteFile(filepath.Join(root, "unlisted", "readme.txt"), []byte("changed"), 0644)
+		}, ""},
+		{"modified", func(root string) {
+			os.WriteFile(filepath.Join(root, "app.jar"), []byte("evil"), 0644)
+		}, "app.jar was modified"},
+		{"missing", func(root string) {
+			os.Remove(filepath.Join(root, "runtime", "lib", "modules"))
+		}, "runtime/lib/modules is missing"},
+	}
+	for _, tt := range tests {
+		for _, full := range []bool{false, true} {
+			t.Run(tt.name, func(t *testing.T) {
+				root := setup(t)
+				v := Verifier{Manifest: filepath.Join(root, FileName), StampPath: filepath.Join(t.TempDir(), "stamp.json"), Full: full}
+				if err := v.Verify(); err != nil {
+					t.Fatalf("first Verify() error = %v", err)
+				}
+				tt.change(root)
+				err := v.Verify()
+				if tt.problem == "" {
+					if err != nil {
+						t.Errorf("Verify() error = %v", err)
+					}
+					return
+				}
+				var mismatch *MismatchError
+				if !errors.As(err, &mismatch) || !strings.Contains(err.Error(), tt.problem) {
+					t.Errorf("Verify() error = %v, want mismatch %q", err, tt.problem)
+				}
+			})
+		}
+	}
+}
+
+func TestVerifyFastModeTrustsStamp(t *testing.T) {
+	root := setup(t)
+	v := Verifier{Manifest: filepath.Join(root, FileName), StampPath: filepath.Join(t.TempDir(), "stamp.json")}
+	if err := v.Verify(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Same size and modification time: only a full check notices
+	jar := filepath.Join(root, "app.jar")
+	info, _ := os.Stat(jar)
+	if err := os.WriteFile(jar, []byte("JAR"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(jar, time.Time{}, info.ModTime()); err != nil {
+		t.Fatal(err)
+	}
+	if err := v.Verify(); err != nil {
+		t.Errorf("fast Verify() error = %v, want stamp hit", err)
+	}
+	v.Full = true
+	if err := v.Verify(); err == nil {
+		t.Error("full Verify() should detect the change")
+	}
+}
+
+func TestVerifySignature(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		sign    bool
+		tamper  bool
+		key     ed25519.PublicKey
+		wantErr error
+	}{
+		{"signed", true, false, pub, nil},
+		{"unsigned", false, false, pub, signature.ErrUnsigned},
+		{"tampered", true, true, pub, signature.ErrBadSignature},
+		{"other key", true, false, other, signature.ErrBadSignature},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := setup(t)
+			path := filepath.Join(root, FileName)
+			if tt.sign {
+				if err := signature.SignFile(priv, path); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if tt.tamper {
+				// Drop a line so that app.jar is no longer checked
+				data, _ := os.ReadFile(path)
+				lines := strings.SplitAfter(string(data), "\n")
+				os.WriteFile(path, []byte(strings.Join(lines[1:], "")), 0644)
+			}
+			v := Verifier{Manifest: path, PublicKey: tt.key}
+			if err := v.Verify(); !errors.Is(err, tt.wantErr) || (tt.wantErr == nil) != (err == nil) {
+				t.Errorf("Verify() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,59 @@
+package maven
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gjg/internal/fsutil"
+	"io/fs"
+	"os"
+	"strings"
+)
+
+// Lock records a resolution so that later launches use the same artifacts
+// without reading POMs again.
+type Lock struct {
+	// Inputs is a digest of the dependencies and repositories resolved; the
+	// lock is stale once they change.
+	Inputs    string     `json:"inputs"`
+	Artifacts []Artifact `json:"artifacts"`
+}
+
+// Inputs returns the digest of what a resolution depends on.
+func Inputs(deps, repos []string) string {
+	h := sha256.New()
+	for _, d := range deps {
+		fmt.Fprintf(h, "dependency=%s\n", strings.TrimSpace(d))
+	}
+	for _, r := range repos {
+		fmt.Fprintf(h, "repository=%s\n", strings.TrimSpace(r))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// ReadLock reads the lock file at path. It returns nil if there is none.
+func ReadLock(path string) (*Lock, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var l Lock
+	if err := json.Unmarshal(data, &l); err != nil {
+		return nil, fmt.Errorf("invalid lock file %s: %w", path, err)
+	}
+	return &l, nil
+}
+
+// Write saves the lock file atomically.
+func (l *Lock) Write(path string) error {
+	data, err := json.MarshalIndent(l, "", "  ")
+	if err != nil {
+		return err
+	}
+	return fsutil.WriteFile(path, append(data, '\n'), 0644)
+}
@@ -0,0 +1,226 @@
+// Package maven resolves Maven dependencies: it reads POMs from remote or
+// file:// repositories, picks transitive versions the way Maven does and
+// keeps the artifacts in a local repository laid out like ~/.m2/repository.
+package maven
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"gjg/internal/fsutil"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Central is the repository used when none is configured.
+const Central = "https://repo.maven.apache.org/maven2/"
+
+// errNotFound is returned by fetch when no repository has a file.
+var errNotFound = errors.New("not found in any repository")
+
+// Coord is a Maven artifact coordinate.
+type Coord struct {
+	GroupID    string
+	ArtifactID string
+	Version    string
+	Classifier string
+	// Type is jar or pom; a pom dependency only brings its dependencies.
+	Type string
+}
+
+// ParseCoord parses group:artifact:version or group:artifact:version:classifier.
+func ParseCoord(s string) (Coord, error) {
+	parts := strings.Split(strings.TrimSpace(s), ":")
+	if len(parts) != 3 && len(parts) != 4 {
+		return Coord{}, fmt.Errorf("invalid dependency %q (expected group:artifact:version)", s)
+	}
+	for _, p := range parts {
+		if p == "" {
+			return Coord{}, fmt.Errorf("invalid dependency %q (expected group:artifact:version)", s)
+		}
+	}
+	c := Coord{GroupID: parts[0], ArtifactID: parts[1], Version: parts[2], Type: "jar"}
+	if len(parts) == 4 {
+		c.Classifier = parts[3]
+	}
+	if err := checkVersion(c); err != nil {
+		return Coord{}, err
+	}
+	return c, nil
+}
+
+func (c Coord) String() string {
+	s := c.GroupID + ":" + c.ArtifactID + ":" + c.Version
+	if c.Classifier != "" {
+		s += ":" + c.Classifier
+	}
+	return s
+}
+
+// key identifies the artifact regardless of its version, for nearest-wins.
+func (c Coord) key() string {
+	return c.GroupID + ":" + c.ArtifactID + ":" + c.Type + ":" + c.Classifier
+}
+
+// dir is the repository folder of the version.
+func (c Coord) dir() string {
+	return path.Join(strings.ReplaceAll(c.GroupID, ".", "/"), c.ArtifactID, c.Version)
+}
+
+// pomPath is the repository path of the POM.
+func (c Coord) pomPath() string {
+	return path.Join(c.dir(), c.ArtifactID+"-"+c.Version+".pom")
+}
+
+// jarPath is the repository path of the jar.
+func (c Coord) jarPath() string {
+	name := c.ArtifactID + "-" + c.Version
+	if c.Classifier != "" {
+		name += "-" + c.Classifier
+	}
+	return path.Join(c.dir(), name+".jar")
+}
+
+// checkVersion rejects versions the resolver cannot pick by itself.
+func checkVersion(c Coord) error {
+	switch v := c.Version; {
+	case v == "":
+		return fmt.Errorf("%s:%s has no version", c.GroupID, c.ArtifactID)
+	case strings.ContainsAny(v[:1], "[("), v == "LATEST", v == "RELEASE":
+		return fmt.Errorf("%s: version ranges, LATEST and RELEASE are not supported", c)
+	case strings.Contains(v, "${"):
+		return fmt.Errorf("%s: unresolved property in version", c)
+	}
+	return nil
+}
+
+// Artifact is a resolved jar in the local repository.
+type Artifact struct {
+	Coords string `json:"coords"`
+	// Path is relative to the repository root, with forward slashes.
+	Path       string `json:"path"`
+	SHA256     string `json:"sha256"`
+	Repository string `json:"repository"`
+}
+
+// Resolver fetches artifacts from Repositories into Local.
+type Resolver struct {
+	// Repositories are base URLs (https://, http:// or file://), tried in
+	// order. Empty uses Maven Central.
+	Repositories []string
+	// Local is the local repository directory.
+	Local  string
+	Client *http.Client
+
+	models map[string]*model
+}
+
+// File returns the local path of a.
+func (r *Resolver) File(a Artifact) string {
+	return filepath.Join(r.Local, filepath.FromSlash(a.Path))
+}
+
+// fetch returns the local copy of the repository file at rel, downloading
+// it from the first repository that has it. It returns the repository used,
+// or "" for a file already in the local repository.
+func (r *Resolver) fetch(ctx context.Context, rel string) (string, string, error) {
+	local := filepath.Join(r.Local, filepath.FromSlash(rel))
+	if _, err := os.Stat(local); err == nil {
+		return local, "", nil
+	}
+	repos := r.Repositories
+	if len(repos) == 0 {
+		repos = []string{Central}
+	}
+	var errs []error
+	for _, repo := range repos {
+		data, err := r.get(ctx, repo, rel)
+		if errors.Is(err, errNotFound) {
+			continue
+		}
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if err := verifySHA1(ctx, r, repo, rel, data); err != nil {
+			return "", "", err
+		}
+		if err := fsutil.WriteFile(local, data, 0644); err != nil {
+			return "", "", err
+		}
+		return local, repo, nil
+	}
+	if len(errs) > 0 {
+		return "", "", fmt.Errorf("%s: %w", rel, errors.Join(errs...))
+	}
+	return "", "", fmt.Errorf("%s: %w", rel, errNotFound)
+}
+
+// verifySHA1 checks data against the repository's .sha1 file, when it has
+// one. A checksum that cannot be read or is empty fails the download.
+func verifySHA1(ctx context.Context, r *Resolver, repo, rel string, data []byte) error {
+	sum, err := r.get(ctx, repo, rel+".sha1")
+	if errors.Is(err, errNotFound) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("%s.sha1 from %s: %w", rel, repo, err)
+	}
+	fields := strings.Fields(string(sum))
+	if len(fields) == 0 {
+		return fmt.Errorf("%s.sha1 from %s is empty", rel, repo)
+	}
+	h := sha1.Sum(data)
+	if got := hex.EncodeToString(h[:]); !strings.EqualFold(got, fields[0]) {
+		return fmt.Errorf("%s from %s: sha1 mismatch (got %s, want %s)", rel, repo, got, fields[0])
+	}
+	return nil
+}
+
+// get reads rel from one repository.
+func (r *Resolver) get(ctx context.Context, repo, rel string) ([]byte, error) {
+	base, err := url.Parse(strings.TrimSuffix(repo, "/") + "/")
+	if err != nil {
+		return nil, err
+	}
+	u := base.JoinPath(rel)
+	switch u.Scheme {
+	case "file":
+		data, err := os.ReadFile(fsutil.FromURL(u))
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, errNotFound
+		}
+		return data, err
+	case "http", "https":
+	default:
+		return nil, fmt.Errorf("unsupported repository %s", repo)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	client := r.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return io.ReadAll(resp.Body)
+	case http.StatusNotFound:
+		return nil, errNotFound
+	}
+	return nil, fmt.Errorf("%s: %s", u, resp.Status)
+}
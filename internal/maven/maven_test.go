@@ -0,0 +1,191 @@
+package maven
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"gjg/internal/fsutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// repo writes POMs and jars into a file:// repository and returns its URL.
+func repo(t *testing.T, poms map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for coords, body := range poms {
+		c, err := ParseCoord(coords)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pom := filepath.Join(dir, filepath.FromSlash(c.pomPath()))
+		os.MkdirAll(filepath.Dir(pom), 0755)
+		os.WriteFile(pom, []byte("<project>"+body+"</project>"), 0644)
+		os.WriteFile(filepath.Join(dir, filepath.FromSlash(c.jarPath())), []byte(coords), 0644)
+	}
+	return fsutil.ToURL(dir).String()
+}
+
+func TestParseCoord(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{"org.example:lib:1.0", "org.example:lib:1.0", false},
+		{" org.example:lib:1.0:linux ", "org.example:lib:1.0:linux", false},
+		{"org.example:lib", "", true},
+		{"org.example::1.0", "", true},
+		{"org.example:lib:[1.0,2.0)", "", true},
+		{"org.example:lib:LATEST", "", true},
+	}
+	for _, tt := range tests {
+		c, err := ParseCoord(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseCoord(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if err == nil && c.String() != tt.want {
+			t.Errorf("ParseCoord(%q) = %s, want %s", tt.in, c, tt.want)
+		}
+	}
+}
+
+func TestResolve(t *testing.T) {
+	dep := func(coords, extra string) string {
+		p := strings.Split(coords, ":")
+		s := "<dependency><groupId>" + p[0] + "</groupId><artifactId>" + p[1] + "</artifactId>"
+		if len(p) > 2 {
+			s += "<version>" + p[2] + "</version>"
+		}
+		return s + extra + "</dependency>"
+	}
+	repoURL := repo(t, map[string]string{
+		"org.example:parent:1": `<groupId>org.example</groupId><artifactId>parent</artifactId><version>1</version>
+			<properties><log.version>2.0</log.version></properties>
+			<dependencyManagement><dependencies>` + dep("org.example:util:3.0", "") + `</dependencies></dependencyManagement>`,
+		"org.example:app:1": `<parent><groupId>org.example</groupId><artifactId>parent</artifactId><version>1</version></parent>
+			<artifactId>app</artifactId>
+			<dependencies>` +
+			dep("org.example:log:${log.version}", "") +
+			dep("org.example:util", "") +
+			dep("org.example:http:${project.version}", "<exclusions><exclusion><groupId>org.example</groupId><artifactId>codec</artifactId></exclusion></exclusions>") +
+			dep("org.example:junit:4", "<scope>test</scope>") +
+			dep("org.example:servlet:3", "<scope>provided</scope>") +
+			dep("org.example:extra:1", "<optional>true</optional>") +
+			dep("org.example:driver:1", "<scope>runtime</scope>") +
+			`</dependencies>`,
+		"org.example:log:2.0":  `<dependencies>` + dep("org.example:util:1.0", "") + `</dependencies>`,
+		"org.example:log:1.0":  ``,
+		"org.example:util:3.0": ``,
+		"org.example:util:1.0": ``,
+		"org.example:http:1":   `<dependencies>` + dep("org.example:codec:1", "") + dep("org.example:log:1.0", "") + `</dependencies>`,
+		"org.example:codec:1":  ``,
+		"org.example:junit:4":  ``,
+		"org.example:extra:1":  ``,
+		"org.example:driver:1": ``,
+	})
+	r := &Resolver{Repositories: []string{repoURL}, Local: t.TempDir()}
+	artifacts, err := r.Resolve(context.Background(), []Coord{{GroupID: "org.example", ArtifactID: "app", Version: "1", Type: "jar"}})
+	if err != nil {
+		t.Fatalf("Resolve() error = %v", err)
+	}
+	var got []string
+	for _, a := range artifacts {
+		got = append(got, a.Coords)
+		if _, err := os.Stat(r.File(a)); err != nil || a.Repository != repoURL || len(a.SHA256) != 64 {
+			t.Errorf("artifact %+v not in the local repository", a)
+		}
+	}
+	want := []string{"org.example:app:1", "org.example:log:2.0", "org.example:util:3.0", "org.example:http:1", "org.example:driver:1"}
+	if !slices.Equal(got, want) {
+		t.Errorf("Resolve() = %q, want %q", got, want)
+	}
+	if _, err := os.Stat(filepath.Join(r.Local, "org", "example", "app", "1", "app-1.pom")); err != nil {
+		t.Errorf("POM not cached in the ~/.m2 layout: %v", err)
+	}
+
+	// The local repository is enough once resolved
+	offline := &Resolver{Repositories: []string{"file:///nonexistent"}, Local: r.Local}
+	if err := offline.Install(context.Background(), artifacts); err != nil {
+		t.Errorf("Install() from the local repository error = %v", err)
+	}
+	os.WriteFile(r.File(artifacts[0]), []byte("tampered"), 0644)
+	if err := offline.Install(context.Background(), artifacts); err == nil || !strings.Contains(err.Error(), "does not match") {
+		t.Errorf("Install() of a modified jar error = %v, want a hash mismatch", err)
+	}
+	os.Remove(r.File(artifacts[0]))
+	if err := offline.Install(context.Background(), artifacts); err != nil {
+		t.Errorf("Install() of a missing jar from its recorded repository error = %v", err)
+	}
+}
+
+func TestResolveMissing(t *testing.T) {
+	r := &Resolver{Repositories: []string{repo(t, nil)}, Local: t.TempDir()}
+	_, err := r.Resolve(context.Background(), []Coord{{GroupID: "org.example", ArtifactID: "nope", Version: "1", Type: "jar"}})
+	if err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("Resolve() error = %v, want not found", err)
+	}
+}
+
+func TestFetchChecksum(t *testing.T) {
+	jar := []byte("jar")
+	h := sha1.Sum(jar)
+	good := hex.EncodeToString(h[:])
+	tests := []struct {
+		name    string
+		status  int
+		sum     string
+		wantErr bool
+	}{
+		{"matching", http.StatusOK, good + "  lib-1.jar\n", false},
+		{"no checksum", http.StatusNotFound, "", false},
+		{"mismatch", http.StatusOK, strings.Repeat("0", 40), true},
+		{"empty", http.StatusOK, "\n", true},
+		{"unreadable", http.StatusInternalServerError, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if strings.HasSuffix(r.URL.Path, ".sha1") {
+					w.WriteHeader(tt.status)
+					w.Write([]byte(tt.sum))
+					return
+				}
+				w.Write(jar)
+			}))
+			defer srv.Close()
+			r := &Resolver{Repositories: []string{srv.URL}, Local: t.TempDir()}
+			local, _, err := r.fetch(context.Background(), "org/example/lib/1/lib-1.jar")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("fetch() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if _, statErr := os.Stat(filepath.Join(r.Local, "org", "example", "lib", "1", "lib-1.jar")); (statErr == nil) != (err == nil) {
+				t.Errorf("fetch() = %q, %v; a rejected jar must not reach the local repository", local, err)
+			}
+		})
+	}
+}
+
+func TestLock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.gjg.lock")
+	if l, err := ReadLock(path); l != nil || err != nil {
+		t.Fatalf("ReadLock() of a missing file = %v, %v", l, err)
+	}
+	want := &Lock{Inputs: Inputs([]string{"a:b:1"}, nil), Artifacts: []Artifact{{Coords: "a:b:1", Path: "a/b/1/b-1.jar", SHA256: "00"}}}
+	if err := want.Write(path); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ReadLock(path)
+	if err != nil || got.Inputs != want.Inputs || !slices.Equal(got.Artifacts, want.Artifacts) {
+		t.Errorf("ReadLock() = %+v, %v; want %+v", got, err, want)
+	}
+	if Inputs([]string{"a:b:1"}, nil) == Inputs([]string{"a:b:2"}, nil) {
+		t.Error("Inputs() does not change with the dependencies")
+	}
+}
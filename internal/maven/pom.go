@@ -0,0 +1,122 @@
+package maven
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strings"
+)
+
+// pom is the subset of a Maven POM that dependency resolution reads.
+type pom struct {
+	GroupID    string  `xml:"groupId"`
+	ArtifactID string  `xml:"artifactId"`
+	Version    string  `xml:"version"`
+	Parent     *parent `xml:"parent"`
+	Properties props   `xml:"properties"`
+	Managed    []dep   `xml:"dependencyManagement>dependencies>dependency"`
+	Deps       []dep   `xml:"dependencies>dependency"`
+}
+
+type parent struct {
+	GroupID    string `xml:"groupId"`
+	ArtifactID string `xml:"artifactId"`
+	Version    string `xml:"version"`
+}
+
+type dep struct {
+	GroupID    string      `xml:"groupId"`
+	ArtifactID string      `xml:"artifactId"`
+	Version    string      `xml:"version"`
+	Type       string      `xml:"type"`
+	Classifier string      `xml:"classifier"`
+	Scope      string      `xml:"scope"`
+	Optional   string      `xml:"optional"`
+	Exclusions []exclusion `xml:"exclusions>exclusion"`
+}
+
+type exclusion struct {
+	GroupID    string `xml:"groupId"`
+	ArtifactID string `xml:"artifactId"`
+}
+
+// matches reports whether the exclusion covers groupID:artifactID; either
+// part may be the * wildcard.
+func (e exclusion) matches(groupID, artifactID string) bool {
+	return (e.GroupID == "*" || e.GroupID == groupID) && (e.ArtifactID == "*" || e.ArtifactID == artifactID)
+}
+
+// props collects the <properties> elements by name.
+type props map[string]string
+
+func (p *props) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	*p = props{}
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			return err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			var v string
+			if err := d.DecodeElement(&v, &t); err != nil {
+				return err
+			}
+			(*p)[t.Name.Local] = strings.TrimSpace(v)
+		case xml.EndElement:
+			return nil
+		}
+	}
+}
+
+func parsePOM(data []byte) (*pom, error) {
+	var p pom
+	if err := xml.Unmarshal(data, &p); err != nil {
+		return nil, fmt.Errorf("invalid POM: %w", err)
+	}
+	return &p, nil
+}
+
+// managedKey identifies a dependency in dependencyManagement.
+func (d dep) managedKey() string {
+	return d.GroupID + ":" + d.ArtifactID + ":" + d.extType() + ":" + d.Classifier
+}
+
+func (d dep) extType() string {
+	if d.Type == "" {
+		return "jar"
+	}
+	return d.Type
+}
+
+// interpolate replaces ${name} references with properties, leaving unknown
+// ones in place.
+func interpolate(s string, p props) string {
+	for range 10 {
+		start := strings.Index(s, "${")
+		if start < 0 {
+			return s
+		}
+		end := strings.Index(s[start:], "}")
+		if end < 0 {
+			return s
+		}
+		name := s[start+2 : start+end]
+		v, ok := p[name]
+		if !ok {
+			return s
+		}
+		s = s[:start] + v + s[start+end+1:]
+	}
+	return s
+}
+
+func (d dep) interpolate(p props) dep {
+	d.GroupID = interpolate(strings.TrimSpace(d.GroupID), p)
+	d.ArtifactID = interpolate(strings.TrimSpace(d.ArtifactID), p)
+	d.Version = interpolate(strings.TrimSpace(d.Version), p)
+	d.Type = interpolate(strings.TrimSpace(d.Type), p)
+	d.Classifier = interpolate(strings.TrimSpace(d.Classifier), p)
+	d.Scope = interpolate(strings.TrimSpace(d.Scope), p)
+	d.Optional = interpolate(strings.TrimSpace(d.Optional), p)
+	return d
+}
@@ -0,0 +1,237 @@
+package maven
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"gjg/internal/fsutil"
+	"gjg/internal/lockfile"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+)
+
+// model is a POM with its parents, properties and imported BOMs applied.
+type model struct {
+	props   props
+	managed map[string]dep
+	deps    []dep
+}
+
+// load returns the effective model of c's POM. A missing POM has no
+// dependencies, as in Maven.
+func (r *Resolver) load(ctx context.Context, c Coord, seen []string) (*model, error) {
+	id := c.GroupID + ":" + c.ArtifactID + ":" + c.Version
+	if m, ok := r.models[id]; ok {
+		return m, nil
+	}
+	if slices.Contains(seen, id) {
+		return nil, fmt.Errorf("POM cycle: %v", append(seen, id))
+	}
+	seen = append(seen, id)
+
+	file, _, err := r.fetch(ctx, c.pomPath())
+	if errors.Is(err, errNotFound) {
+		m := &model{props: props{}, managed: map[string]dep{}}
+		r.models[id] = m
+		return m, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	p, err := parsePOM(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", c, err)
+	}
+
+	m := &model{props: props{}, managed: map[string]dep{}}
+	groupID, version := p.GroupID, p.Version
+	if p.Parent != nil {
+		pc := Coord{GroupID: p.Parent.GroupID, ArtifactID: p.Parent.ArtifactID, Version: p.Parent.Version, Type: "pom"}
+		parent, err := r.load(ctx, pc, seen)
+		if err != nil {
+			return nil, fmt.Errorf("parent of %s: %w", c, err)
+		}
+		maps.Copy(m.props, parent.props)
+		maps.Copy(m.managed, parent.managed)
+		m.deps = slices.Clone(parent.deps)
+		m.props["project.parent.groupId"] = pc.GroupID
+		m.props["project.parent.version"] = pc.Version
+		if groupID == "" {
+			groupID = pc.GroupID
+		}
+		if version == "" {
+			version = pc.Version
+		}
+	}
+	maps.Copy(m.props, p.Properties)
+	for _, k := range []string{"project.", "pom.", ""} {
+		m.props[k+"groupId"] = groupID
+		m.props[k+"artifactId"] = p.ArtifactID
+		m.props[k+"version"] = version
+	}
+
+	for _, d := range p.Managed {
+		d = d.interpolate(m.props)
+		if d.Scope == "import" && d.Type == "pom" {
+			bom, err := r.load(ctx, Coord{GroupID: d.GroupID, ArtifactID: d.ArtifactID, Version: d.Version, Type: "pom"}, seen)
+			if err != nil {
+				return nil, fmt.Errorf("BOM imported by %s: %w", c, err)
+			}
+			for k, v := range bom.managed {
+				if _, ok := m.managed[k]; !ok {
+					m.managed[k] = v
+				}
+			}
+			continue
+		}
+		m.managed[d.managedKey()] = d
+	}
+	for _, d := range p.Deps {
+		m.deps = append(m.deps, d.interpolate(m.props))
+	}
+	r.models[id] = m
+	return m, nil
+}
+
+// node is a dependency waiting to be resolved, with the exclusions of its path.
+type node struct {
+	coord      Coord
+	exclusions []exclusion
+}
+
+// Resolve returns the jars deps need, direct dependencies first, then
+// transitive ones breadth-first. Of several versions of an artifact the
+// nearest wins, and at equal depth the first declared, as in Maven. Test,
+// provided and system scopes and optional dependencies are left out.
+func (r *Resolver) Resolve(ctx context.Context, deps []Coord) ([]Artifact, error) {
+	lock, err := r.lock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer lock.Release()
+	r.models = map[string]*model{}
+	queue := make([]node, 0, len(deps))
+	for _, c := range deps {
+		queue = append(queue, node{coord: c})
+	}
+	seen := map[string]bool{}
+	var out []Artifact
+	for len(queue) > 0 {
+		n := queue[0]
+		queue = queue[1:]
+		if seen[n.coord.key()] {
+			continue
+		}
+		seen[n.coord.key()] = true
+		if err := checkVersion(n.coord); err != nil {
+			return nil, err
+		}
+
+		m, err := r.load(ctx, n.coord, nil)
+		if err != nil {
+			return nil, err
+		}
+		if n.coord.Type == "jar" {
+			a, err := r.artifact(ctx, n.coord)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, a)
+		}
+
+		for _, d := range m.deps {
+			if mg, ok := m.managed[d.managedKey()]; ok {
+				if d.Version == "" {
+					d.Version = mg.Version
+				}
+				if d.Scope == "" {
+					d.Scope = mg.Scope
+				}
+				d.Exclusions = append(d.Exclusions, mg.Exclusions...)
+			}
+			switch d.Scope {
+			case "", "compile", "runtime":
+			default:
+				continue
+			}
+			if d.Optional == "true" || excluded(d, n.exclusions) {
+				continue
+			}
+			c := Coord{GroupID: d.GroupID, ArtifactID: d.ArtifactID, Version: d.Version, Classifier: d.Classifier}
+			switch d.extType() {
+			case "jar", "bundle":
+				c.Type = "jar"
+			case "pom":
+				c.Type = "pom"
+			default:
+				return nil, fmt.Errorf("%s depends on %s of unsupported type %s", n.coord, c, d.Type)
+			}
+			queue = append(queue, node{coord: c, exclusions: slices.Concat(n.exclusions, d.Exclusions)})
+		}
+	}
+	return out, nil
+}
+
+func excluded(d dep, exclusions []exclusion) bool {
+	for _, e := range exclusions {
+		if e.matches(d.GroupID, d.ArtifactID) {
+			return true
+		}
+	}
+	return false
+}
+
+// artifact fetches the jar of c.
+func (r *Resolver) artifact(ctx context.Context, c Coord) (Artifact, error) {
+	file, repo, err := r.fetch(ctx, c.jarPath())
+	if err != nil {
+		return Artifact{}, fmt.Errorf("%s: %w", c, err)
+	}
+	sum, err := fsutil.SHA256(file)
+	if err != nil {
+		return Artifact{}, err
+	}
+	return Artifact{Coords: c.String(), Path: c.jarPath(), SHA256: sum, Repository: repo}, nil
+}
+
+// Install makes sure the locked artifacts are in the local repository,
+// downloading missing ones, and that they match their recorded SHA-256.
+func (r *Resolver) Install(ctx context.Context, artifacts []Artifact) error {
+	lock, err := r.lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer lock.Release()
+	for _, a := range artifacts {
+		file := r.File(a)
+		if _, err := os.Stat(file); err != nil {
+			rs := *r
+			if a.Repository != "" {
+				rs.Repositories = append([]string{a.Repository}, r.Repositories...)
+			}
+			if file, _, err = rs.fetch(ctx, a.Path); err != nil {
+				return fmt.Errorf("%s: %w", a.Coords, err)
+			}
+		}
+		sum, err := fsutil.SHA256(file)
+		if err != nil {
+			return err
+		}
+		if sum != a.SHA256 {
+			return fmt.Errorf("%s: %s does not match the lock file (sha256 %s, want %s)", a.Coords, filepath.Base(file), sum, a.SHA256)
+		}
+	}
+	return nil
+}
+
+// lock keeps concurrent launches from writing the same files of the local
+// repository.
+func (r *Resolver) lock(ctx context.Context) (*lockfile.Lock, error) {
+	return lockfile.Acquire(ctx, filepath.Join(r.Local, ".gjg.lock"))
+}
@@ -0,0 +1,136 @@
+package paths
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// ExeName returns the launcher executable base name without extension.
+func ExeName() string {
+	exePath, err := os.Executable()
+	if err != nil {
+		return "gjg"
+	}
+	return BaseName(exePath)
+}
+
+// BaseName returns the base name of exe without extension.
+func BaseName(exe string) string {
+	name := filepath.Base(exe)
+	return strings.TrimSuffix(name, filepath.Ext(name))
+}
+
+// AppCacheDir returns the per-app directory for logs, history and caches:
+// <user dir>/gjg/<exe-name>, see userDir. The directory is not created, but
+// one left in the user cache directory by earlier launchers is moved there.
+func AppCacheDir() (string, error) {
+	return cacheDir(ExeName())
+}
+
+// CacheDirFor returns the per-app cache directory of the launcher at exe.
+func CacheDirFor(exe string) (string, error) {
+	return cacheDir(BaseName(exe))
+}
+
+func cacheDir(name string) (string, error) {
+	dir, err := userDir()
+	if err != nil {
+		return "", err
+	}
+	dir = filepath.Join(dir, "gjg", name)
+	if cache, err := os.UserCacheDir(); err == nil {
+		return moveLegacy(filepath.Join(cache, "gjg", name), dir), nil
+	}
+	return dir, nil
+}
+
+// moveLegacy moves the per-app directory that launchers before the XDG
+// state layout kept at old to dir, unless dir already exists. If the move
+// fails, for example because the two are on different file systems, old
+// stays in use so that its logs and history are not left behind.
+func moveLegacy(old, dir string) string {
+	if old == dir {
+		return dir
+	}
+	if _, err := os.Lstat(dir); err == nil {
+		return dir
+	}
+	if fi, err := os.Lstat(old); err != nil || !fi.IsDir() {
+		return dir
+	}
+	if err := os.MkdirAll(filepath.Dir(dir), 0755); err == nil {
+		os.Rename(old, dir)
+	}
+	if _, err := os.Lstat(dir); err == nil {
+		// Moved, possibly by a concurrent launch
+		return dir
+	}
+	return old
+}
+
+// RuntimesDir returns the per-user directory of Java runtimes downloaded for
+// java_download, shared by all apps: <user cache dir>/gjg-runtimes. It is
+// outside <user dir>/gjg so that it cannot clash with an app's directory.
+func RuntimesDir() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "gjg-runtimes"), nil
+}
+
+// MavenDir returns the per-user local repository of dependency jars, shared
+// by all apps and laid out like ~/.m2/repository: <user cache dir>/gjg-maven.
+func MavenDir() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "gjg-maven"), nil
+}
+
+// MachineDir returns a directory for name shared by all users of the
+// machine: %ProgramData%\gjg\<name> on Windows, where the temp directory is
+// per-user, and <temp dir>/gjg-<name> elsewhere. It is not created.
+func MachineDir(name string) string {
+	if runtime.GOOS == "windows" {
+		base := os.Getenv("ProgramData")
+		if !filepath.IsAbs(base) {
+			base = `C:\ProgramData`
+		}
+		return filepath.Join(base, "gjg", name)
+	}
+	return filepath.Join(os.TempDir(), "gjg-"+name)
+}
+
+// userDir is the user cache directory (%LocalAppData% on Windows,
+// ~/Library/Caches on macOS). On Linux and other XDG systems, where logs and
+// history are state rather than cache, it is $XDG_STATE_HOME, by default
+// ~/.local/state.
+func userDir() (string, error) {
+	switch runtime.GOOS {
+	case "windows", "darwin", "ios", "plan9", "android":
+		return os.UserCacheDir()
+	}
+	if dir := os.Getenv("XDG_STATE_HOME"); filepath.IsAbs(dir) {
+		return dir, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".local", "state"), nil
+}
+
+// BundleContents returns the Contents directory of the macOS application
+// bundle exe is in (Name.app/Contents/MacOS/exe), if it is in one.
+func BundleContents(exe string) (string, bool) {
+	macOS := filepath.Dir(exe)
+	contents := filepath.Dir(macOS)
+	if filepath.Base(macOS) != "MacOS" || filepath.Base(contents) != "Contents" || filepath.Ext(filepath.Dir(contents)) != ".app" {
+		return "", false
+	}
+	return contents, true
+}
@@ -0,0 +1,55 @@
+package paths
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestCacheDirMovesLegacy(t *testing.T) {
+	if runtime.GOOS == "windows" || runtime.GOOS == "darwin" {
+		t.Skip("the per-app directory is still in the user cache directory")
+	}
+	root := t.TempDir()
+	t.Setenv("XDG_CACHE_HOME", filepath.Join(root, "cache"))
+	t.Setenv("XDG_STATE_HOME", filepath.Join(root, "state"))
+	old := filepath.Join(root, "cache", "gjg", "myapp")
+	if err := os.MkdirAll(old, 0755); err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(filepath.Join(old, "history.jsonl"), []byte("{}\n"), 0644)
+
+	want := filepath.Join(root, "state", "gjg", "myapp")
+	for range 2 {
+		dir, err := CacheDirFor(filepath.Join(root, "app", "myapp"))
+		if err != nil || dir != want {
+			t.Fatalf("CacheDirFor() = %q, %v; want %q", dir, err, want)
+		}
+		if _, err := os.Stat(filepath.Join(dir, "history.jsonl")); err != nil {
+			t.Errorf("history not moved: %v", err)
+		}
+	}
+	if _, err := os.Stat(old); !os.IsNotExist(err) {
+		t.Errorf("old directory still exists: %v", err)
+	}
+}
+
+func TestCacheDirKeepsUnmovableLegacy(t *testing.T) {
+	if runtime.GOOS == "windows" || runtime.GOOS == "darwin" {
+		t.Skip("the per-app directory is still in the user cache directory")
+	}
+	root := t.TempDir()
+	// A regular file where the state directory should be blocks the move
+	os.WriteFile(filepath.Join(root, "state"), nil, 0644)
+	t.Setenv("XDG_CACHE_HOME", filepath.Join(root, "cache"))
+	t.Setenv("XDG_STATE_HOME", filepath.Join(root, "state"))
+	old := filepath.Join(root, "cache", "gjg", "myapp")
+	if err := os.MkdirAll(old, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if dir, err := CacheDirFor("myapp"); err != nil || dir != old {
+		t.Errorf("CacheDirFor() = %q, %v; want the old %q", dir, err, old)
+	}
+}
@@ -0,0 +1,32 @@
+package perm
+
+import "path/filepath"
+
+// Checker tells whether users other than the owner (and administrators) can
+// modify a file or directory.
+type Checker interface {
+	WritableByOthers(path string) (bool, error)
+}
+
+// Default is the checker of the current platform.
+var Default Checker = platformChecker{}
+
+// Insecure returns those of paths, or their parent directories, that others
+// can modify. A writable directory lets others replace the file in it.
+// Paths that cannot be checked are skipped.
+func Insecure(c Checker, paths ...string) []string {
+	var out []string
+	seen := map[string]bool{}
+	for _, p := range paths {
+		for _, candidate := range []string{p, filepath.Dir(p)} {
+			if seen[candidate] {
+				continue
+			}
+			seen[candidate] = true
+			if writable, err := c.WritableByOthers(candidate); err == nil && writable {
+				out = append(out, candidate)
+			}
+		}
+	}
+	return out
+}
@@ -0,0 +1,35 @@
+package perm
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+type fakeChecker map[string]bool
+
+func (f fakeChecker) WritableByOthers(path string) (bool, error) {
+	return f[path], nil
+}
+
+func TestInsecure(t *testing.T) {
+	app := filepath.Join("opt", "app")
+	conf := filepath.Join(app, "app.gjg.conf")
+	jar := filepath.Join(app, "app.jar")
+	tests := []struct {
+		name    string
+		checker fakeChecker
+		want    []string
+	}{
+		{"all private", fakeChecker{}, nil},
+		{"writable jar", fakeChecker{jar: true}, []string{jar}},
+		{"writable folder reported once", fakeChecker{app: true}, []string{app}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Insecure(tt.checker, conf, jar); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Insecure() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
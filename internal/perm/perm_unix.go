@@ -0,0 +1,24 @@
+//go:build !windows
+
+package perm
+
+import (
+	"io/fs"
+	"os"
+)
+
+type platformChecker struct{}
+
+// WritableByOthers reports group- or world-writable files, and such
+// directories unless the sticky bit stops others from replacing entries.
+func (platformChecker) WritableByOthers(path string) (bool, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return false, err
+	}
+	mode := info.Mode()
+	if mode.IsDir() && mode&fs.ModeSticky != 0 {
+		return false, nil
+	}
+	return mode.Perm()&0o022 != 0, nil
+}
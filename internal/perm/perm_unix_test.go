@@ -0,0 +1,44 @@
+//go:build !windows
+
+package perm
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWritableByOthers(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "app.gjg.conf")
+	if err := os.WriteFile(file, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		path string
+		mode os.FileMode
+		want bool
+	}{
+		{"private file", file, 0644, false},
+		{"world-writable file", file, 0666, true},
+		{"group-writable file", file, 0664, true},
+		{"private dir", dir, 0755, false},
+		{"world-writable dir", dir, 0777, true},
+		{"sticky dir", dir, 0777 | os.ModeSticky, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := os.Chmod(tt.path, tt.mode); err != nil {
+				t.Fatal(err)
+			}
+			got, err := Default.WritableByOthers(tt.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("WritableByOthers(%s) = %v, want %v", tt.mode, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,88 @@
+package perm
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+var (
+	advapi32                  = syscall.NewLazyDLL("advapi32.dll")
+	procGetNamedSecurityInfoW = advapi32.NewProc("GetNamedSecurityInfoW")
+	procGetAce                = advapi32.NewProc("GetAce")
+)
+
+const (
+	seFileObject            = 1
+	daclSecurityInformation = 0x4
+	accessAllowedAceType    = 0
+	inheritOnlyAce          = 0x8
+
+	// FILE_WRITE_DATA/ADD_FILE, FILE_APPEND_DATA/ADD_SUBDIRECTORY,
+	// FILE_DELETE_CHILD, DELETE, WRITE_DAC, WRITE_OWNER, GENERIC_ALL, GENERIC_WRITE
+	writeRights = 0x2 | 0x4 | 0x40 | 0x10000 | 0x40000 | 0x80000 | 0x10000000 | 0x40000000
+)
+
+// broadSIDs are groups every local user belongs to: Everyone, Authenticated
+// Users, Interactive and BUILTIN\Users.
+var broadSIDs = map[string]bool{
+	"S-1-1-0":      true,
+	"S-1-5-11":     true,
+	"S-1-5-4":      true,
+	"S-1-5-32-545": true,
+}
+
+type acl struct {
+	revision byte
+	sbz1     byte
+	size     uint16
+	aceCount uint16
+	sbz2     uint16
+}
+
+type accessAllowedAce struct {
+	aceType  byte
+	aceFlags byte
+	aceSize  uint16
+	mask     uint32
+	sidStart uint32
+}
+
+type platformChecker struct{}
+
+// WritableByOthers reports files whose DACL grants write access to a group
+// every local user belongs to. Deny entries are not evaluated, so the result
+// errs on the side of warning.
+func (platformChecker) WritableByOthers(path string) (bool, error) {
+	p, err := syscall.UTF16PtrFromString(path)
+	if err != nil {
+		return false, err
+	}
+	var dacl *acl
+	var sd syscall.Handle
+	r, _, _ := procGetNamedSecurityInfoW.Call(
+		uintptr(unsafe.Pointer(p)), seFileObject, daclSecurityInformation,
+		0, 0, uintptr(unsafe.Pointer(&dacl)), 0, uintptr(unsafe.Pointer(&sd)))
+	if r != 0 {
+		return false, syscall.Errno(r)
+	}
+	defer syscall.LocalFree(sd)
+
+	// A NULL DACL grants everyone full access
+	if dacl == nil {
+		return true, nil
+	}
+	for i := 0; i < int(dacl.aceCount); i++ {
+		var ace *accessAllowedAce
+		if r, _, err := procGetAce.Call(uintptr(unsafe.Pointer(dacl)), uintptr(i), uintptr(unsafe.Pointer(&ace))); r == 0 {
+			return false, err
+		}
+		if ace.aceType != accessAllowedAceType || ace.aceFlags&inheritOnlyAce != 0 || ace.mask&writeRights == 0 {
+			continue
+		}
+		sid := (*syscall.SID)(unsafe.Pointer(&ace.sidStart))
+		if s, err := sid.String(); err == nil && broadSIDs[s] {
+			return true, nil
+		}
+	}
+	return false, nil
+}
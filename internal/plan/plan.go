@@ -0,0 +1,344 @@
+package plan
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gjg/internal/args"
+	"gjg/internal/config"
+	"gjg/internal/hooks"
+	"gjg/internal/instance"
+	"gjg/internal/manifest"
+	"gjg/internal/redact"
+	"gjg/internal/runner"
+	"gjg/internal/signature"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// SchemaVersion is the version of the LaunchPlan JSON format. It is bumped
+// when a field is removed or changes meaning; new optional fields keep it.
+const SchemaVersion = 1
+
+// LaunchPlan is everything the launcher needs to start and supervise Java,
+// resolved from the configuration before anything is executed.
+type LaunchPlan struct {
+	SchemaVersion int `json:"schemaVersion"`
+	// Profile is the configuration name, e.g. "myapp" for myapp.gjg.conf.
+	Profile    string   `json:"profile,omitempty"`
+	Executable string   `json:"executable"`
+	Argv       []string `json:"argv"`
+	// ForwardArgs are the command-line arguments included at the end of Argv.
+	ForwardArgs    []string       `json:"forwardArgs"`
+	Env            []string       `json:"env"`
+	WorkDir        string         `json:"workDir"`
+	Restart        Restart        `json:"restart"`
+	HeapFallback   []string       `json:"heapFallback"`
+	Console        Console        `json:"console"`
+	SingleInstance SingleInstance `json:"singleInstance"`
+	Hooks          Hooks          `json:"hooks"`
+	Verify         Verify         `json:"verify"`
+	// Exec lets Java replace the launcher when nothing needs supervising.
+	Exec   runner.ExecMode `json:"exec,omitempty"`
+	Update Update          `json:"update"`
+	// Versions is the version of a versioned layout the plan runs.
+	Versions Versions `json:"versions"`
+	LogFile  string   `json:"logFile"`
+	Redact   []string `json:"redact"`
+	// Redacted is set on exported plans whose secret values were masked.
+	Redacted bool `json:"redacted,omitempty"`
+}
+
+// Restart is the supervisor policy.
+type Restart struct {
+	Mode      runner.RestartMode `json:"mode"`
+	ExitCodes []int              `json:"exitCodes"`
+	Max       int                `json:"max"`
+	Window    Duration           `json:"window"`
+	Delay     Duration           `json:"delay"`
+	MaxDelay  Duration           `json:"maxDelay"`
+}
+
+// Console is where the child's output is captured.
+type Console struct {
+	StdoutLog  string `json:"stdoutLog"`
+	StderrLog  string `json:"stderrLog"`
+	MaxSize    int64  `json:"maxSize"`
+	Keep       int    `json:"keep"`
+	Timestamps bool   `json:"timestamps"`
+}
+
+// SingleInstance is the single-instance scope and policy.
+type SingleInstance struct {
+	Scope  instance.Scope  `json:"scope"`
+	Policy instance.Policy `json:"policy"`
+	Inbox  string          `json:"inbox"`
+}
+
+// Hooks are the pre-launch and post-exit commands.
+type Hooks struct {
+	PreLaunch []string        `json:"preLaunch"`
+	PostExit  []string        `json:"postExit"`
+	OnFailure hooks.OnFailure `json:"onFailure"`
+	Timeout   Duration        `json:"timeout"`
+}
+
+// Verify is the integrity check run before Java starts.
+type Verify struct {
+	Mode     manifest.Mode `json:"mode"`
+	Full     bool          `json:"full"`
+	Manifest string        `json:"manifest"`
+}
+
+// Update is where updates come from. Dir is the installation directory the
+// update artifacts are relative to. An empty URL disables updates.
+type Update struct {
+	URL      string   `json:"url,omitempty"`
+	Interval Duration `json:"interval"`
+	Timeout  Duration `json:"timeout"`
+	Dir      string   `json:"dir,omitempty"`
+}
+
+// Versions names the version folder the plan runs, which is kept from
+// being pruned while it runs. Both are empty without versions_dir.
+type Versions struct {
+	Dir      string `json:"dir,omitempty"`
+	Selected string `json:"selected,omitempty"`
+}
+
+// Duration is a time.Duration written as a Go duration string such as "1m0s".
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// Build resolves cfg into a launch plan. forwardArgs are appended to the
+// application arguments. The Java download, JNLP application and
+// dependencies cfg names must have been resolved.
+func Build(cfg *config.Config, confPath string, forwardArgs []string) (*LaunchPlan, error) {
+	if err := unresolved(cfg); err != nil {
+		return nil, err
+	}
+	argv := Argv(cfg, forwardArgs)
+	p := &LaunchPlan{
+		SchemaVersion: SchemaVersion,
+		Profile:       strings.TrimSuffix(filepath.Base(confPath), ".gjg.conf"),
+		Executable:    argv[0],
+		Argv:          argv,
+		ForwardArgs:   nonNil(forwardArgs),
+		Env:           slices.Clone(cfg.Env),
+		WorkDir:       filepath.Dir(confPath),
+		Restart: Restart{
+			Mode:      runner.RestartMode(cfg.Restart.Mode),
+			ExitCodes: nonNil(cfg.Restart.ExitCodes),
+			Max:       cfg.Restart.Max,
+			Window:    Duration(cfg.Restart.Window),
+			Delay:     Duration(cfg.Restart.Delay),
+			MaxDelay:  Duration(cfg.Restart.MaxDelay),
+		},
+		HeapFallback: nonNil(cfg.HeapFallback),
+		Console: Console{
+			StdoutLog:  cfg.Console.StdoutLog,
+			StderrLog:  cfg.Console.StderrLog,
+			MaxSize:    cfg.Console.MaxSize,
+			Keep:       cfg.Console.Keep,
+			Timestamps: cfg.Console.Timestamps,
+		},
+		SingleInstance: SingleInstance{
+			Scope:  instance.Scope(cfg.SingleInstance.Scope),
+			Policy: instance.Policy(cfg.SingleInstance.Policy),
+			Inbox:  cfg.SingleInstance.Inbox,
+		},
+		Hooks: Hooks{
+			PreLaunch: nonNil(cfg.Hooks.PreLaunch),
+			PostExit:  nonNil(cfg.Hooks.PostExit),
+			OnFailure: hooks.OnFailure(cfg.Hooks.OnFailure),
+			Timeout:   Duration(cfg.Hooks.Timeout),
+		},
+		Verify: Verify{
+			Mode:     manifest.Mode(cfg.Verify.Mode),
+			Full:     cfg.Verify.Full,
+			Manifest: cfg.Verify.Manifest,
+		},
+		Exec: runner.ExecMode(cfg.Exec),
+		Update: Update{
+			URL:      cfg.Update.URL,
+			Interval: Duration(cfg.Update.Interval),
+			Timeout:  Duration(cfg.Update.Timeout),
+			Dir:      filepath.Dir(confPath),
+		},
+		Versions: Versions{
+			Dir:      cfg.Versions.Dir,
+			Selected: cfg.Versions.Selected,
+		},
+		LogFile: cfg.LogFile,
+		Redact:  nonNil(cfg.Redact),
+	}
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	if p.SingleInstance.Scope != instance.ScopeOff && p.SingleInstance.Policy == instance.PolicyForward {
+		p.Env = append(p.Env, "GJG_INSTANCE_INBOX="+p.SingleInstance.Inbox)
+	}
+	return p, nil
+}
+
+// unresolved reports what cfg names but the launcher has not fetched yet,
+// without which the command line would be incomplete.
+func unresolved(cfg *config.Config) error {
+	switch {
+	case cfg.JavaDownload.Pending:
+		return fmt.Errorf("java runtime %s is not downloaded yet (%s)", cfg.JavaDownload.Version, cfg.JavaDownload.URL)
+	case cfg.JNLP.Source != "" && !cfg.JNLP.Resolved:
+		return fmt.Errorf("JNLP application %s is not resolved yet", cfg.JNLP.Source)
+	case len(cfg.Maven.Dependencies) > 0 && !cfg.Maven.Resolved:
+		return errors.New("dependencies are not resolved yet")
+	}
+	return nil
+}
+
+// Argv assembles the java command line from the configuration: -jar, or
+// -cp and the main class when the configuration has one.
+func Argv(cfg *config.Config, forwardArgs []string) []string {
+	jvmTokens := args.Tokenize(cfg.JVMArgs)
+	appTokens := args.Tokenize(cfg.AppArgs)
+
+	argv := make([]string, 0, 4+len(cfg.JNLP.JVMArgs)+len(jvmTokens)+len(cfg.JNLP.AppArgs)+len(appTokens)+len(forwardArgs))
+	argv = append(argv, cfg.JavaExecutableAbsolutePath)
+	argv = append(argv, cfg.JNLP.JVMArgs...)
+	argv = append(argv, jvmTokens...)
+	if cfg.MainClass != "" {
+		argv = append(argv, "-cp", strings.Join(cfg.Classpath, string(os.PathListSeparator)), cfg.MainClass)
+	} else {
+		argv = append(argv, "-jar", cfg.JarFileAbsolutePath)
+	}
+	argv = append(argv, cfg.JNLP.AppArgs...)
+	argv = append(argv, appTokens...)
+	argv = append(argv, forwardArgs...)
+	return argv
+}
+
+// Validate checks that p can be executed by this launcher.
+func (p *LaunchPlan) Validate() error {
+	if p.SchemaVersion != SchemaVersion {
+		return fmt.Errorf("unsupported plan schema version %d (expected %d)", p.SchemaVersion, SchemaVersion)
+	}
+	if len(p.Argv) == 0 {
+		return errors.New("plan has no argv")
+	}
+	if p.Executable != p.Argv[0] {
+		return fmt.Errorf("plan executable %q does not match argv[0] %q", p.Executable, p.Argv[0])
+	}
+	if _, err := runner.ParseRestartMode(string(p.Restart.Mode)); err != nil {
+		return err
+	}
+	if _, err := instance.ParseScope(string(p.SingleInstance.Scope)); err != nil {
+		return err
+	}
+	if _, err := instance.ParsePolicy(string(p.SingleInstance.Policy)); err != nil {
+		return err
+	}
+	if _, err := hooks.ParseOnFailure(string(p.Hooks.OnFailure)); err != nil {
+		return err
+	}
+	if _, err := manifest.ParseMode(string(p.Verify.Mode)); err != nil {
+		return err
+	}
+	if p.Exec != "" {
+		if _, err := runner.ParseExecMode(string(p.Exec)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RestartPolicy returns the supervisor policy of p.
+func (p *LaunchPlan) RestartPolicy() runner.Policy {
+	return runner.Policy{
+		Mode:             p.Restart.Mode,
+		RestartExitCodes: p.Restart.ExitCodes,
+		MaxRestarts:      p.Restart.Max,
+		Window:           time.Duration(p.Restart.Window),
+		InitialDelay:     time.Duration(p.Restart.Delay),
+		MaxDelay:         time.Duration(p.Restart.MaxDelay),
+	}
+}
+
+// Masked returns a copy of p with secret values masked, for export.
+func (p *LaunchPlan) Masked(r *redact.Redactor) *LaunchPlan {
+	c := *p
+	c.Argv = r.Args(p.Argv)
+	c.ForwardArgs = r.Args(p.ForwardArgs)
+	c.Env = r.Env(p.Env)
+	c.Hooks.PreLaunch = redactAll(r, p.Hooks.PreLaunch)
+	c.Hooks.PostExit = redactAll(r, p.Hooks.PostExit)
+	c.Redacted = c.Redacted || !slices.Equal(c.Argv, p.Argv) || !slices.Equal(c.Env, p.Env) ||
+		!slices.Equal(c.Hooks.PreLaunch, p.Hooks.PreLaunch) || !slices.Equal(c.Hooks.PostExit, p.Hooks.PostExit)
+	return &c
+}
+
+// Write writes p as indented JSON.
+func (p *LaunchPlan) Write(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(p)
+}
+
+// Load reads and validates a plan written by Write. When key is set the plan
+// must carry a valid detached signature.
+func Load(path string, key ed25519.PublicKey) (*LaunchPlan, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read plan: %w", err)
+	}
+	if key != nil {
+		if err := signature.VerifyFile(key, path, data); err != nil {
+			return nil, fmt.Errorf("plan signature check failed: %w", err)
+		}
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	var p LaunchPlan
+	if err := dec.Decode(&p); err != nil {
+		return nil, fmt.Errorf("invalid plan %s: %w", path, err)
+	}
+	if err := p.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid plan %s: %w", path, err)
+	}
+	return &p, nil
+}
+
+func redactAll(r *redact.Redactor, list []string) []string {
+	out := make([]string, len(list))
+	for i, s := range list {
+		out[i] = r.String(s)
+	}
+	return out
+}
+
+func nonNil[T any](s []T) []T {
+	if s == nil {
+		return []T{}
+	}
+	return s
+}
@@ -0,0 +1,224 @@
+package plan
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"gjg/internal/config"
+	"gjg/internal/redact"
+	"gjg/internal/signature"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testConfig() *config.Config {
+	return &config.Config{
+		JavaExecutableAbsolutePath: "/jdk/bin/java",
+		JarFileAbsolutePath:        "/app/app.jar",
+		JVMArgs:                    `-Xmx1g "-Dname=a b"`,
+		AppArgs:                    "--port 8080",
+		Env:                        []string{"PATH=/bin", "API_TOKEN=abc"},
+		Restart:                    config.RestartConfig{Mode: "on-failure", Max: 5, Window: time.Minute, Delay: time.Second, MaxDelay: 30 * time.Second},
+		SingleInstance:             config.SingleInstanceConfig{Scope: "user", Policy: "forward", Inbox: "/cache/inbox.jsonl"},
+		Hooks:                      config.HooksConfig{OnFailure: "abort", Timeout: time.Minute},
+		Verify:                     config.VerifyConfig{Mode: "off", Manifest: "/app/gjg.manifest"},
+	}
+}
+
+func TestBuild(t *testing.T) {
+	p, err := Build(testConfig(), "/app/app.gjg.conf", []string{"--open", "x.txt"})
+	if err != nil {
+		t.Fatalf("Build() error = %v", err)
+	}
+	wantArgv := []string{"/jdk/bin/java", "-Xmx1g", "-Dname=a b", "-jar", "/app/app.jar", "--port", "8080", "--open", "x.txt"}
+	if !reflect.DeepEqual(p.Argv, wantArgv) {
+		t.Errorf("Argv = %q, want %q", p.Argv, wantArgv)
+	}
+	if p.Executable != "/jdk/bin/java" || p.WorkDir != "/app" {
+		t.Errorf("Executable = %q, WorkDir = %q", p.Executable, p.WorkDir)
+	}
+	if last := p.Env[len(p.Env)-1]; last != "GJG_INSTANCE_INBOX=/cache/inbox.jsonl" {
+		t.Errorf("Env does not end with the inbox variable: %q", p.Env)
+	}
+	if got := p.RestartPolicy(); got.Mode != "on-failure" || got.MaxDelay != 30*time.Second {
+		t.Errorf("RestartPolicy() = %+v", got)
+	}
+}
+
+func TestArgvMainClass(t *testing.T) {
+	cfg := testConfig()
+	cfg.MainClass = "com.example.Main"
+	cfg.Classpath = []string{"/cache/app.jar", "/cache/dep.jar"}
+	cfg.JNLP.JVMArgs = []string{"-Xmx512m", "-Dapp.mode=prod"}
+	cfg.JNLP.AppArgs = []string{"--server"}
+
+	cp := "/cache/app.jar" + string(os.PathListSeparator) + "/cache/dep.jar"
+	want := []string{"/jdk/bin/java", "-Xmx512m", "-Dapp.mode=prod", "-Xmx1g", "-Dname=a b", "-cp", cp, "com.example.Main", "--server", "--port", "8080", "x"}
+	if got := Argv(cfg, []string{"x"}); !reflect.DeepEqual(got, want) {
+		t.Errorf("Argv() = %q, want %q", got, want)
+	}
+}
+
+func TestBuildInvalid(t *testing.T) {
+	cfg := testConfig()
+	cfg.Restart.Mode = "sometimes"
+	if _, err := Build(cfg, "/app/app.gjg.conf", nil); err == nil {
+		t.Error("Build() expected error for invalid restart mode")
+	}
+}
+
+func TestBuildUnresolved(t *testing.T) {
+	tests := []struct {
+		name    string
+		change  func(cfg *config.Config)
+		wantErr string
+	}{
+		{"java download", func(cfg *config.Config) {
+			cfg.JavaDownload = config.JavaDownloadConfig{Version: "17", Pending: true}
+		}, "not downloaded"},
+		{"jnlp", func(cfg *config.Config) {
+			cfg.JNLP.Source = "https://example.com/app.jnlp"
+		}, "JNLP application"},
+		{"dependencies", func(cfg *config.Config) {
+			cfg.Maven.Dependencies = []string{"org.example:lib:1.0"}
+		}, "dependencies"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig()
+			tt.change(cfg)
+			if _, err := Build(cfg, "/app/app.gjg.conf", nil); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Build() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestWriteLoad(t *testing.T) {
+	p, err := Build(testConfig(), "/app/app.gjg.conf", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := p.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), `"window": "1m0s"`) {
+		t.Errorf("durations should be written as strings:\n%s", buf.String())
+	}
+
+	path := filepath.Join(t.TempDir(), "plan.json")
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	got, err := Load(path, nil)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if !reflect.DeepEqual(got, p) {
+		t.Errorf("Load() = %+v, want %+v", got, p)
+	}
+
+	// Every plan this schema version wrote has a verify mode
+	p.Verify.Mode = ""
+	buf.Reset()
+	if err := p.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(path, nil); err == nil || !strings.Contains(err.Error(), "verify mode") {
+		t.Errorf("Load() error = %v, want the missing verify mode rejected", err)
+	}
+}
+
+func TestLoadRejects(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{"newer schema", `{"schemaVersion": 2}`},
+		{"unknown field", `{"schemaVersion": 1, "bogus": true}`},
+		{"no argv", `{"schemaVersion": 1, "restart": {"mode": "never"}}`},
+		{"executable mismatch", `{"schemaVersion": 1, "executable": "a", "argv": ["b"]}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "plan.json")
+			if err := os.WriteFile(path, []byte(tt.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := Load(path, nil); err == nil {
+				t.Error("Load() expected error")
+			}
+		})
+	}
+}
+
+func TestLoadSignature(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := Build(testConfig(), "/app/app.gjg.conf", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := p.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		sign    bool
+		tamper  bool
+		wantErr error
+	}{
+		{"signed", true, false, nil},
+		{"unsigned", false, false, signature.ErrUnsigned},
+		{"tampered", true, true, signature.ErrBadSignature},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "plan.json")
+			if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if tt.sign {
+				if err := signature.SignFile(priv, path); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if tt.tamper {
+				os.WriteFile(path, bytes.Replace(buf.Bytes(), []byte("-Xmx1g"), []byte("-javaagent:evil.jar"), 1), 0644)
+			}
+			_, err := Load(path, pub)
+			if !errors.Is(err, tt.wantErr) || (tt.wantErr == nil) != (err == nil) {
+				t.Errorf("Load() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestMasked(t *testing.T) {
+	p, err := Build(testConfig(), "/app/app.gjg.conf", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := p.Masked(redact.Default())
+	if !m.Redacted {
+		t.Error("Masked() should mark the plan as redacted")
+	}
+	if m.Env[1] != "API_TOKEN=***" {
+		t.Errorf("Masked() env = %q", m.Env)
+	}
+	if p.Env[1] != "API_TOKEN=abc" {
+		t.Errorf("Masked() modified the original plan: %q", p.Env)
+	}
+}
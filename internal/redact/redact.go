@@ -0,0 +1,126 @@
+package redact
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Mask replaces redacted values.
+const Mask = "***"
+
+// builtinPatterns are the words of names that usually hold secrets.
+var builtinPatterns = []string{"password", "passwd", "secret", "token", "key", "credential"}
+
+// builtin matches a built-in pattern as a whole word of a name, optionally
+// plural: db.password, API_TOKEN, apiKey or credentials, but not keyboard.
+var builtin = regexp.MustCompile(`(?i)(?:^|[^a-z0-9])(?:` + strings.Join(builtinPatterns, "|") + `)s?(?:[^a-z0-9]|$)`)
+
+// wordBoundary finds camelCase word boundaries: apiKey, APIKey.
+var wordBoundary = regexp.MustCompile(`([a-z0-9])([A-Z])|([A-Z])([A-Z][a-z])`)
+
+// assignment matches name=value pairs inside free text, with optional - / -- / -D
+// prefixes. The whole pair or just the value may be quoted.
+var assignment = regexp.MustCompile(`"(-{0,2}[A-Za-z0-9_.\-]+)=[^"]*"|'(-{0,2}[A-Za-z0-9_.\-]+)=[^']*'|(-{0,2}[A-Za-z0-9_.\-]+)=("[^"]*"|'[^']*'|\S*)`)
+
+// Redactor hides values whose names match secret patterns.
+type Redactor struct {
+	patterns []*regexp.Regexp
+}
+
+// New returns a Redactor with the built-in patterns plus extra, which are
+// case-insensitive regular expressions matched anywhere in names unless
+// anchored.
+func New(extra []string) (*Redactor, error) {
+	r := &Redactor{}
+	for _, p := range extra {
+		re, err := regexp.Compile("(?i)" + p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redact pattern %q: %w", p, err)
+		}
+		r.patterns = append(r.patterns, re)
+	}
+	return r, nil
+}
+
+// Default returns a Redactor with only the built-in patterns.
+func Default() *Redactor {
+	r, _ := New(nil)
+	return r
+}
+
+// IsSecret reports whether name looks like it holds a secret.
+func (r *Redactor) IsSecret(name string) bool {
+	if builtin.MatchString(wordBoundary.ReplaceAllString(name, "${1}${3}_${2}${4}")) {
+		return true
+	}
+	for _, re := range r.patterns {
+		if re.MatchString(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// Args redacts -Dname=value, --name=value and name=value arguments, and the
+// argument following a bare --name flag, when name is secret.
+func (r *Redactor) Args(argv []string) []string {
+	out := make([]string, len(argv))
+	for i := 0; i < len(argv); i++ {
+		a := argv[i]
+		out[i] = a
+		opt, _, hasValue := strings.Cut(a, "=")
+		name := argName(opt)
+		if name == "" || !r.IsSecret(name) {
+			continue
+		}
+		if hasValue {
+			out[i] = a[:strings.IndexByte(a, '=')+1] + Mask
+		} else if strings.HasPrefix(a, "--") && i+1 < len(argv) && !strings.HasPrefix(argv[i+1], "-") {
+			i++
+			out[i] = Mask
+		}
+	}
+	return out
+}
+
+// Env redacts the values of NAME=value entries whose names are secret.
+func (r *Redactor) Env(env []string) []string {
+	out := make([]string, len(env))
+	for i, kv := range env {
+		out[i] = kv
+		if k, _, ok := strings.Cut(kv, "="); ok && r.IsSecret(k) {
+			out[i] = k + "=" + Mask
+		}
+	}
+	return out
+}
+
+// String redacts name=value pairs found in free text such as jvm_args.
+func (r *Redactor) String(s string) string {
+	if !strings.Contains(s, "=") {
+		return s
+	}
+	return assignment.ReplaceAllStringFunc(s, func(m string) string {
+		sub := assignment.FindStringSubmatch(m)
+		quote, name := "", sub[3]
+		switch {
+		case sub[1] != "":
+			quote, name = `"`, sub[1]
+		case sub[2] != "":
+			quote, name = "'", sub[2]
+		}
+		if !r.IsSecret(argName(name)) {
+			return m
+		}
+		return quote + name + "=" + Mask + quote
+	})
+}
+
+// argName strips the -D, - or -- prefix from an option name.
+func argName(opt string) string {
+	if strings.HasPrefix(opt, "-D") {
+		return opt[2:]
+	}
+	return strings.TrimLeft(opt, "-")
+}
@@ -0,0 +1,101 @@
+package redact
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestArgs(t *testing.T) {
+	r, err := New([]string{"^license$"})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		input []string
+		want  []string
+	}{
+		{
+			name:  "system properties",
+			input: []string{"-Xmx1g", "-Ddb.password=hunter2", "-Dfile.encoding=UTF-8"},
+			want:  []string{"-Xmx1g", "-Ddb.password=***", "-Dfile.encoding=UTF-8"},
+		},
+		{
+			name:  "long options with value",
+			input: []string{"--api-token=abc", "--port=8080", "--Client-Secret=x"},
+			want:  []string{"--api-token=***", "--port=8080", "--Client-Secret=***"},
+		},
+		{
+			name:  "long option with separate value",
+			input: []string{"--password", "hunter2", "--verbose", "--token", "--next"},
+			want:  []string{"--password", "***", "--verbose", "--token", "--next"},
+		},
+		{
+			name:  "configured pattern",
+			input: []string{"--license=ABC", "--licensed-to=me"},
+			want:  []string{"--license=***", "--licensed-to=me"},
+		},
+		{
+			name:  "plain arguments untouched",
+			input: []string{"java", "-jar", "app.jar", "password"},
+			want:  []string{"java", "-jar", "app.jar", "password"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := r.Args(tt.input); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Args() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestString(t *testing.T) {
+	r := Default()
+	input := `-Xmx1g "-Ddb.password=hunter 2" -Dsecret.key='x y' -Dname=value --token=abc -Dkeyboard=de`
+	want := `-Xmx1g "-Ddb.password=***" -Dsecret.key=*** -Dname=value --token=*** -Dkeyboard=de`
+	if got := r.String(input); got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+}
+
+func TestEnv(t *testing.T) {
+	got := Default().Env([]string{"API_TOKEN=abc", "PATH=/bin", "AWS_SECRET_ACCESS_KEY=x"})
+	want := []string{"API_TOKEN=***", "PATH=/bin", "AWS_SECRET_ACCESS_KEY=***"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Env() = %v, want %v", got, want)
+	}
+}
+
+func TestIsSecret(t *testing.T) {
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{"db.password", true},
+		{"AWS_SECRET_ACCESS_KEY", true},
+		{"apiKey", true},
+		{"APIKey", true},
+		{"client-secrets", true},
+		{"gpg.passwd", true},
+		{"Credentials", true},
+		{"keyboard", false},
+		{"keyboard.layout", false},
+		{"monkeyPatch", false},
+		{"tokenizer", false},
+		{"file.encoding", false},
+	}
+	r := Default()
+	for _, tt := range tests {
+		if got := r.IsSecret(tt.name); got != tt.want {
+			t.Errorf("IsSecret(%q) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestNewRejectsInvalidPattern(t *testing.T) {
+	if _, err := New([]string{"("}); err == nil {
+		t.Errorf("New() expected error for invalid pattern")
+	}
+}
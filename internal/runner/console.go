@@ -0,0 +1,116 @@
+package runner
+
+import (
+	"errors"
+	"gjg/internal/logfile"
+	"io"
+	"os"
+)
+
+// ConsoleLogs configures capturing of the child's stdout and stderr to files.
+// Empty paths disable capture for that stream; equal paths share one file.
+type ConsoleLogs struct {
+	StdoutPath string
+	StderrPath string
+	MaxSize    int64
+	Keep       int
+	Timestamps bool
+	// Stdout and Stderr are the console the output is echoed to. Nil uses the
+	// launcher's own streams when a console is attached.
+	Stdout io.Writer
+	Stderr io.Writer
+}
+
+// Console holds the writers opened for ConsoleLogs. Streams that are not
+// captured point at the launcher's console, or are nil when none is attached.
+type Console struct {
+	Stdout io.Writer
+	Stderr io.Writer
+	files  []*logfile.Writer
+	lines  *logfile.Lines
+}
+
+// OpenConsole opens the configured log files. Output is also teed to the
+// launcher's console when one is attached.
+func OpenConsole(c ConsoleLogs) (*Console, error) {
+	con := &Console{}
+
+	// Both streams going to one file are written a line at a time, so that
+	// their lines do not interleave and each gets its own timestamp.
+	wrap := func(path string, console io.Writer) (io.Writer, error) {
+		if path == "" {
+			return console, nil
+		}
+		if con.lines != nil {
+			return Tee(con.lines.Stream(), console), nil
+		}
+		f, err := logfile.Open(path, c.MaxSize, c.Keep)
+		if err != nil {
+			return nil, err
+		}
+		con.files = append(con.files, f)
+		var w io.Writer = f
+		if c.Timestamps {
+			w = logfile.Timestamped(w)
+		}
+		if c.StdoutPath == c.StderrPath {
+			con.lines = logfile.NewLines(w)
+			w = con.lines.Stream()
+		}
+		return Tee(w, console), nil
+	}
+
+	var err error
+	if con.Stdout, err = wrap(c.StdoutPath, consoleOr(c.Stdout, os.Stdout)); err != nil {
+		con.Close()
+		return nil, err
+	}
+	if con.Stderr, err = wrap(c.StderrPath, consoleOr(c.Stderr, os.Stderr)); err != nil {
+		con.Close()
+		return nil, err
+	}
+	return con, nil
+}
+
+// consoleOr returns w, or f when w is nil and f is a usable console.
+func consoleOr(w io.Writer, f *os.File) io.Writer {
+	if w != nil {
+		return w
+	}
+	if consoleAttached(f) {
+		return f
+	}
+	return nil
+}
+
+// Close writes out any partial lines and closes all opened log files.
+func (c *Console) Close() error {
+	var errs []error
+	if c.lines != nil {
+		errs = append(errs, c.lines.Flush())
+	}
+	for _, f := range c.files {
+		errs = append(errs, f.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// Tee returns a writer that writes to primary and, best effort, to secondary.
+// A broken console must never stall the child's output pipe. A nil secondary
+// yields primary itself.
+func Tee(primary, secondary io.Writer) io.Writer {
+	if secondary == nil {
+		return primary
+	}
+	return &teeWriter{primary: primary, secondary: secondary}
+}
+
+type teeWriter struct {
+	primary   io.Writer
+	secondary io.Writer
+}
+
+func (t *teeWriter) Write(p []byte) (int, error) {
+	_, _ = t.secondary.Write(p)
+	return t.primary.Write(p)
+}
@@ -0,0 +1,53 @@
+package runner
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestOpenConsoleSharedFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "console.log")
+	con, err := OpenConsole(ConsoleLogs{
+		StdoutPath: path,
+		StderrPath: path,
+		Timestamps: true,
+		Stdout:     &bytes.Buffer{},
+		Stderr:     &bytes.Buffer{},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Both streams write their lines in pieces, one after the other
+	for range 200 {
+		_, _ = con.Stdout.Write([]byte("out line"))
+		_, _ = con.Stderr.Write([]byte("err line"))
+		_, _ = con.Stdout.Write([]byte(" of several words\n"))
+		_, _ = con.Stderr.Write([]byte(" of several words\n"))
+	}
+	_, _ = con.Stderr.Write([]byte("unterminated"))
+	if err := con.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(string(data), "\n")
+	if len(lines) != 401 {
+		t.Fatalf("got %d lines, want 400 and the unterminated one", len(lines))
+	}
+	for _, l := range lines {
+		// "2006-01-02 15:04:05.000 " is 24 characters
+		switch {
+		case len(l) < 24:
+			t.Fatalf("line %q has no timestamp", l)
+		case l[24:] != "out line of several words" && l[24:] != "err line of several words" && l[24:] != "unterminated":
+			t.Fatalf("line %q mixes the streams", l)
+		}
+	}
+}
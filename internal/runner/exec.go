@@ -0,0 +1,23 @@
+package runner
+
+import "fmt"
+
+// ExecMode says whether the launcher may replace itself with Java.
+type ExecMode string
+
+const (
+	// ExecOff always runs Java as a child process.
+	ExecOff ExecMode = "off"
+	// ExecAuto replaces the launcher with Java (see Exec) when nothing needs
+	// a supervising parent and the platform supports it.
+	ExecAuto ExecMode = "auto"
+)
+
+// ParseExecMode validates an exec value.
+func ParseExecMode(s string) (ExecMode, error) {
+	switch m := ExecMode(s); m {
+	case ExecOff, ExecAuto:
+		return m, nil
+	}
+	return "", fmt.Errorf("invalid exec %q (expected off or auto)", s)
+}
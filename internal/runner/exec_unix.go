@@ -0,0 +1,30 @@
+//go:build unix
+
+package runner
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// CanExec reports whether Exec is available on this platform.
+const CanExec = true
+
+// Exec replaces the launcher process with c, which keeps the launcher's PID,
+// standard streams and signals. It only returns on failure.
+func Exec(c Command) error {
+	if len(c.Argv) == 0 {
+		return errors.New("empty argv")
+	}
+	env := c.Env
+	if env == nil {
+		env = os.Environ()
+	}
+	if c.WorkDir != "" {
+		if err := os.Chdir(c.WorkDir); err != nil {
+			return err
+		}
+	}
+	return syscall.Exec(c.Argv[0], c.Argv, env)
+}
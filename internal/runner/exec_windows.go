@@ -0,0 +1,12 @@
+package runner
+
+import "errors"
+
+// CanExec reports whether Exec is available on this platform. Windows cannot
+// replace a running process image.
+const CanExec = false
+
+// Exec is not supported on Windows.
+func Exec(c Command) error {
+	return errors.ErrUnsupported
+}
@@ -0,0 +1,10 @@
+package runner
+
+import "os/exec"
+
+// Isolate bounds how long cmd's output is waited for once it exited or was
+// killed (see Run). Windows has no process groups to kill, so commands cmd
+// started in the background keep running.
+func Isolate(cmd *exec.Cmd) {
+	cmd.WaitDelay = outputWait
+}
@@ -0,0 +1,124 @@
+package runner
+
+import (
+	"context"
+	"gjg/internal/crash"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// defaultQuickExit is how long a run may last and still count as a JVM startup failure.
+const defaultQuickExit = 30 * time.Second
+
+// HeapFallback retries a launch with smaller -Xmx values when the JVM cannot
+// reserve its heap, which is common on 32-bit runtimes and low-memory machines.
+type HeapFallback struct {
+	// Sizes are -Xmx values in order of preference, e.g. 1024m, 768m, 512m.
+	Sizes []string
+	// CachePath remembers the last working size so later launches start with it.
+	CachePath string
+	// QuickExit bounds how long a failed run may last to be retried.
+	QuickExit time.Duration
+}
+
+// RunWithHeapFallback runs c, replacing its -Xmx with each size in h.Sizes
+// until the JVM gets past heap reservation.
+func RunWithHeapFallback(ctx context.Context, c Command, h HeapFallback, log *slog.Logger) (int, error) {
+	if len(h.Sizes) == 0 {
+		return Run(ctx, c)
+	}
+	quickExit := h.QuickExit
+	if quickExit <= 0 {
+		quickExit = defaultQuickExit
+	}
+
+	start := 0
+	if cached := h.cached(); cached != "" {
+		if i := slices.Index(h.Sizes, cached); i >= 0 {
+			start = i
+		}
+	}
+
+	var code int
+	var err error
+	for i := start; i < len(h.Sizes); i++ {
+		size := h.Sizes[i]
+		attempt := c
+		attempt.Argv = SetMaxHeap(c.Argv, size)
+		tail := crash.NewTail(20)
+		attempt.Stderr = Tee(tail, c.Stderr)
+
+		started := time.Now()
+		code, err = Run(ctx, attempt)
+		if ctx.Err() != nil {
+			return code, err
+		}
+
+		if code == 0 || err != nil || time.Since(started) > quickExit || !heapReservationFailed(tail.Lines()) {
+			h.remember(size)
+			return code, err
+		}
+
+		if i+1 < len(h.Sizes) {
+			log.Warn("JVM could not reserve heap, retrying with a smaller one", "xmx", size, "next", h.Sizes[i+1])
+		} else {
+			log.Error("JVM could not reserve heap and no smaller heap_fallback size is left", "xmx", size)
+		}
+	}
+	return code, err
+}
+
+func heapReservationFailed(lines []string) bool {
+	for _, line := range lines {
+		if strings.Contains(line, "Could not reserve enough space") && strings.Contains(line, "heap") {
+			return true
+		}
+	}
+	return false
+}
+
+func (h HeapFallback) cached() string {
+	if h.CachePath == "" {
+		return ""
+	}
+	data, err := os.ReadFile(h.CachePath)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+func (h HeapFallback) remember(size string) {
+	if h.CachePath == "" || h.cached() == size {
+		return
+	}
+	_ = os.MkdirAll(filepath.Dir(h.CachePath), 0755)
+	_ = os.WriteFile(h.CachePath, []byte(size+"\n"), 0644)
+}
+
+// SetMaxHeap returns a copy of argv whose JVM options use -Xmx<size>. An
+// existing -Xmx is replaced, otherwise one is added right after the executable.
+func SetMaxHeap(argv []string, size string) []string {
+	out := slices.Clone(argv)
+	if len(out) == 0 {
+		return out
+	}
+	for i := 1; i < len(out); i++ {
+		switch a := out[i]; {
+		case strings.HasPrefix(a, "-Xmx"):
+			out[i] = "-Xmx" + size
+			return out
+		case a == "-cp" || a == "-classpath" || a == "--class-path" || a == "-p" || a == "--module-path":
+			// Skip the option value
+			i++
+		case a == "-jar" || !strings.HasPrefix(a, "-"):
+			// End of JVM options
+			return slices.Insert(out, 1, "-Xmx"+size)
+		}
+	}
+	return slices.Insert(out, 1, "-Xmx"+size)
+}
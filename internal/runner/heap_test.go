@@ -0,0 +1,123 @@
+package runner
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestHelperProcess stands in for a JVM that cannot reserve the heap sizes
+// listed in GJG_TEST_FAIL_HEAP, or, given "spawn", for one that leaves a
+// child holding its output behind.
+func TestHelperProcess(t *testing.T) {
+	if os.Getenv("GJG_TEST_HELPER") != "1" {
+		return
+	}
+	switch os.Args[len(os.Args)-1] {
+	case "nap":
+		time.Sleep(5 * time.Second)
+		os.Exit(0)
+	case "spawn":
+		child := exec.Command(os.Args[0], "-test.run=TestHelperProcess", "--", "nap")
+		child.Stdout, child.Stderr = os.Stdout, os.Stderr
+		if err := child.Start(); err != nil {
+			os.Exit(3)
+		}
+		fmt.Println("spawned")
+		os.Exit(0)
+	}
+	var xmx string
+	for _, a := range os.Args {
+		if strings.HasPrefix(a, "-Xmx") {
+			xmx = strings.TrimPrefix(a, "-Xmx")
+		}
+	}
+	if slices.Contains(strings.Split(os.Getenv("GJG_TEST_FAIL_HEAP"), ","), xmx) {
+		fmt.Fprintln(os.Stderr, "Error occurred during initialization of VM")
+		fmt.Fprintln(os.Stderr, "Could not reserve enough space for object heap")
+		os.Exit(1)
+	}
+	fmt.Printf("xmx=%s\n", xmx)
+	os.Exit(0)
+}
+
+func TestRunWithHeapFallback(t *testing.T) {
+	cache := filepath.Join(t.TempDir(), "heap-fallback.txt")
+	h := HeapFallback{Sizes: []string{"1g", "768m", "512m", "256m"}, CachePath: cache}
+	run := func(failing string) (int, string, string) {
+		t.Helper()
+		var stdout, stderr bytes.Buffer
+		c := Command{
+			Argv:   []string{os.Args[0], "-test.run=TestHelperProcess", "--", "-Xmx2g"},
+			Env:    append(os.Environ(), "GJG_TEST_HELPER=1", "GJG_TEST_FAIL_HEAP="+failing),
+			Stdout: &stdout,
+			Stderr: &stderr,
+		}
+		code, err := RunWithHeapFallback(context.Background(), c, h, slog.New(slog.DiscardHandler))
+		if err != nil {
+			t.Fatalf("RunWithHeapFallback() error = %v", err)
+		}
+		return code, stdout.String(), stderr.String()
+	}
+
+	// The next size is tried after each heap reservation failure
+	code, stdout, stderr := run("1g,768m")
+	if code != 0 || strings.TrimSpace(stdout) != "xmx=512m" || strings.Count(stderr, "Could not reserve") != 2 {
+		t.Fatalf("first launch = %d, %q, %q; want 512m after two failures", code, stdout, stderr)
+	}
+	if data, _ := os.ReadFile(cache); strings.TrimSpace(string(data)) != "512m" {
+		t.Errorf("remembered size = %q, want 512m", data)
+	}
+
+	// Later launches start with the size that worked
+	code, stdout, stderr = run("1g,768m")
+	if code != 0 || strings.TrimSpace(stdout) != "xmx=512m" || stderr != "" {
+		t.Errorf("second launch = %d, %q, %q; want 512m straight away", code, stdout, stderr)
+	}
+
+	// Without a size left, the last failure is returned
+	if code, _, stderr := run("512m,256m"); code != 1 || strings.Count(stderr, "Could not reserve") != 2 {
+		t.Errorf("exhausted launch = %d, %q; want the failure of 256m", code, stderr)
+	}
+}
+
+func TestSetMaxHeap(t *testing.T) {
+	tests := []struct {
+		name string
+		argv []string
+		want []string
+	}{
+		{
+			name: "replaces existing -Xmx",
+			argv: []string{"java", "-Xms64m", "-Xmx2g", "-jar", "app.jar", "-Xmx1g"},
+			want: []string{"java", "-Xms64m", "-Xmx512m", "-jar", "app.jar", "-Xmx1g"},
+		},
+		{
+			name: "adds -Xmx when missing",
+			argv: []string{"java", "-jar", "app.jar", "-Xmx1g"},
+			want: []string{"java", "-Xmx512m", "-jar", "app.jar", "-Xmx1g"},
+		},
+		{
+			name: "classpath mode stops at main class",
+			argv: []string{"java", "-cp", "-Xmx.jar", "com.example.Main", "-Xmx1g"},
+			want: []string{"java", "-Xmx512m", "-cp", "-Xmx.jar", "com.example.Main", "-Xmx1g"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := SetMaxHeap(tt.argv, "512m")
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("SetMaxHeap() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
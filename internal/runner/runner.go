@@ -1,50 +1,88 @@
 package runner
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
-	"os/signal"
-	"syscall"
+	"strings"
+	"time"
 )
 
-// Run executes the given argv with env and working directory. Returns the exit code.
-func Run(argv []string, env []string, workDir string) (int, error) {
-	if len(argv) == 0 {
+// outputWait is how long the output of a process is still read once it
+// exited. A process it started in the background may hold on to the same
+// stdout and stderr, which would otherwise keep the launcher waiting until
+// that process exits too.
+const outputWait = 2 * time.Second
+
+// Command describes a child process to run.
+type Command struct {
+	Argv    []string
+	Env     []string
+	WorkDir string
+	// Stdout and Stderr receive the child's output. When nil, the launcher's own
+	// console is used if one is attached.
+	Stdout io.Writer
+	Stderr io.Writer
+	// Exited, when set, receives the state of the finished process.
+	Exited func(*os.ProcessState)
+}
+
+// Run executes the command and returns its exit code.
+// The child is killed when ctx is cancelled. Output its own children write
+// more than two seconds after it exited is lost.
+func Run(ctx context.Context, c Command) (int, error) {
+	if len(c.Argv) == 0 {
 		return 1, errors.New("empty argv")
 	}
-	cmd := exec.Command(argv[0], argv[1:]...)
-	cmd.Env = env
-	cmd.Dir = workDir
-
-	// Handle Ctrl+C: forward as kill to child
-	sigCh := make(chan os.Signal, 1)
-	signal.Notify(sigCh, os.Interrupt)
-	defer signal.Stop(sigCh)
+	cmd := exec.CommandContext(ctx, c.Argv[0], c.Argv[1:]...)
+	cmd.Env = c.Env
+	cmd.Dir = c.WorkDir
+	cmd.WaitDelay = outputWait
+	cmd.Stdout = c.Stdout
+	cmd.Stderr = c.Stderr
+	if cmd.Stdout == nil && consoleAttached(os.Stdout) {
+		cmd.Stdout = os.Stdout
+	}
+	if cmd.Stderr == nil && consoleAttached(os.Stderr) {
+		cmd.Stderr = os.Stderr
+	}
 
 	if err := cmd.Start(); err != nil {
 		return 1, fmt.Errorf("failed to start process: %w", err)
 	}
 
-	done := make(chan error, 1)
-	go func() { done <- cmd.Wait() }()
-
-	for {
-		select {
-		case <-sigCh:
-			if cmd.Process != nil {
-				_ = cmd.Process.Signal(syscall.SIGKILL)
-			}
-		case err := <-done:
-			if err == nil {
-				return 0, nil
-			}
-			var ee *exec.ExitError
-			if errors.As(err, &ee) {
-				return ee.ExitCode(), nil
-			}
-			return 1, err
-		}
+	err := cmd.Wait()
+	if c.Exited != nil && cmd.ProcessState != nil {
+		c.Exited(cmd.ProcessState)
+	}
+	if err == nil || errors.Is(err, exec.ErrWaitDelay) {
+		return 0, nil
+	}
+	var ee *exec.ExitError
+	if errors.As(err, &ee) {
+		return ee.ExitCode(), nil
+	}
+	return 1, err
+}
+
+// ExitSignal returns the name of the signal that terminated the process, or
+// "" when it exited normally. Windows processes are never signalled.
+func ExitSignal(state *os.ProcessState) string {
+	if s, ok := strings.CutPrefix(state.String(), "signal: "); ok {
+		return s
+	}
+	return ""
+}
+
+// consoleAttached reports whether f is a usable standard stream. GUI builds
+// (-H windowsgui) started from Explorer have no console and invalid handles.
+func consoleAttached(f *os.File) bool {
+	if f == nil {
+		return false
 	}
+	_, err := f.Stat()
+	return err == nil
 }
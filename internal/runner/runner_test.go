@@ -0,0 +1,32 @@
+package runner
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRunBackgroundChild(t *testing.T) {
+	var out bytes.Buffer
+	c := Command{
+		Argv:   []string{os.Args[0], "-test.run=TestHelperProcess", "--", "spawn"},
+		Env:    append(os.Environ(), "GJG_TEST_HELPER=1"),
+		Stdout: &out,
+		Stderr: &out,
+	}
+	started := time.Now()
+	code, err := Run(context.Background(), c)
+	if err != nil || code != 0 {
+		t.Fatalf("Run() = %d, %v; want 0", code, err)
+	}
+	// The child naps for 5s; its output is only waited for briefly
+	if took := time.Since(started); took > outputWait+time.Second {
+		t.Errorf("Run() took %s, want the output wait to end it", took)
+	}
+	if !strings.Contains(out.String(), "spawned") {
+		t.Errorf("output = %q, want the process output", out.String())
+	}
+}
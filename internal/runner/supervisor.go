@@ -0,0 +1,122 @@
+package runner
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math/rand"
+	"slices"
+	"time"
+)
+
+// RestartMode controls when the supervisor starts the child again.
+type RestartMode string
+
+const (
+	RestartNever     RestartMode = "never"
+	RestartOnFailure RestartMode = "on-failure"
+	RestartAlways    RestartMode = "always"
+)
+
+// ParseRestartMode validates a restart mode read from configuration.
+func ParseRestartMode(s string) (RestartMode, error) {
+	switch m := RestartMode(s); m {
+	case RestartNever, RestartOnFailure, RestartAlways:
+		return m, nil
+	}
+	return "", fmt.Errorf("invalid restart mode %q (expected never, on-failure or always)", s)
+}
+
+// Policy describes how a crashed or exited child is restarted.
+type Policy struct {
+	Mode RestartMode
+	// RestartExitCodes are exit codes the application uses to ask for a restart.
+	// They trigger a restart regardless of Mode and without backoff.
+	RestartExitCodes []int
+	// MaxRestarts is the number of restarts allowed within Window before giving up.
+	MaxRestarts int
+	Window      time.Duration
+	// InitialDelay and MaxDelay bound the exponential backoff between failed runs.
+	InitialDelay time.Duration
+	MaxDelay     time.Duration
+}
+
+// Supervise calls run until the policy says to stop, returning the last exit code.
+// It stops immediately once ctx is cancelled.
+func Supervise(ctx context.Context, p Policy, log *slog.Logger, run func(ctx context.Context) (int, error)) (int, error) {
+	var restarts []time.Time
+	failures := 0
+
+	for {
+		started := time.Now()
+		code, err := run(ctx)
+		uptime := time.Since(started)
+
+		if ctx.Err() != nil {
+			return code, err
+		}
+
+		requested := err == nil && slices.Contains(p.RestartExitCodes, code)
+		if !requested && !p.shouldRestart(code, err) {
+			return code, err
+		}
+
+		now := time.Now()
+		restarts = slices.DeleteFunc(restarts, func(t time.Time) bool { return now.Sub(t) > p.Window })
+		if len(restarts) >= p.MaxRestarts {
+			log.Error("Giving up restarting", "restarts", len(restarts), "window", p.Window, "exitCode", code)
+			return code, err
+		}
+		restarts = append(restarts, now)
+
+		// A run that outlived the window is not part of a crash loop.
+		if requested || uptime >= p.Window {
+			failures = 0
+		}
+
+		var delay time.Duration
+		if !requested {
+			failures++
+			delay = p.backoff(failures)
+		}
+
+		attrs := []any{"restart", len(restarts), "maxRestarts", p.MaxRestarts, "exitCode", code, "uptime", uptime.Round(time.Millisecond), "delay", delay.Round(time.Millisecond)}
+		if err != nil {
+			attrs = append(attrs, "error", err)
+		}
+		log.Warn("Restarting process", attrs...)
+
+		select {
+		case <-ctx.Done():
+			return code, err
+		case <-time.After(delay):
+		}
+	}
+}
+
+func (p Policy) shouldRestart(code int, err error) bool {
+	switch p.Mode {
+	case RestartAlways:
+		return true
+	case RestartOnFailure:
+		return err != nil || code != 0
+	}
+	return false
+}
+
+// backoff doubles the initial delay per consecutive failure, caps it at MaxDelay
+// and applies jitter in [delay/2, delay).
+func (p Policy) backoff(failures int) time.Duration {
+	delay := p.InitialDelay
+	for i := 1; i < failures && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	if delay <= 0 {
+		return 0
+	}
+	half := delay / 2
+	return half + time.Duration(rand.Int63n(int64(delay-half)))
+}
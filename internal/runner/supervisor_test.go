@@ -0,0 +1,110 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"testing"
+	"time"
+)
+
+func TestSupervise(t *testing.T) {
+	tests := []struct {
+		name      string
+		policy    Policy
+		codes     []int
+		wantCode  int
+		wantCalls int
+	}{
+		{
+			name:      "never does not restart",
+			policy:    Policy{Mode: RestartNever, MaxRestarts: 5, Window: time.Minute},
+			codes:     []int{3, 0},
+			wantCode:  3,
+			wantCalls: 1,
+		},
+		{
+			name:      "on-failure restarts until success",
+			policy:    Policy{Mode: RestartOnFailure, MaxRestarts: 5, Window: time.Minute},
+			codes:     []int{1, 2, 0},
+			wantCode:  0,
+			wantCalls: 3,
+		},
+		{
+			name:      "always restarts after clean exit",
+			policy:    Policy{Mode: RestartAlways, MaxRestarts: 2, Window: time.Minute},
+			codes:     []int{0, 0, 0, 0},
+			wantCode:  0,
+			wantCalls: 3,
+		},
+		{
+			name:      "restart exit code with mode never",
+			policy:    Policy{Mode: RestartNever, RestartExitCodes: []int{42}, MaxRestarts: 5, Window: time.Minute},
+			codes:     []int{42, 42, 7},
+			wantCode:  7,
+			wantCalls: 3,
+		},
+		{
+			name:      "gives up on crash loop",
+			policy:    Policy{Mode: RestartOnFailure, MaxRestarts: 3, Window: time.Minute},
+			codes:     []int{1, 1, 1, 1, 1, 1},
+			wantCode:  1,
+			wantCalls: 4,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			code, err := Supervise(context.Background(), tt.policy, slog.New(slog.DiscardHandler), func(ctx context.Context) (int, error) {
+				c := tt.codes[calls]
+				calls++
+				return c, nil
+			})
+			if err != nil {
+				t.Fatalf("Supervise() error = %v", err)
+			}
+			if code != tt.wantCode {
+				t.Errorf("Supervise() code = %d, want %d", code, tt.wantCode)
+			}
+			if calls != tt.wantCalls {
+				t.Errorf("Supervise() calls = %d, want %d", calls, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestSuperviseStopsOnCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	calls := 0
+	_, err := Supervise(ctx, Policy{Mode: RestartAlways, MaxRestarts: 10, Window: time.Minute}, slog.New(slog.DiscardHandler), func(ctx context.Context) (int, error) {
+		calls++
+		cancel()
+		return -1, errors.New("killed")
+	})
+	if err == nil {
+		t.Errorf("Supervise() expected error from cancelled run")
+	}
+	if calls != 1 {
+		t.Errorf("Supervise() calls = %d, want 1", calls)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	p := Policy{InitialDelay: time.Second, MaxDelay: 10 * time.Second}
+	tests := []struct {
+		failures int
+		max      time.Duration
+	}{
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{3, 4 * time.Second},
+		{10, 10 * time.Second},
+	}
+	for _, tt := range tests {
+		got := p.backoff(tt.failures)
+		if got < tt.max/2 || got >= tt.max {
+			t.Errorf("backoff(%d) = %s, want in [%s, %s)", tt.failures, got, tt.max/2, tt.max)
+		}
+	}
+}
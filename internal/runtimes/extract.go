@@ -0,0 +1,167 @@
+package runtimes
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// extract unpacks the archive at file into dir; url tells its format.
+func extract(file, url, dir string) error {
+	name := strings.ToLower(url)
+	if i := strings.IndexAny(name, "?#"); i >= 0 {
+		name = name[:i]
+	}
+	switch {
+	case strings.HasSuffix(name, ".zip"):
+		return extractZip(file, dir)
+	case strings.HasSuffix(name, ".tar.gz"), strings.HasSuffix(name, ".tgz"):
+		return extractTarGz(file, dir)
+	}
+	return fmt.Errorf("unsupported archive type (expected .zip or .tar.gz): %s", url)
+}
+
+func extractZip(file, dir string) error {
+	r, err := zip.OpenReader(file)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	for _, f := range r.File {
+		target, err := entryPath(dir, f.Name)
+		if err != nil {
+			return err
+		}
+		mode := f.Mode()
+		switch {
+		case mode.IsDir():
+			err = os.MkdirAll(target, 0755)
+		case mode&fs.ModeSymlink != 0:
+			var link []byte
+			link, err = readZipEntry(f)
+			if err == nil {
+				err = symlink(dir, target, string(link))
+			}
+		default:
+			var rc io.ReadCloser
+			if rc, err = f.Open(); err == nil {
+				err = writeEntry(target, rc, mode)
+				rc.Close()
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", f.Name, err)
+		}
+	}
+	return nil
+}
+
+func readZipEntry(f *zip.File) ([]byte, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return io.ReadAll(rc)
+}
+
+func extractTarGz(file, dir string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return err
+	}
+	tr := tar.NewReader(gz)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		target, err := entryPath(dir, h.Name)
+		if err != nil {
+			return err
+		}
+		switch h.Typeflag {
+		case tar.TypeDir:
+			err = os.MkdirAll(target, 0755)
+		case tar.TypeReg:
+			err = writeEntry(target, tr, h.FileInfo().Mode())
+		case tar.TypeSymlink:
+			err = symlink(dir, target, h.Linkname)
+		case tar.TypeLink:
+			var src string
+			if src, err = entryPath(dir, h.Linkname); err == nil {
+				err = os.Link(src, target)
+			}
+		default:
+			// Devices and FIFOs have no place in a runtime
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", h.Name, err)
+		}
+	}
+}
+
+// entryPath returns where an archive entry goes in dir, refusing names that
+// would escape it.
+func entryPath(dir, name string) (string, error) {
+	p := filepath.FromSlash(strings.TrimPrefix(path.Clean("/"+name), "/"))
+	if p == "" {
+		// The archive root, as in "./"
+		return dir, nil
+	}
+	if !filepath.IsLocal(p) {
+		return "", fmt.Errorf("invalid archive entry %q", name)
+	}
+	return filepath.Join(dir, p), nil
+}
+
+// writeEntry writes a regular file, keeping its execute bits.
+func writeEntry(target string, r io.Reader, mode fs.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	perm := fs.FileMode(0644)
+	if mode&0111 != 0 {
+		perm = 0755
+	}
+	f, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(f, r)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// symlink creates a relative symbolic link that stays inside dir.
+func symlink(dir, target, link string) error {
+	if filepath.IsAbs(link) {
+		return fmt.Errorf("absolute symlink %q", link)
+	}
+	resolved := filepath.Join(filepath.Dir(target), filepath.FromSlash(link))
+	if rel, err := filepath.Rel(dir, resolved); err != nil || !filepath.IsLocal(rel) {
+		return fmt.Errorf("symlink %q escapes the runtime", link)
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	return os.Symlink(link, target)
+}
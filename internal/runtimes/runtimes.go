@@ -0,0 +1,241 @@
+// Package runtimes provisions Java runtimes: it downloads a runtime archive,
+// verifies it and extracts it into a per-user cache shared by all apps, so
+// that apps needing the same Java version reuse one copy.
+package runtimes
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gjg/internal/lockfile"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// markerName is written into a runtime directory once it is complete.
+const markerName = ".gjg-runtime.json"
+
+// Spec is a runtime to download for this platform.
+type Spec struct {
+	// URL of a .zip or .tar.gz archive holding the runtime, either at its
+	// root or in a single top-level folder.
+	URL string
+	// SHA256 is the hex digest of the archive.
+	SHA256 string
+	// Version is the Java version the runtime provides, e.g. 17 or 21.0.2.
+	Version string
+}
+
+// marker records where an installed runtime came from.
+type marker struct {
+	URL       string    `json:"url"`
+	SHA256    string    `json:"sha256"`
+	Installed time.Time `json:"installed"`
+}
+
+// ExpandURL fills the placeholders of a java_download_url template:
+// {version}, {os} and {arch} (Go names, e.g. windows and amd64) and {ext}
+// (zip on Windows, tar.gz elsewhere).
+func ExpandURL(template, version string) string {
+	ext := "tar.gz"
+	if runtime.GOOS == "windows" {
+		ext = "zip"
+	}
+	return strings.NewReplacer(
+		"{version}", version,
+		"{os}", runtime.GOOS,
+		"{arch}", runtime.GOARCH,
+		"{ext}", ext,
+	).Replace(template)
+}
+
+// Dir returns the directory of the runtime s in cache. Runtimes are shared
+// by version, platform and archive digest, whatever their download URL, so
+// an app pinning a different archive of the same version gets its own copy.
+func Dir(cache string, s Spec) (string, error) {
+	if err := s.check(); err != nil {
+		return "", err
+	}
+	name := s.Version + "-" + runtime.GOOS + "-" + runtime.GOARCH + "-" + strings.ToLower(s.SHA256[:16])
+	return filepath.Join(cache, name), nil
+}
+
+// Installed reports whether dir holds a completely installed runtime
+// extracted from the archive with the digest sha256.
+func Installed(dir, sha256 string) bool {
+	data, err := os.ReadFile(filepath.Join(dir, markerName))
+	if err != nil {
+		return false
+	}
+	var m marker
+	return json.Unmarshal(data, &m) == nil && strings.EqualFold(m.SHA256, sha256)
+}
+
+// check rejects a spec that cannot name a runtime directory.
+func (s Spec) check() error {
+	if s.URL == "" || s.Version == "" {
+		return errors.New("java_download_url and java_download_version are required")
+	}
+	if strings.ContainsAny(s.Version, `/\`) || strings.Contains(s.Version, "..") || !filepath.IsLocal(s.Version) {
+		return fmt.Errorf("invalid java_download_version %q", s.Version)
+	}
+	if b, err := hex.DecodeString(s.SHA256); err != nil || len(b) != sha256.Size {
+		return fmt.Errorf("no valid java_download_sha256 for %s_%s", runtime.GOOS, runtime.GOARCH)
+	}
+	return nil
+}
+
+// Install downloads, verifies and extracts s into Dir(cache, s), unless it
+// is already there, and returns that directory. Concurrent installs of the
+// same runtime, from any process, wait for each other.
+func Install(ctx context.Context, client *http.Client, cache string, s Spec) (string, error) {
+	dir, err := Dir(cache, s)
+	if err != nil {
+		return "", err
+	}
+	if Installed(dir, s.SHA256) {
+		return dir, nil
+	}
+	lock, err := lockfile.Acquire(ctx, dir+".lock")
+	if err != nil {
+		return "", err
+	}
+	defer lock.Release()
+	if Installed(dir, s.SHA256) {
+		// Another launch installed it while we waited
+		return dir, nil
+	}
+
+	archive := dir + ".download"
+	defer os.Remove(archive)
+	if err := download(ctx, client, s.URL, archive, s.SHA256); err != nil {
+		return "", err
+	}
+
+	tmp := dir + ".tmp"
+	if err := os.RemoveAll(tmp); err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(tmp)
+	if err := extract(archive, s.URL, tmp); err != nil {
+		return "", fmt.Errorf("failed to extract %s: %w", s.URL, err)
+	}
+	root, err := archiveRoot(tmp)
+	if err != nil {
+		return "", err
+	}
+	data, err := json.Marshal(marker{URL: s.URL, SHA256: s.SHA256, Installed: time.Now().UTC()})
+	if err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(filepath.Join(root, markerName), data, 0644); err != nil {
+		return "", err
+	}
+	// A directory without a matching marker is a leftover of an interrupted
+	// install
+	if err := os.RemoveAll(dir); err != nil {
+		return "", err
+	}
+	if err := os.Rename(root, dir); err != nil {
+		return "", err
+	}
+	return dir, nil
+}
+
+// download fetches url into path and checks its SHA-256.
+func download(ctx context.Context, client *http.Client, url, path, want string) error {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("java download failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("java download failed: %s: %s", url, resp.Status)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	h := sha256.New()
+	_, err = io.Copy(io.MultiWriter(f, h), resp.Body)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("java download failed: %w", err)
+	}
+	if got := hex.EncodeToString(h.Sum(nil)); !strings.EqualFold(got, want) {
+		return fmt.Errorf("java download %s: sha256 mismatch (got %s, want %s)", url, got, want)
+	}
+	return nil
+}
+
+// archiveRoot returns the runtime root in an extracted archive: the archive
+// folder itself, or its single top-level folder.
+func archiveRoot(dir string) (string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return "", err
+	}
+	if len(entries) == 1 && entries[0].IsDir() {
+		return filepath.Join(dir, entries[0].Name()), nil
+	}
+	return dir, nil
+}
+
+// Suitable reports whether the runtime of java provides at least the major
+// version of want. A runtime without a readable release file is not.
+func Suitable(java, want string) bool {
+	have, ok := major(ReleaseVersion(java))
+	need, ok2 := major(want)
+	return ok && ok2 && have >= need
+}
+
+// ReleaseVersion reads JAVA_VERSION from the release file of the runtime
+// java belongs to, or returns "".
+func ReleaseVersion(java string) string {
+	if resolved, err := filepath.EvalSymlinks(java); err == nil {
+		java = resolved
+	}
+	data, err := os.ReadFile(filepath.Join(filepath.Dir(filepath.Dir(java)), "release"))
+	if err != nil {
+		return ""
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if v, ok := strings.CutPrefix(strings.TrimSpace(line), "JAVA_VERSION="); ok {
+			return strings.Trim(v, `"`)
+		}
+	}
+	return ""
+}
+
+// major returns the feature version of a Java version: 8 for 1.8.0_392,
+// 17 for 17.0.9.
+func major(v string) (int, bool) {
+	v = strings.TrimPrefix(v, "1.")
+	if i := strings.IndexAny(v, ".+-_"); i >= 0 {
+		v = v[:i]
+	}
+	n, err := strconv.Atoi(v)
+	return n, err == nil
+}
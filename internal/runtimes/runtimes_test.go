@@ -0,0 +1,241 @@
+package runtimes
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// fakeRuntime lists the files of a runtime archive under a top-level folder.
+var fakeRuntime = map[string]string{
+	"jdk-17.0.9+9-jre/release":       "JAVA_VERSION=\"17.0.9\"\n",
+	"jdk-17.0.9+9-jre/bin/java":      "#!/bin/sh\n",
+	"jdk-17.0.9+9-jre/bin/javaw.exe": "MZ",
+}
+
+func tarGz(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for name, content := range files {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0755, Size: int64(len(content)), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatal(err)
+		}
+		tw.Write([]byte(content))
+	}
+	tw.Close()
+	gz.Close()
+	return buf.Bytes()
+}
+
+func zipArchive(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, content := range files {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(content))
+	}
+	zw.Close()
+	return buf.Bytes()
+}
+
+func digest(data []byte) string {
+	h := sha256.Sum256(data)
+	return hex.EncodeToString(h[:])
+}
+
+// serve serves data at /runtime and counts the downloads.
+func serve(t *testing.T, data []byte) (string, *atomic.Int32) {
+	t.Helper()
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.Write(data)
+	}))
+	t.Cleanup(srv.Close)
+	return srv.URL + "/runtime", &hits
+}
+
+func TestInstall(t *testing.T) {
+	tests := []struct {
+		ext  string
+		data []byte
+	}{
+		{".tar.gz", tarGz(t, fakeRuntime)},
+		{".zip", zipArchive(t, fakeRuntime)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.ext, func(t *testing.T) {
+			url, hits := serve(t, tt.data)
+			cache := t.TempDir()
+			s := Spec{URL: url + tt.ext, SHA256: digest(tt.data), Version: "17"}
+
+			dir, err := Install(context.Background(), nil, cache, s)
+			if err != nil {
+				t.Fatalf("Install() error = %v", err)
+			}
+			want, err := Dir(cache, s)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if dir != want || !Installed(dir, s.SHA256) {
+				t.Errorf("Install() = %q, want an installed %q", dir, want)
+			}
+			java := filepath.Join(dir, "bin", "java")
+			if !Suitable(java, "17") || Suitable(java, "21") {
+				t.Errorf("Suitable() disagrees with release version %q", ReleaseVersion(java))
+			}
+			if _, err := Install(context.Background(), nil, cache, s); err != nil || hits.Load() != 1 {
+				t.Errorf("second Install() = %v after %d downloads, want the cached runtime reused", err, hits.Load())
+			}
+		})
+	}
+}
+
+func TestInstallConcurrent(t *testing.T) {
+	data := tarGz(t, fakeRuntime)
+	url, hits := serve(t, data)
+	cache := t.TempDir()
+	s := Spec{URL: url + ".tar.gz", SHA256: digest(data), Version: "17"}
+
+	var wg sync.WaitGroup
+	errs := make([]error, 4)
+	for i := range errs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, errs[i] = Install(context.Background(), nil, cache, s)
+		}()
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			t.Errorf("Install() error = %v", err)
+		}
+	}
+	if hits.Load() != 1 {
+		t.Errorf("runtime downloaded %d times, want once", hits.Load())
+	}
+}
+
+func TestInstallRejects(t *testing.T) {
+	good := tarGz(t, fakeRuntime)
+	escaping := tarGz(t, map[string]string{"jre/bin/java": "", "../../evil": "x"})
+	tests := []struct {
+		name string
+		data []byte
+		url  string
+		sum  string
+	}{
+		{"sha256 mismatch", good, ".tar.gz", digest([]byte("other"))},
+		{"missing sha256", good, ".tar.gz", ""},
+		{"unknown format", good, ".rar", digest(good)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			url, _ := serve(t, tt.data)
+			cache := t.TempDir()
+			s := Spec{URL: url + tt.url, SHA256: tt.sum, Version: "17"}
+			if _, err := Install(context.Background(), nil, cache, s); err == nil {
+				t.Fatal("Install() expected error")
+			}
+			if dir, err := Dir(cache, s); err == nil && Installed(dir, s.SHA256) {
+				t.Error("failed install left a runtime behind")
+			}
+		})
+	}
+
+	// Entries are kept inside the runtime folder
+	url, _ := serve(t, escaping)
+	cache := filepath.Join(t.TempDir(), "cache")
+	dir, err := Install(context.Background(), nil, cache, Spec{URL: url + ".tar.gz", SHA256: digest(escaping), Version: "17"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "evil")); err != nil {
+		t.Errorf("escaping entry not kept inside the runtime: %v", err)
+	}
+}
+
+func TestInstallPinsDigest(t *testing.T) {
+	a := tarGz(t, fakeRuntime)
+	b := zipArchive(t, fakeRuntime)
+	urlA, _ := serve(t, a)
+	urlB, hitsB := serve(t, b)
+	cache := t.TempDir()
+	sa := Spec{URL: urlA + ".tar.gz", SHA256: digest(a), Version: "17"}
+	sb := Spec{URL: urlB + ".zip", SHA256: digest(b), Version: "17"}
+
+	dirA, err := Install(context.Background(), nil, cache, sa)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Another app pins a different archive of the same version
+	dirB, err := Install(context.Background(), nil, cache, sb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dirA == dirB || hitsB.Load() != 1 {
+		t.Errorf("Install() reused %q for a different archive", dirA)
+	}
+	if Installed(dirA, sb.SHA256) {
+		t.Error("Installed() accepted a runtime extracted from another archive")
+	}
+}
+
+func TestDirRejectsVersion(t *testing.T) {
+	sum := digest([]byte("runtime"))
+	for _, v := range []string{"", "..", "../17", "17/../../x", "a/b", `a\b`, "/abs"} {
+		if dir, err := Dir("cache", Spec{URL: "https://example.com/jre", SHA256: sum, Version: v}); err == nil {
+			t.Errorf("Dir(%q) = %q, want error", v, dir)
+		}
+	}
+	if _, err := Dir("cache", Spec{URL: "https://example.com/jre", SHA256: sum, Version: "21.0.2+13"}); err != nil {
+		t.Errorf("Dir() error = %v", err)
+	}
+}
+
+func TestExpandURL(t *testing.T) {
+	ext := "tar.gz"
+	if runtime.GOOS == "windows" {
+		ext = "zip"
+	}
+	got := ExpandURL("https://example.com/jre-{version}-{os}-{arch}.{ext}", "21")
+	if want := "https://example.com/jre-21-" + runtime.GOOS + "-" + runtime.GOARCH + "." + ext; got != want {
+		t.Errorf("ExpandURL() = %q, want %q", got, want)
+	}
+}
+
+func TestMajor(t *testing.T) {
+	tests := []struct {
+		in   string
+		want int
+	}{
+		{"1.8.0_392", 8},
+		{"17.0.9", 17},
+		{"21", 21},
+		{"22-ea", 22},
+	}
+	for _, tt := range tests {
+		if got, ok := major(tt.in); !ok || got != tt.want {
+			t.Errorf("major(%q) = %d, %v; want %d", tt.in, got, ok, tt.want)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package signature
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// PublicKey is the base64 Ed25519 public key baked in at build time with
+// -ldflags "-X gjg/internal/signature.PublicKey=<key>". When set, the
+// launcher refuses configuration, manifests and plans without a valid
+// detached signature.
+var PublicKey string
+
+// Ext is appended to a file name to get its detached signature.
+const Ext = ".sig"
+
+var (
+	ErrUnsigned     = errors.New("signature file not found")
+	ErrBadSignature = errors.New("signature does not match")
+)
+
+// EmbeddedKey returns the key baked into the build, or nil when there is none.
+func EmbeddedKey() (ed25519.PublicKey, error) {
+	if PublicKey == "" {
+		return nil, nil
+	}
+	key, err := ParsePublicKey(PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid embedded public key: %w", err)
+	}
+	return key, nil
+}
+
+// ParsePublicKey decodes a base64 Ed25519 public key.
+func ParsePublicKey(s string) (ed25519.PublicKey, error) {
+	b, err := base64.StdEncoding.DecodeString(strings.TrimSpace(s))
+	if err != nil {
+		return nil, err
+	}
+	if len(b) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("public key has %d bytes, want %d", len(b), ed25519.PublicKeySize)
+	}
+	return ed25519.PublicKey(b), nil
+}
+
+// ParsePrivateKey decodes a base64 Ed25519 private key.
+func ParsePrivateKey(s string) (ed25519.PrivateKey, error) {
+	b, err := base64.StdEncoding.DecodeString(strings.TrimSpace(s))
+	if err != nil {
+		return nil, err
+	}
+	if len(b) != ed25519.PrivateKeySize {
+		return nil, fmt.Errorf("private key has %d bytes, want %d", len(b), ed25519.PrivateKeySize)
+	}
+	return ed25519.PrivateKey(b), nil
+}
+
+// GenerateKey returns a new base64 key pair.
+func GenerateKey() (public, private string, err error) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return "", "", err
+	}
+	return base64.StdEncoding.EncodeToString(pub), base64.StdEncoding.EncodeToString(priv), nil
+}
+
+// Sign returns the base64 signature of data.
+func Sign(key ed25519.PrivateKey, data []byte) string {
+	return base64.StdEncoding.EncodeToString(ed25519.Sign(key, data))
+}
+
+// SignFile writes the detached signature of path to path+Ext.
+func SignFile(key ed25519.PrivateKey, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path+Ext, []byte(Sign(key, data)+"\n"), 0644)
+}
+
+// Verify checks a base64 signature of data.
+func Verify(key ed25519.PublicKey, data []byte, sig string) error {
+	b, err := base64.StdEncoding.DecodeString(strings.TrimSpace(sig))
+	if err != nil || !ed25519.Verify(key, data, b) {
+		return ErrBadSignature
+	}
+	return nil
+}
+
+// VerifyFile checks data, the content of path, against the detached
+// signature in path+Ext. Callers pass the bytes they are about to use so the
+// file cannot change between the check and its use.
+func VerifyFile(key ed25519.PublicKey, path string, data []byte) error {
+	sig, err := os.ReadFile(path + Ext)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("%s: %w", path, ErrUnsigned)
+		}
+		return err
+	}
+	if err := Verify(key, data, string(sig)); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package signature
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSignVerifyFile(t *testing.T) {
+	pubText, privText, err := GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub, err := ParsePublicKey(pubText)
+	if err != nil {
+		t.Fatalf("ParsePublicKey() error = %v", err)
+	}
+	priv, err := ParsePrivateKey(privText)
+	if err != nil {
+		t.Fatalf("ParsePrivateKey() error = %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "app.gjg.conf")
+	data := []byte("jvm_args=-Xmx1g\n")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := VerifyFile(pub, path, data); !errors.Is(err, ErrUnsigned) {
+		t.Errorf("VerifyFile() unsigned error = %v, want ErrUnsigned", err)
+	}
+	if err := SignFile(priv, path); err != nil {
+		t.Fatalf("SignFile() error = %v", err)
+	}
+	if err := VerifyFile(pub, path, data); err != nil {
+		t.Errorf("VerifyFile() error = %v", err)
+	}
+	if err := VerifyFile(pub, path, []byte("jvm_args=-javaagent:evil.jar\n")); !errors.Is(err, ErrBadSignature) {
+		t.Errorf("VerifyFile() tampered error = %v, want ErrBadSignature", err)
+	}
+
+	otherText, _, _ := GenerateKey()
+	other, _ := ParsePublicKey(otherText)
+	if err := VerifyFile(other, path, data); !errors.Is(err, ErrBadSignature) {
+		t.Errorf("VerifyFile() other key error = %v, want ErrBadSignature", err)
+	}
+}
+
+func TestEmbeddedKey(t *testing.T) {
+	defer func(old string) { PublicKey = old }(PublicKey)
+
+	PublicKey = ""
+	if key, err := EmbeddedKey(); key != nil || err != nil {
+		t.Errorf("EmbeddedKey() = %v, %v; want nil, nil without a key", key, err)
+	}
+	PublicKey = "not base64!"
+	if _, err := EmbeddedKey(); err == nil {
+		t.Error("EmbeddedKey() expected error for an invalid key")
+	}
+	PublicKey, _, _ = GenerateKey()
+	if key, err := EmbeddedKey(); key == nil || err != nil {
+		t.Errorf("EmbeddedKey() = %v, %v", key, err)
+	}
+}
@@ -0,0 +1,558 @@
+// Package update keeps an installation current from an update manifest:
+// newer versions are downloaded in the background into a staging folder,
+// swapped in on the next launch and rolled back if they fail to start.
+package update
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gjg/internal/fsutil"
+	"gjg/internal/lockfile"
+	"gjg/internal/signature"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DirName is the folder in the installation directory holding the update
+// state, staged downloads and backups.
+const DirName = ".gjg-update"
+
+// StartupWindow is how long a just-installed version has to run before a
+// failing exit no longer counts as a startup failure.
+const StartupWindow = 30 * time.Second
+
+// maxManifestSize bounds the manifest download.
+const maxManifestSize = 1 << 20
+
+// ErrLauncherTooOld is returned by Check when the new version needs a newer launcher.
+var ErrLauncherTooOld = errors.New("update needs a newer launcher")
+
+// Manifest describes the latest version of an application.
+type Manifest struct {
+	Version            string     `json:"version"`
+	MinLauncherVersion string     `json:"minLauncherVersion,omitempty"`
+	Artifacts          []Artifact `json:"artifacts"`
+}
+
+// Artifact is one file of the application. Path is relative to the
+// installation directory; URL may be relative to the manifest URL.
+type Artifact struct {
+	Path   string `json:"path"`
+	URL    string `json:"url"`
+	SHA256 string `json:"sha256"`
+}
+
+func (m *Manifest) validate() error {
+	if m.Version == "" {
+		return errors.New("manifest has no version")
+	}
+	if len(m.Artifacts) == 0 {
+		return errors.New("manifest has no artifacts")
+	}
+	seen := map[string]bool{}
+	for _, a := range m.Artifacts {
+		p := filepath.FromSlash(a.Path)
+		if !filepath.IsLocal(p) || strings.SplitN(filepath.ToSlash(filepath.Clean(p)), "/", 2)[0] == DirName {
+			return fmt.Errorf("invalid artifact path %q", a.Path)
+		}
+		if seen[a.Path] {
+			return fmt.Errorf("duplicate artifact path %q", a.Path)
+		}
+		seen[a.Path] = true
+		if a.URL == "" {
+			return fmt.Errorf("artifact %s has no url", a.Path)
+		}
+		if b, err := hex.DecodeString(a.SHA256); err != nil || len(b) != sha256.Size {
+			return fmt.Errorf("artifact %s has an invalid sha256", a.Path)
+		}
+	}
+	return nil
+}
+
+// State is what the updater remembers between launches.
+type State struct {
+	// Version is the installed version, empty until the first update.
+	Version   string    `json:"version,omitempty"`
+	Previous  string    `json:"previous,omitempty"`
+	LastCheck time.Time `json:"lastCheck,omitzero"`
+	// Trial is set from installing a version until it starts successfully.
+	Trial bool `json:"trial,omitempty"`
+	// Failed lists versions that were rolled back and are not installed again.
+	Failed []string `json:"failed,omitempty"`
+}
+
+// staged is the manifest of the staged version. It is written with Complete
+// unset before the downloads start and rewritten with it set once all of
+// them succeeded; Apply installs nothing without it.
+type staged struct {
+	Manifest
+	Complete bool `json:"complete"`
+}
+
+// journal lists the files an install replaced, so it can be undone.
+type journal struct {
+	Version string        `json:"version"`
+	Files   []journalFile `json:"files"`
+}
+
+type journalFile struct {
+	Path    string `json:"path"`
+	Existed bool   `json:"existed"`
+}
+
+// Updater checks for, installs and rolls back updates of the installation in Dir.
+type Updater struct {
+	// URL is the update manifest.
+	URL string
+	// Dir is the installation directory artifact paths are relative to.
+	Dir string
+	// LauncherVersion is compared with the manifest's minLauncherVersion;
+	// empty or "dev" satisfies any minimum.
+	LauncherVersion string
+	// Interval is the minimum time between manifest checks.
+	Interval time.Duration
+	// Timeout bounds fetching the manifest.
+	Timeout time.Duration
+	// PublicKey, when set, requires a valid signature at URL+".sig". Without
+	// it URL must be https.
+	PublicKey ed25519.PublicKey
+	// Client is used for downloads; nil uses http.DefaultClient.
+	Client *http.Client
+}
+
+func (u Updater) path(elem ...string) string {
+	return filepath.Join(append([]string{u.Dir, DirName}, elem...)...)
+}
+
+// LockPath is the lock held while an update of the installation in dir is
+// staged or installed. Others changing the installation take it too.
+func LockPath(dir string) string {
+	return filepath.Join(dir, DirName, "lock")
+}
+
+// lock takes the update lock without waiting. A nil lock and error mean
+// another launch holds it.
+func (u Updater) lock() (*lockfile.Lock, error) {
+	l, err := lockfile.TryAcquire(LockPath(u.Dir))
+	if errors.Is(err, lockfile.ErrLocked) {
+		return nil, nil
+	}
+	return l, err
+}
+
+// State returns the saved update state.
+func (u Updater) State() (State, error) {
+	var s State
+	err := readJSON(u.path("state.json"), &s)
+	if errors.Is(err, fs.ErrNotExist) {
+		err = nil
+	}
+	return s, err
+}
+
+func (u Updater) saveState(s State) error {
+	return writeJSON(u.path("state.json"), s)
+}
+
+// Check fetches the manifest, unless the last check is more recent than
+// Interval, and stages a newer version. It returns the staged version, or ""
+// when there is nothing new or another launch is already checking. Files that
+// already match are not downloaded.
+func (u Updater) Check(ctx context.Context) (string, error) {
+	lock, err := u.lock()
+	if lock == nil {
+		return "", err
+	}
+	defer lock.Release()
+	st, err := u.State()
+	if err != nil {
+		return "", err
+	}
+	if !st.LastCheck.IsZero() && time.Since(st.LastCheck) < u.Interval {
+		return "", nil
+	}
+	m, base, err := u.fetchManifest(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	staged := ""
+	switch {
+	case st.Version != "" && CompareVersions(m.Version, st.Version) <= 0:
+	case slices.Contains(st.Failed, m.Version):
+	case !u.launcherSatisfies(m.MinLauncherVersion):
+		err = fmt.Errorf("%w: version %s needs launcher %s or later", ErrLauncherTooOld, m.Version, m.MinLauncherVersion)
+	case u.isStaged(m.Version):
+	default:
+		if err := u.stage(ctx, m, base); err != nil {
+			return "", err
+		}
+		staged = m.Version
+	}
+
+	st.LastCheck = time.Now()
+	if saveErr := u.saveState(st); saveErr != nil && err == nil {
+		err = saveErr
+	}
+	return staged, err
+}
+
+func (u Updater) isStaged(version string) bool {
+	var s staged
+	return readJSON(u.path("staging", "manifest.json"), &s) == nil && s.Complete && s.Version == version
+}
+
+func (u Updater) launcherSatisfies(min string) bool {
+	if min == "" || u.LauncherVersion == "" || u.LauncherVersion == "dev" {
+		return true
+	}
+	return CompareVersions(u.LauncherVersion, min) >= 0
+}
+
+func (u Updater) client() *http.Client {
+	if u.Client != nil {
+		return u.Client
+	}
+	return http.DefaultClient
+}
+
+func (u Updater) fetchManifest(ctx context.Context) (*Manifest, *url.URL, error) {
+	base, err := url.Parse(u.URL)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid update_url: %w", err)
+	}
+	if base.Scheme != "https" && u.PublicKey == nil {
+		return nil, nil, fmt.Errorf("update_url %s: unsigned update manifests are only accepted over https", u.URL)
+	}
+	if u.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, u.Timeout)
+		defer cancel()
+	}
+	data, err := u.get(ctx, u.URL)
+	if err != nil {
+		return nil, nil, err
+	}
+	if u.PublicKey != nil {
+		sig, err := u.get(ctx, u.URL+signature.Ext)
+		if err != nil {
+			return nil, nil, fmt.Errorf("update manifest signature: %w", err)
+		}
+		if err := signature.Verify(u.PublicKey, data, string(sig)); err != nil {
+			return nil, nil, fmt.Errorf("update manifest signature check failed: %w", err)
+		}
+	}
+	var m Manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, nil, fmt.Errorf("invalid update manifest: %w", err)
+	}
+	if err := m.validate(); err != nil {
+		return nil, nil, fmt.Errorf("invalid update manifest: %w", err)
+	}
+	return &m, base, nil
+}
+
+func (u Updater) get(ctx context.Context, rawURL string) ([]byte, error) {
+	resp, err := u.open(ctx, rawURL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxManifestSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxManifestSize {
+		return nil, fmt.Errorf("%s is larger than %d bytes", rawURL, maxManifestSize)
+	}
+	return data, nil
+}
+
+func (u Updater) open(ctx context.Context, rawURL string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := u.client().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("GET %s: %s", rawURL, resp.Status)
+	}
+	return resp, nil
+}
+
+// stage downloads the changed artifacts of m and marks the staged manifest
+// complete last, so only a complete download is ever installed. A failed
+// download leaves nothing staged.
+func (u Updater) stage(ctx context.Context, m *Manifest, base *url.URL) error {
+	staging := u.path("staging")
+	if err := os.RemoveAll(staging); err != nil {
+		return err
+	}
+	if err := u.downloadAll(ctx, m, base, staging); err != nil {
+		return errors.Join(err, os.RemoveAll(staging))
+	}
+	return writeJSON(filepath.Join(staging, "manifest.json"), staged{Manifest: *m, Complete: true})
+}
+
+// downloadAll downloads the artifacts of m that differ from the installed
+// files into staging.
+func (u Updater) downloadAll(ctx context.Context, m *Manifest, base *url.URL, staging string) error {
+	if err := writeJSON(filepath.Join(staging, "manifest.json"), staged{Manifest: *m}); err != nil {
+		return err
+	}
+	for _, a := range m.Artifacts {
+		if sum, err := fsutil.SHA256(filepath.Join(u.Dir, filepath.FromSlash(a.Path))); err == nil && strings.EqualFold(sum, a.SHA256) {
+			continue
+		}
+		ref, err := url.Parse(a.URL)
+		if err != nil {
+			return fmt.Errorf("artifact %s: invalid url: %w", a.Path, err)
+		}
+		if err := u.download(ctx, base.ResolveReference(ref).String(), filepath.Join(staging, filepath.FromSlash(a.Path)), a.SHA256); err != nil {
+			return fmt.Errorf("artifact %s: %w", a.Path, err)
+		}
+	}
+	return nil
+}
+
+func (u Updater) download(ctx context.Context, rawURL, dest, want string) error {
+	resp, err := u.open(ctx, rawURL)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return err
+	}
+	part := dest + ".part"
+	f, err := os.Create(part)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(part)
+	h := sha256.New()
+	_, err = io.Copy(io.MultiWriter(f, h), resp.Body)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	if got := hex.EncodeToString(h.Sum(nil)); !strings.EqualFold(got, want) {
+		return fmt.Errorf("sha256 mismatch: got %s, want %s", got, want)
+	}
+	return os.Rename(part, dest)
+}
+
+// Apply installs the staged version: each changed file is moved to the backup
+// folder and replaced by its staged copy with a rename. It returns the
+// installed version, or "" when nothing is staged or another launch is
+// staging or installing. The version stays on trial until Confirm or
+// Rollback. An install interrupted by a crash is undone first, and an
+// incomplete download is discarded instead of installed.
+func (u Updater) Apply() (string, error) {
+	lock, err := u.lock()
+	if lock == nil {
+		return "", err
+	}
+	defer lock.Release()
+	if err := u.undo("applying.json"); err != nil {
+		return "", fmt.Errorf("failed to undo an interrupted update: %w", err)
+	}
+	var m staged
+	if err := readJSON(u.path("staging", "manifest.json"), &m); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return "", nil
+		}
+		return "", err
+	}
+	if !m.Complete {
+		return "", errors.Join(fmt.Errorf("staged version %s is incomplete; it is downloaded again", m.Version), os.RemoveAll(u.path("staging")))
+	}
+	st, err := u.State()
+	if err != nil {
+		return "", err
+	}
+
+	j := journal{Version: m.Version}
+	for _, a := range m.Artifacts {
+		target := filepath.Join(u.Dir, filepath.FromSlash(a.Path))
+		if _, err := os.Stat(u.path("staging", filepath.FromSlash(a.Path))); err != nil {
+			// Not downloaded because the installed file already matched
+			if sum, err := fsutil.SHA256(target); err != nil || !strings.EqualFold(sum, a.SHA256) {
+				return "", errors.Join(fmt.Errorf("staged version %s lacks %s; it is downloaded again", m.Version, a.Path), os.RemoveAll(u.path("staging")))
+			}
+			continue
+		}
+		_, err := os.Stat(target)
+		j.Files = append(j.Files, journalFile{Path: a.Path, Existed: err == nil})
+	}
+	if err := os.RemoveAll(u.path("backup")); err != nil {
+		return "", err
+	}
+	if err := writeJSON(u.path("applying.json"), j); err != nil {
+		return "", err
+	}
+	for _, f := range j.Files {
+		target := filepath.Join(u.Dir, filepath.FromSlash(f.Path))
+		if err := u.swap(f, target); err != nil {
+			if undoErr := u.undo("applying.json"); undoErr != nil {
+				err = errors.Join(err, undoErr)
+			}
+			return "", err
+		}
+	}
+
+	st.Previous, st.Version, st.Trial = st.Version, m.Version, true
+	if err := u.saveState(st); err != nil {
+		return "", err
+	}
+	if err := os.Rename(u.path("applying.json"), u.path("applied.json")); err != nil {
+		return "", err
+	}
+	return m.Version, os.RemoveAll(u.path("staging"))
+}
+
+func (u Updater) swap(f journalFile, target string) error {
+	if f.Existed {
+		backup := u.path("backup", filepath.FromSlash(f.Path))
+		if err := os.MkdirAll(filepath.Dir(backup), 0755); err != nil {
+			return err
+		}
+		if err := os.Rename(target, backup); err != nil {
+			return err
+		}
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	return os.Rename(u.path("staging", filepath.FromSlash(f.Path)), target)
+}
+
+// undo restores the files listed in the named journal, if it exists, and
+// removes it.
+func (u Updater) undo(name string) error {
+	var j journal
+	if err := readJSON(u.path(name), &j); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	for _, f := range j.Files {
+		target := filepath.Join(u.Dir, filepath.FromSlash(f.Path))
+		backup := u.path("backup", filepath.FromSlash(f.Path))
+		switch {
+		case f.Existed:
+			if _, err := os.Stat(backup); err != nil {
+				continue // never moved away
+			}
+			if err := os.Rename(backup, target); err != nil {
+				return err
+			}
+		default:
+			if err := os.Remove(target); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return err
+			}
+		}
+	}
+	return os.Remove(u.path(name))
+}
+
+// Confirm ends the trial of the installed version and drops its backups.
+func (u Updater) Confirm() error {
+	st, err := u.State()
+	if err != nil || !st.Trial {
+		return err
+	}
+	st.Trial = false
+	if err := u.saveState(st); err != nil {
+		return err
+	}
+	if err := os.Remove(u.path("applied.json")); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return os.RemoveAll(u.path("backup"))
+}
+
+// Rollback restores the files replaced by the version on trial and marks that
+// version as failed, so it is not installed again. It returns the version
+// that was rolled back.
+func (u Updater) Rollback() (string, error) {
+	st, err := u.State()
+	if err != nil || !st.Trial {
+		return "", err
+	}
+	if err := u.undo("applied.json"); err != nil {
+		return "", err
+	}
+	failed := st.Version
+	st.Version, st.Previous, st.Trial = st.Previous, "", false
+	st.Failed = append(st.Failed, failed)
+	return failed, u.saveState(st)
+}
+
+// CompareVersions compares dotted versions such as "1.10.2" part by part,
+// numerically where both parts are numbers. A leading "v" is ignored.
+func CompareVersions(a, b string) int {
+	pa := strings.Split(strings.TrimPrefix(a, "v"), ".")
+	pb := strings.Split(strings.TrimPrefix(b, "v"), ".")
+	for i := range max(len(pa), len(pb)) {
+		x, y := "0", "0"
+		if i < len(pa) {
+			x = pa[i]
+		}
+		if i < len(pb) {
+			y = pb[i]
+		}
+		nx, errX := strconv.Atoi(x)
+		ny, errY := strconv.Atoi(y)
+		switch {
+		case errX == nil && errY == nil && nx != ny:
+			if nx < ny {
+				return -1
+			}
+			return 1
+		case (errX != nil || errY != nil) && x != y:
+			return strings.Compare(x, y)
+		}
+	}
+	return 0
+}
+
+func readJSON(path string, v any) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
+
+// writeJSON replaces path atomically.
+func writeJSON(path string, v any) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	return fsutil.WriteFile(path, data, 0644)
+}
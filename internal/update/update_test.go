@@ -0,0 +1,333 @@
+package update
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"gjg/internal/lockfile"
+	"gjg/internal/signature"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func sum(s string) string {
+	h := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(h[:])
+}
+
+// server serves an update manifest for version with the given files, and
+// counts manifest requests.
+func server(t *testing.T, m Manifest, files map[string]string) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var hits atomic.Int32
+	mux := http.NewServeMux()
+	mux.HandleFunc("/app/update.json", func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		json.NewEncoder(w).Encode(m)
+	})
+	for name, content := range files {
+		mux.HandleFunc("/app/"+name, func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(content))
+		})
+	}
+	srv := httptest.NewTLSServer(mux)
+	t.Cleanup(srv.Close)
+	return srv, &hits
+}
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestCheckApplyRollback(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "app.jar"), []byte("jar v1"), 0644)
+	os.WriteFile(filepath.Join(dir, "app.gjg.conf"), []byte("jvm_args=-Xmx1g\n"), 0644)
+
+	srv, _ := server(t, Manifest{
+		Version: "2.0",
+		Artifacts: []Artifact{
+			{Path: "app.jar", URL: "app-2.0.jar", SHA256: sum("jar v2")},
+			{Path: "app.gjg.conf", URL: "/app/app.gjg.conf", SHA256: sum("jvm_args=-Xmx1g\n")},
+			{Path: "lib/extra.jar", URL: "extra.jar", SHA256: sum("extra")},
+		},
+	}, map[string]string{"app-2.0.jar": "jar v2", "extra.jar": "extra"})
+	u := Updater{URL: srv.URL + "/app/update.json", Dir: dir, Timeout: time.Second, Client: srv.Client()}
+
+	staged, err := u.Check(context.Background())
+	if err != nil || staged != "2.0" {
+		t.Fatalf("Check() = %q, %v; want 2.0 staged", staged, err)
+	}
+	if got := readFile(t, filepath.Join(dir, "app.jar")); got != "jar v1" {
+		t.Errorf("app.jar = %q before Apply, want it untouched", got)
+	}
+	if _, err := os.Stat(u.path("staging", "app.gjg.conf")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("unchanged app.gjg.conf was downloaded: %v", err)
+	}
+
+	version, err := u.Apply()
+	if err != nil || version != "2.0" {
+		t.Fatalf("Apply() = %q, %v; want 2.0", version, err)
+	}
+	if got := readFile(t, filepath.Join(dir, "app.jar")); got != "jar v2" {
+		t.Errorf("app.jar = %q after Apply, want jar v2", got)
+	}
+	if got := readFile(t, filepath.Join(dir, "lib", "extra.jar")); got != "extra" {
+		t.Errorf("lib/extra.jar = %q after Apply", got)
+	}
+	if st, _ := u.State(); st.Version != "2.0" || !st.Trial {
+		t.Errorf("state = %+v, want version 2.0 on trial", st)
+	}
+	if version, err := u.Apply(); version != "" || err != nil {
+		t.Errorf("second Apply() = %q, %v; want nothing to apply", version, err)
+	}
+
+	failed, err := u.Rollback()
+	if err != nil || failed != "2.0" {
+		t.Fatalf("Rollback() = %q, %v", failed, err)
+	}
+	if got := readFile(t, filepath.Join(dir, "app.jar")); got != "jar v1" {
+		t.Errorf("app.jar = %q after Rollback, want jar v1", got)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "lib", "extra.jar")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("file added by the update survived Rollback: %v", err)
+	}
+
+	// A rolled back version is not downloaded again
+	if staged, err := u.Check(context.Background()); staged != "" || err != nil {
+		t.Errorf("Check() after rollback = %q, %v; want nothing", staged, err)
+	}
+}
+
+func TestConfirm(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "app.jar"), []byte("jar v1"), 0644)
+	srv, _ := server(t, Manifest{Version: "2", Artifacts: []Artifact{{Path: "app.jar", URL: "a.jar", SHA256: sum("jar v2")}}}, map[string]string{"a.jar": "jar v2"})
+	u := Updater{URL: srv.URL + "/app/update.json", Dir: dir, Client: srv.Client()}
+
+	if _, err := u.Check(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := u.Apply(); err != nil {
+		t.Fatal(err)
+	}
+	if err := u.Confirm(); err != nil {
+		t.Fatal(err)
+	}
+	if failed, err := u.Rollback(); failed != "" || err != nil {
+		t.Errorf("Rollback() after Confirm = %q, %v; want nothing to roll back", failed, err)
+	}
+	if got := readFile(t, filepath.Join(dir, "app.jar")); got != "jar v2" {
+		t.Errorf("app.jar = %q, want jar v2 kept", got)
+	}
+	if _, err := os.Stat(u.path("backup")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("backup kept after Confirm: %v", err)
+	}
+}
+
+func TestCheckRejectsBadDownload(t *testing.T) {
+	dir := t.TempDir()
+	srv, _ := server(t, Manifest{Version: "2", Artifacts: []Artifact{{Path: "app.jar", URL: "a.jar", SHA256: sum("expected")}}}, map[string]string{"a.jar": "tampered"})
+	u := Updater{URL: srv.URL + "/app/update.json", Dir: dir, Client: srv.Client()}
+
+	if _, err := u.Check(context.Background()); err == nil {
+		t.Fatal("Check() expected a sha256 mismatch")
+	}
+	if version, err := u.Apply(); version != "" || err != nil {
+		t.Errorf("Apply() = %q, %v; a failed download must not be installed", version, err)
+	}
+}
+
+func TestApplyIncomplete(t *testing.T) {
+	tests := []struct {
+		name  string
+		stage func(u Updater)
+	}{
+		{"not marked complete", func(u Updater) {
+			writeJSON(u.path("staging", "manifest.json"), staged{Manifest: Manifest{Version: "2", Artifacts: []Artifact{{Path: "app.jar", URL: "a.jar", SHA256: sum("jar v2")}}}})
+			os.WriteFile(u.path("staging", "app.jar"), []byte("jar v2"), 0644)
+		}},
+		{"artifact missing", func(u Updater) {
+			writeJSON(u.path("staging", "manifest.json"), staged{Manifest: Manifest{Version: "2", Artifacts: []Artifact{{Path: "app.jar", URL: "a.jar", SHA256: sum("jar v2")}}}, Complete: true})
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			os.WriteFile(filepath.Join(dir, "app.jar"), []byte("jar v1"), 0644)
+			u := Updater{Dir: dir}
+			tt.stage(u)
+			if version, err := u.Apply(); version != "" || err == nil {
+				t.Errorf("Apply() = %q, %v; want an incomplete stage refused", version, err)
+			}
+			if got := readFile(t, filepath.Join(dir, "app.jar")); got != "jar v1" {
+				t.Errorf("app.jar = %q, want it untouched", got)
+			}
+			if _, err := os.Stat(u.path("staging")); !errors.Is(err, os.ErrNotExist) {
+				t.Errorf("incomplete stage kept: %v", err)
+			}
+		})
+	}
+}
+
+func TestLocked(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "app.jar"), []byte("jar v1"), 0644)
+	srv, hits := server(t, Manifest{Version: "2", Artifacts: []Artifact{{Path: "app.jar", URL: "a.jar", SHA256: sum("jar v2")}}}, map[string]string{"a.jar": "jar v2"})
+	u := Updater{URL: srv.URL + "/app/update.json", Dir: dir, Client: srv.Client()}
+	if _, err := u.Check(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	lock, err := lockfile.Acquire(context.Background(), LockPath(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version, err := u.Apply(); version != "" || err != nil {
+		t.Errorf("Apply() while locked = %q, %v; want it left for a later launch", version, err)
+	}
+	os.Remove(u.path("state.json"))
+	if staged, err := u.Check(context.Background()); staged != "" || err != nil || hits.Load() != 1 {
+		t.Errorf("Check() while locked = %q, %v after %d manifest requests; want it skipped", staged, err, hits.Load())
+	}
+	lock.Release()
+	if version, err := u.Apply(); version != "2" || err != nil {
+		t.Errorf("Apply() = %q, %v; want 2", version, err)
+	}
+}
+
+func TestCheckPolicy(t *testing.T) {
+	m := Manifest{Version: "1.10", MinLauncherVersion: "v2.0.0", Artifacts: []Artifact{{Path: "app.jar", URL: "a.jar", SHA256: sum("x")}}}
+	srv, hits := server(t, m, map[string]string{"a.jar": "x"})
+
+	tests := []struct {
+		name     string
+		launcher string
+		interval time.Duration
+		state    State
+		want     string
+		wantErr  error
+		wantHits int32
+	}{
+		{"newer", "v2.1.0", 0, State{Version: "1.9"}, "1.10", nil, 1},
+		{"up to date", "v2.1.0", 0, State{Version: "1.10"}, "", nil, 1},
+		{"launcher too old", "v1.5.0", 0, State{Version: "1.9"}, "", ErrLauncherTooOld, 1},
+		{"dev launcher", "dev", 0, State{Version: "1.9"}, "1.10", nil, 1},
+		{"checked recently", "v2.1.0", time.Hour, State{Version: "1.9", LastCheck: time.Now()}, "", nil, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u := Updater{URL: srv.URL + "/app/update.json", Dir: t.TempDir(), LauncherVersion: tt.launcher, Interval: tt.interval, Client: srv.Client()}
+			if err := u.saveState(tt.state); err != nil {
+				t.Fatal(err)
+			}
+			hits.Store(0)
+			got, err := u.Check(context.Background())
+			if got != tt.want || !errors.Is(err, tt.wantErr) {
+				t.Errorf("Check() = %q, %v; want %q, %v", got, err, tt.want, tt.wantErr)
+			}
+			if hits.Load() != tt.wantHits {
+				t.Errorf("manifest requests = %d, want %d", hits.Load(), tt.wantHits)
+			}
+		})
+	}
+}
+
+func TestCheckSignature(t *testing.T) {
+	pub, priv, _ := ed25519.GenerateKey(rand.Reader)
+	m, _ := json.Marshal(Manifest{Version: "2", Artifacts: []Artifact{{Path: "app.jar", URL: "a.jar", SHA256: sum("jar v2")}}})
+	sig := signature.Sign(priv, m)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/update.json", func(w http.ResponseWriter, r *http.Request) { w.Write(m) })
+	mux.HandleFunc("/update.json.sig", func(w http.ResponseWriter, r *http.Request) { io.WriteString(w, sig) })
+	mux.HandleFunc("/a.jar", func(w http.ResponseWriter, r *http.Request) { io.WriteString(w, "jar v2") })
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	tests := []struct {
+		name    string
+		key     ed25519.PublicKey
+		wantErr bool
+	}{
+		{"plain http without a key", nil, true},
+		{"plain http with a signed manifest", pub, false},
+		{"wrong key", ed25519.PublicKey(make([]byte, ed25519.PublicKeySize)), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u := Updater{URL: srv.URL + "/update.json", Dir: t.TempDir(), PublicKey: tt.key}
+			staged, err := u.Check(context.Background())
+			if (err != nil) != tt.wantErr || (err == nil && staged != "2") {
+				t.Errorf("Check() = %q, %v; wantErr %v", staged, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCheckTimeout(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer srv.Close()
+	u := Updater{URL: srv.URL, Dir: t.TempDir(), Timeout: 50 * time.Millisecond, Client: srv.Client()}
+
+	start := time.Now()
+	if _, err := u.Check(context.Background()); err == nil {
+		t.Fatal("Check() expected a timeout")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Check() took %v, want it bounded by the timeout", elapsed)
+	}
+}
+
+func TestManifestValidate(t *testing.T) {
+	ok := Artifact{Path: "app.jar", URL: "a.jar", SHA256: sum("x")}
+	tests := []struct {
+		name string
+		m    Manifest
+	}{
+		{"no version", Manifest{Artifacts: []Artifact{ok}}},
+		{"no artifacts", Manifest{Version: "1"}},
+		{"escaping path", Manifest{Version: "1", Artifacts: []Artifact{{Path: "../evil.jar", URL: "a", SHA256: ok.SHA256}}}},
+		{"update folder", Manifest{Version: "1", Artifacts: []Artifact{{Path: DirName + "/state.json", URL: "a", SHA256: ok.SHA256}}}},
+		{"bad hash", Manifest{Version: "1", Artifacts: []Artifact{{Path: "app.jar", URL: "a", SHA256: "abc"}}}},
+		{"duplicate", Manifest{Version: "1", Artifacts: []Artifact{ok, ok}}},
+	}
+	for _, tt := range tests {
+		if err := tt.m.validate(); err == nil {
+			t.Errorf("%s: validate() expected error", tt.name)
+		}
+	}
+}
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"1.10", "1.9", 1},
+		{"v1.2.0", "1.2", 0},
+		{"1.2", "1.2.1", -1},
+		{"2.0-beta", "2.0-alpha", 1},
+	}
+	for _, tt := range tests {
+		if got := CompareVersions(tt.a, tt.b); got != tt.want {
+			t.Errorf("CompareVersions(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,239 @@
+// Package versions manages a side-by-side installation layout: each version
+// of the application lives in its own folder under a versions directory, and
+// a pointer file names the one that runs.
+package versions
+
+import (
+	"errors"
+	"fmt"
+	"gjg/internal/fsutil"
+	"gjg/internal/lockfile"
+	"gjg/internal/update"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// Pointer files in the versions directory, each holding a version name.
+const (
+	CurrentFile  = "current"
+	PreviousFile = "previous"
+)
+
+// inUseDir holds a lock per version, shared by the launches running it.
+const inUseDir = ".in-use"
+
+// ErrNoPrevious is returned by Rollback when no version ran before the current one.
+var ErrNoPrevious = errors.New("no previous version to roll back to")
+
+// ErrNotMarked is returned by Use when the in-use lock cannot be created, as
+// in a read-only installation. The version can still run, but Prune does not
+// know it is running.
+var ErrNotMarked = errors.New("cannot mark the version in use")
+
+// Dir is a versions directory.
+type Dir string
+
+// Path returns the folder of version v.
+func (d Dir) Path(v string) string {
+	return filepath.Join(string(d), v)
+}
+
+// List returns the installed versions, oldest first.
+func (d Dir) List() ([]string, error) {
+	entries, err := os.ReadDir(string(d))
+	if err != nil {
+		return nil, err
+	}
+	var list []string
+	for _, e := range entries {
+		if e.IsDir() && !strings.HasPrefix(e.Name(), ".") {
+			list = append(list, e.Name())
+		}
+	}
+	slices.SortFunc(list, update.CompareVersions)
+	return list, nil
+}
+
+// Current returns the version named by the current file, or the newest
+// installed version when there is none.
+func (d Dir) Current() (string, error) {
+	v, err := d.read(CurrentFile)
+	if err != nil || v != "" {
+		return v, err
+	}
+	list, err := d.List()
+	if err != nil {
+		return "", err
+	}
+	if len(list) == 0 {
+		return "", fmt.Errorf("no versions installed in %s", d)
+	}
+	return list[len(list)-1], nil
+}
+
+// Previous returns the version that was current before, or "".
+func (d Dir) Previous() (string, error) {
+	return d.read(PreviousFile)
+}
+
+// Select returns the version to run: use when set, else the current one.
+// The version must be installed.
+func (d Dir) Select(use string) (string, error) {
+	v := use
+	if v == "" {
+		var err error
+		if v, err = d.Current(); err != nil {
+			return "", err
+		}
+	}
+	if err := d.check(v); err != nil {
+		return "", err
+	}
+	return v, nil
+}
+
+// Switch makes v the current version and remembers the old one as previous.
+func (d Dir) Switch(v string) error {
+	if err := d.check(v); err != nil {
+		return err
+	}
+	cur, err := d.Current()
+	if err != nil {
+		return err
+	}
+	if cur == v {
+		return nil
+	}
+	if err := d.write(PreviousFile, cur); err != nil {
+		return err
+	}
+	return d.write(CurrentFile, v)
+}
+
+// Rollback switches back to the previous version and returns it. Rolling
+// back twice returns to where it started.
+func (d Dir) Rollback() (string, error) {
+	prev, err := d.Previous()
+	if err != nil {
+		return "", err
+	}
+	if prev == "" {
+		return "", ErrNoPrevious
+	}
+	if err := d.Switch(prev); err != nil {
+		return "", err
+	}
+	return prev, nil
+}
+
+// Use marks version v as running until the returned lock is released, so
+// that Prune leaves it alone. It fails while Prune is removing v, and with
+// ErrNotMarked when the lock cannot be created.
+func (d Dir) Use(v string) (*lockfile.Lock, error) {
+	if err := d.check(v); err != nil {
+		return nil, err
+	}
+	l, err := lockfile.TryAcquireShared(d.inUsePath(v))
+	if errors.Is(err, lockfile.ErrLocked) {
+		return nil, fmt.Errorf("version %s is being removed", v)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrNotMarked, err)
+	}
+	// Prune may have removed it before the lock was taken
+	if err := d.check(v); err != nil {
+		l.Release()
+		return nil, err
+	}
+	return l, nil
+}
+
+// Prune removes the versions older than the keep newest ones, except the
+// current, previous and protected versions and those a launch is running
+// (see Use). It returns the removed versions; keep <= 0 keeps everything.
+func (d Dir) Prune(keep int, protect ...string) ([]string, error) {
+	if keep <= 0 {
+		return nil, nil
+	}
+	list, err := d.List()
+	if err != nil || len(list) <= keep {
+		return nil, err
+	}
+	cur, err := d.Current()
+	if err != nil {
+		return nil, err
+	}
+	prev, err := d.Previous()
+	if err != nil {
+		return nil, err
+	}
+	var removed []string
+	var errs []error
+	for _, v := range list[:len(list)-keep] {
+		if v == cur || v == prev || slices.Contains(protect, v) {
+			continue
+		}
+		ok, err := d.remove(v)
+		if err != nil {
+			errs = append(errs, err)
+		}
+		if ok {
+			removed = append(removed, v)
+		}
+	}
+	return removed, errors.Join(errs...)
+}
+
+// remove deletes version v unless a launch is running it.
+func (d Dir) remove(v string) (bool, error) {
+	lock, err := lockfile.TryAcquire(d.inUsePath(v))
+	if errors.Is(err, lockfile.ErrLocked) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	err = os.RemoveAll(d.Path(v))
+	lock.Release()
+	if err != nil {
+		return false, err
+	}
+	os.Remove(d.inUsePath(v))
+	return true, nil
+}
+
+// inUsePath is the lock file of version v.
+func (d Dir) inUsePath(v string) string {
+	return filepath.Join(string(d), inUseDir, v+".lock")
+}
+
+// check reports whether v names an installed version.
+func (d Dir) check(v string) error {
+	if v == "" || v != filepath.Base(v) || !filepath.IsLocal(v) {
+		return fmt.Errorf("invalid version %q", v)
+	}
+	if fi, err := os.Stat(d.Path(v)); err != nil || !fi.IsDir() {
+		return fmt.Errorf("version %s is not installed in %s", v, d)
+	}
+	return nil
+}
+
+// read returns the version in a pointer file, or "" when it is missing.
+func (d Dir) read(name string) (string, error) {
+	data, err := os.ReadFile(filepath.Join(string(d), name))
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// write replaces a pointer file atomically.
+func (d Dir) write(name, v string) error {
+	return fsutil.WriteFile(filepath.Join(string(d), name), []byte(v+"\n"), 0644)
+}
@@ -0,0 +1,130 @@
+package versions
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func install(t *testing.T, vs ...string) Dir {
+	t.Helper()
+	dir := t.TempDir()
+	for _, v := range vs {
+		if err := os.MkdirAll(filepath.Join(dir, v), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return Dir(dir)
+}
+
+func TestSelect(t *testing.T) {
+	d := install(t, "1.9.0", "1.10.0", "1.4.2")
+	if v, err := d.Select(""); err != nil || v != "1.10.0" {
+		t.Errorf("Select() without current = %q, %v; want newest 1.10.0", v, err)
+	}
+	if err := d.Switch("1.4.2"); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := d.Select(""); err != nil || v != "1.4.2" {
+		t.Errorf("Select() = %q, %v; want current 1.4.2", v, err)
+	}
+	if v, err := d.Select("1.9.0"); err != nil || v != "1.9.0" {
+		t.Errorf("Select(1.9.0) = %q, %v", v, err)
+	}
+	for _, bad := range []string{"2.0", "../1.9.0", "current"} {
+		if _, err := d.Select(bad); err == nil {
+			t.Errorf("Select(%q) expected error", bad)
+		}
+	}
+}
+
+func TestSwitchRollback(t *testing.T) {
+	d := install(t, "1.4.2", "1.5.0")
+	if _, err := d.Rollback(); !errors.Is(err, ErrNoPrevious) {
+		t.Errorf("Rollback() without previous = %v, want ErrNoPrevious", err)
+	}
+	if err := d.Switch("1.4.2"); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Switch("1.5.0"); err != nil {
+		t.Fatal(err)
+	}
+	v, err := d.Rollback()
+	if err != nil || v != "1.4.2" {
+		t.Fatalf("Rollback() = %q, %v; want 1.4.2", v, err)
+	}
+	if cur, _ := d.Current(); cur != "1.4.2" {
+		t.Errorf("current = %q after Rollback, want 1.4.2", cur)
+	}
+	if prev, _ := d.Previous(); prev != "1.5.0" {
+		t.Errorf("previous = %q after Rollback, want 1.5.0", prev)
+	}
+}
+
+func TestPrune(t *testing.T) {
+	d := install(t, "1.0", "1.1", "1.2", "1.3", "1.4", "1.5")
+	d.Switch("1.1")
+	d.Switch("1.4")
+
+	removed, err := d.Prune(3, "1.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"1.2"}; !slices.Equal(removed, want) {
+		t.Errorf("Prune() removed %q, want %q", removed, want)
+	}
+	list, _ := d.List()
+	if want := []string{"1.0", "1.1", "1.3", "1.4", "1.5"}; !slices.Equal(list, want) {
+		t.Errorf("List() = %q after Prune, want %q (current, previous and protected kept)", list, want)
+	}
+	if removed, _ := d.Prune(0); len(removed) != 0 {
+		t.Errorf("Prune(0) removed %q, want nothing", removed)
+	}
+}
+
+func TestPruneSkipsInUse(t *testing.T) {
+	d := install(t, "1.0", "1.1", "1.2")
+	d.Switch("1.2")
+
+	lock, err := d.Use("1.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Launches running the same version share the lock
+	second, err := d.Use("1.0")
+	if err != nil {
+		t.Fatalf("second Use() error = %v", err)
+	}
+	second.Release()
+	removed, err := d.Prune(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"1.1"}; !slices.Equal(removed, want) {
+		t.Errorf("Prune() removed %q while 1.0 runs, want %q", removed, want)
+	}
+	if _, err := d.Use("1.1"); err == nil {
+		t.Error("Use() of a pruned version succeeded")
+	}
+
+	lock.Release()
+	if removed, err := d.Prune(1); err != nil || !slices.Equal(removed, []string{"1.0"}) {
+		t.Errorf("Prune() = %q, %v once 1.0 stopped; want it removed", removed, err)
+	}
+	if list, _ := d.List(); !slices.Equal(list, []string{"1.2"}) {
+		t.Errorf("List() = %q, want the lock folder hidden", list)
+	}
+}
+
+func TestUseReadOnly(t *testing.T) {
+	d := install(t, "1.0")
+	// The lock folder cannot be created, as in a read-only installation
+	if err := os.WriteFile(filepath.Join(string(d), ".in-use"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.Use("1.0"); !errors.Is(err, ErrNotMarked) {
+		t.Errorf("Use() error = %v, want ErrNotMarked", err)
+	}
+}
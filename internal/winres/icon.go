@@ -0,0 +1,70 @@
+package winres
+
+import (
+	"errors"
+	"fmt"
+)
+
+const (
+	icoHeaderSize   = 6
+	icoEntrySize    = 16
+	groupEntrySize  = 14
+	icoTypeIcon     = 1
+	maxIconsInGroup = 64
+)
+
+// SetIcon replaces the icon group name with the images of an .ico file. Each
+// image becomes an icon resource with a fresh ID; the icons of the group being
+// replaced are removed. Explorer shows the group that sorts first.
+func (s *Set) SetIcon(name Ident, ico []byte) error {
+	if len(ico) < icoHeaderSize || le.Uint16(ico) != 0 || le.Uint16(ico[2:]) != icoTypeIcon {
+		return errors.New("not an .ico file")
+	}
+	count := int(le.Uint16(ico[4:]))
+	if count == 0 || count > maxIconsInGroup {
+		return fmt.Errorf("invalid .ico file: %d images", count)
+	}
+	if len(ico) < icoHeaderSize+count*icoEntrySize {
+		return errors.New("invalid .ico file: truncated directory")
+	}
+
+	if old, ok := s.Find(IntID(TypeGroupIcon), name); ok {
+		for _, id := range groupIconIDs(old.Data) {
+			s.Remove(IntID(TypeIcon), IntID(id))
+		}
+		s.Remove(IntID(TypeGroupIcon), name)
+	}
+
+	next := s.nextID(IntID(TypeIcon))
+	group := make([]byte, icoHeaderSize, icoHeaderSize+count*groupEntrySize)
+	copy(group, ico[:icoHeaderSize])
+	for i := range count {
+		e := ico[icoHeaderSize+i*icoEntrySize:]
+		size, off := le.Uint32(e[8:]), le.Uint32(e[12:])
+		if size == 0 || uint64(off)+uint64(size) > uint64(len(ico)) {
+			return fmt.Errorf("invalid .ico file: image %d is out of bounds", i+1)
+		}
+		id := next + uint16(i)
+		s.Put(Resource{Type: IntID(TypeIcon), Name: IntID(id), Lang: LangEnUS, Data: ico[off : off+size]})
+		group = append(group, e[:12]...)
+		group = le.AppendUint16(group, id)
+	}
+	s.Put(Resource{Type: IntID(TypeGroupIcon), Name: name, Lang: LangEnUS, Data: group})
+	return nil
+}
+
+// groupIconIDs returns the icon IDs referenced by a group icon resource.
+func groupIconIDs(group []byte) []uint16 {
+	if len(group) < icoHeaderSize {
+		return nil
+	}
+	var ids []uint16
+	for i := range int(le.Uint16(group[4:])) {
+		off := icoHeaderSize + i*groupEntrySize
+		if off+groupEntrySize > len(group) {
+			break
+		}
+		ids = append(ids, le.Uint16(group[off+12:]))
+	}
+	return ids
+}
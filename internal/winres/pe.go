@@ -0,0 +1,431 @@
+package winres
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"unicode/utf16"
+)
+
+var le = binary.LittleEndian
+
+// Offsets within the optional header, shared by PE32 and PE32+.
+const (
+	optSectionAlignment = 32
+	optFileAlignment    = 36
+	optSizeOfImage      = 56
+	optSizeOfHeaders    = 60
+	optCheckSum         = 64
+)
+
+// Data directory indexes.
+const (
+	dirResource = 2
+	dirSecurity = 4
+)
+
+const (
+	sectionHeaderSize = 40
+	// rsrcCharacteristics is initialized, readable data.
+	rsrcCharacteristics = 0x40000040
+)
+
+type section struct {
+	hdrOff         int
+	virtualSize    uint32
+	virtualAddress uint32
+	rawSize        uint32
+	rawPtr         uint32
+}
+
+// image is a parsed PE file with the header offsets needed to edit it.
+type image struct {
+	data     []byte
+	coffOff  int
+	optOff   int
+	dirOff   int
+	numDirs  int
+	secOff   int
+	sections []section
+}
+
+func parse(data []byte) (*image, error) {
+	if len(data) < 0x40 || string(data[:2]) != "MZ" {
+		return nil, ErrNotPE
+	}
+	peOff := int(le.Uint32(data[0x3c:]))
+	if peOff < 0 || peOff+24 > len(data) || string(data[peOff:peOff+4]) != "PE\x00\x00" {
+		return nil, ErrNotPE
+	}
+	img := &image{data: data, coffOff: peOff + 4}
+	numSections := int(le.Uint16(data[img.coffOff+2:]))
+	optSize := int(le.Uint16(data[img.coffOff+16:]))
+	img.optOff = img.coffOff + 20
+	img.secOff = img.optOff + optSize
+	if img.secOff+numSections*sectionHeaderSize > len(data) || optSize < 2 {
+		return nil, fmt.Errorf("%w: truncated headers", ErrNotPE)
+	}
+
+	var numDirsOff int
+	switch magic := le.Uint16(data[img.optOff:]); magic {
+	case 0x10b:
+		numDirsOff, img.dirOff = img.optOff+92, img.optOff+96
+	case 0x20b:
+		numDirsOff, img.dirOff = img.optOff+108, img.optOff+112
+	default:
+		return nil, fmt.Errorf("%w: unknown optional header magic %#x", ErrNotPE, magic)
+	}
+	if img.dirOff > img.secOff {
+		return nil, fmt.Errorf("%w: truncated optional header", ErrNotPE)
+	}
+	img.numDirs = min(int(le.Uint32(data[numDirsOff:])), (img.secOff-img.dirOff)/8)
+
+	for i := range numSections {
+		off := img.secOff + i*sectionHeaderSize
+		img.sections = append(img.sections, section{
+			hdrOff:         off,
+			virtualSize:    le.Uint32(data[off+8:]),
+			virtualAddress: le.Uint32(data[off+12:]),
+			rawSize:        le.Uint32(data[off+16:]),
+			rawPtr:         le.Uint32(data[off+20:]),
+		})
+	}
+	return img, nil
+}
+
+func (img *image) opt(off int) uint32 { return le.Uint32(img.data[img.optOff+off:]) }
+
+func (img *image) dir(i int) (rva, size uint32) {
+	if i >= img.numDirs {
+		return 0, 0
+	}
+	return le.Uint32(img.data[img.dirOff+8*i:]), le.Uint32(img.data[img.dirOff+8*i+4:])
+}
+
+// slice returns the file bytes mapped at rva, up to size bytes.
+func (img *image) slice(rva, size uint32) ([]byte, error) {
+	for _, s := range img.sections {
+		if rva < s.virtualAddress || rva-s.virtualAddress >= s.rawSize {
+			continue
+		}
+		start := uint64(s.rawPtr) + uint64(rva-s.virtualAddress)
+		end := start + uint64(size)
+		if end > uint64(s.rawPtr)+uint64(s.rawSize) || end > uint64(len(img.data)) {
+			return nil, fmt.Errorf("resource data at RVA %#x runs past its section", rva)
+		}
+		return img.data[start:end], nil
+	}
+	return nil, fmt.Errorf("RVA %#x is not in any section", rva)
+}
+
+// ReadFile returns the resources of the executable at path.
+func ReadFile(path string) (Set, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Read(data)
+}
+
+// Read returns the resources of a PE image.
+func Read(data []byte) (Set, error) {
+	img, err := parse(data)
+	if err != nil {
+		return nil, err
+	}
+	rva, size := img.dir(dirResource)
+	if rva == 0 || size == 0 {
+		return nil, nil
+	}
+	root, err := img.slice(rva, size)
+	if err != nil {
+		return nil, err
+	}
+	var set Set
+	var walk func(off uint32, depth int, path []Ident) error
+	walk = func(off uint32, depth int, path []Ident) error {
+		if uint64(off)+16 > uint64(len(root)) {
+			return fmt.Errorf("resource directory at %#x is out of bounds", off)
+		}
+		n := int(le.Uint16(root[off+12:])) + int(le.Uint16(root[off+14:]))
+		if int(off)+16+8*n > len(root) {
+			return fmt.Errorf("resource directory at %#x is out of bounds", off)
+		}
+		for i := range n {
+			e := root[int(off)+16+8*i:]
+			id, err := readIdent(root, le.Uint32(e))
+			if err != nil {
+				return err
+			}
+			target := le.Uint32(e[4:])
+			subdir := target&0x80000000 != 0
+			target &^= 0x80000000
+			if depth < 2 {
+				if !subdir {
+					return fmt.Errorf("resource %v has data above the language level", append(path, id))
+				}
+				if err := walk(target, depth+1, append(path, id)); err != nil {
+					return err
+				}
+				continue
+			}
+			if subdir || uint64(target)+16 > uint64(len(root)) {
+				return fmt.Errorf("resource %v has an invalid data entry", path)
+			}
+			data, err := img.slice(le.Uint32(root[target:]), le.Uint32(root[target+4:]))
+			if err != nil {
+				return err
+			}
+			set = append(set, Resource{Type: path[0], Name: path[1], Lang: id.ID, Data: bytes.Clone(data)})
+		}
+		return nil
+	}
+	if err := walk(0, 0, nil); err != nil {
+		return nil, err
+	}
+	return set, nil
+}
+
+func readIdent(root []byte, v uint32) (Ident, error) {
+	if v&0x80000000 == 0 {
+		return IntID(uint16(v)), nil
+	}
+	off := uint64(v &^ 0x80000000)
+	if off+2 > uint64(len(root)) {
+		return Ident{}, fmt.Errorf("resource name at %#x is out of bounds", off)
+	}
+	n := uint64(le.Uint16(root[off:]))
+	if off+2+2*n > uint64(len(root)) {
+		return Ident{}, fmt.Errorf("resource name at %#x is out of bounds", off)
+	}
+	units := make([]uint16, n)
+	for i := range units {
+		units[i] = le.Uint16(root[off+2+2*uint64(i):])
+	}
+	return Ident{Name: string(utf16.Decode(units))}, nil
+}
+
+// Write returns a copy of the PE image with its resources replaced by set.
+// The resource section is rewritten in place when it is the last thing in the
+// file (as after an earlier Write); otherwise a new section is appended.
+func Write(data []byte, set Set) ([]byte, error) {
+	img, err := parse(data)
+	if err != nil {
+		return nil, err
+	}
+	if _, size := img.dir(dirSecurity); size != 0 {
+		return nil, ErrSigned
+	}
+	if img.numDirs <= dirResource {
+		return nil, fmt.Errorf("%w: no resource data directory", ErrNotPE)
+	}
+	sectionAlign := img.opt(optSectionAlignment)
+	fileAlign := img.opt(optFileAlignment)
+
+	out := bytes.Clone(data)
+	numSections := len(img.sections)
+	var hdrOff int
+	var rva uint32
+	if last, ok := img.reusableSection(); ok {
+		out = out[:last.rawPtr]
+		hdrOff, rva = last.hdrOff, last.virtualAddress
+	} else {
+		hdrOff = img.secOff + numSections*sectionHeaderSize
+		if !img.headerRoom(hdrOff) {
+			return nil, ErrNoRoom
+		}
+		rva = alignUp(img.opt(optSizeOfImage), sectionAlign)
+		numSections++
+	}
+
+	out = append(out, make([]byte, alignUp(len(out), int(fileAlign))-len(out))...)
+	rawPtr := uint32(len(out))
+	body := set.build(rva)
+	rawSize := alignUp(uint32(len(body)), fileAlign)
+	out = append(out, body...)
+	out = append(out, make([]byte, int(rawSize)-len(body))...)
+
+	h := out[hdrOff : hdrOff+sectionHeaderSize]
+	clear(h)
+	copy(h, ".rsrc")
+	le.PutUint32(h[8:], uint32(len(body)))
+	le.PutUint32(h[12:], rva)
+	le.PutUint32(h[16:], rawSize)
+	le.PutUint32(h[20:], rawPtr)
+	le.PutUint32(h[36:], rsrcCharacteristics)
+
+	le.PutUint16(out[img.coffOff+2:], uint16(numSections))
+	le.PutUint32(out[img.optOff+optSizeOfImage:], alignUp(rva+uint32(len(body)), sectionAlign))
+	le.PutUint32(out[img.dirOff+8*dirResource:], rva)
+	le.PutUint32(out[img.dirOff+8*dirResource+4:], uint32(len(body)))
+	le.PutUint32(out[img.optOff+optCheckSum:], checksum(out, img.optOff+optCheckSum))
+	return out, nil
+}
+
+// reusableSection returns the current resource section if it is the last
+// section both in memory and in the file.
+func (img *image) reusableSection() (section, bool) {
+	rva, _ := img.dir(dirResource)
+	if rva == 0 || len(img.sections) == 0 {
+		return section{}, false
+	}
+	last := img.sections[len(img.sections)-1]
+	if last.virtualAddress != rva || uint64(last.rawPtr)+uint64(last.rawSize) != uint64(len(img.data)) {
+		return section{}, false
+	}
+	for _, s := range img.sections {
+		if s.virtualAddress > last.virtualAddress {
+			return section{}, false
+		}
+	}
+	return last, true
+}
+
+// headerRoom reports whether a section header fits at off: inside the headers,
+// before the first section data, and over bytes that are still zero.
+func (img *image) headerRoom(off int) bool {
+	end := off + sectionHeaderSize
+	if end > int(img.opt(optSizeOfHeaders)) || end > len(img.data) {
+		return false
+	}
+	for _, s := range img.sections {
+		if s.rawSize > 0 && end > int(s.rawPtr) {
+			return false
+		}
+	}
+	for _, b := range img.data[off:end] {
+		if b != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// checksum computes the PE image checksum, skipping the checksum field itself.
+func checksum(data []byte, fieldOff int) uint32 {
+	var sum uint64
+	for i := 0; i < len(data); i += 2 {
+		if i == fieldOff || i == fieldOff+2 {
+			continue
+		}
+		w := uint64(data[i])
+		if i+1 < len(data) {
+			w |= uint64(data[i+1]) << 8
+		}
+		sum += w
+		sum = (sum & 0xffff) + (sum >> 16)
+	}
+	sum = (sum & 0xffff) + (sum >> 16)
+	return uint32(sum) + uint32(len(data))
+}
+
+// build lays out the resource directory for a section mapped at rva: the
+// directory tables, then names, then data entries, then the data itself.
+func (s Set) build(rva uint32) []byte {
+	type level struct {
+		id       Ident
+		children []*level
+		res      *Resource
+	}
+	root := &level{}
+	child := func(parent *level, id Ident) *level {
+		if n := len(parent.children); n > 0 && parent.children[n-1].id == id {
+			return parent.children[n-1]
+		}
+		l := &level{id: id}
+		parent.children = append(parent.children, l)
+		return l
+	}
+	sorted := s.sorted()
+	for i := range sorted {
+		r := &sorted[i]
+		name := child(child(root, r.Type), r.Name)
+		name.children = append(name.children, &level{id: IntID(r.Lang), res: r})
+	}
+
+	// Tables breadth first, so each level is contiguous.
+	var tables []*level
+	queue := []*level{root}
+	for len(queue) > 0 {
+		l := queue[0]
+		queue = queue[1:]
+		if l.res != nil {
+			continue
+		}
+		tables = append(tables, l)
+		queue = append(queue, l.children...)
+	}
+	offsets := map[*level]uint32{}
+	size := uint32(0)
+	for _, l := range tables {
+		offsets[l] = size
+		size += 16 + 8*uint32(len(l.children))
+	}
+	names := map[string]uint32{}
+	for _, l := range tables {
+		for _, c := range l.children {
+			if c.id.Name != "" {
+				if _, ok := names[c.id.Name]; !ok {
+					names[c.id.Name] = size
+					size += uint32(len(utf16le(c.id.Name))) + 2
+				}
+			}
+		}
+	}
+	size = alignUp(size, 4)
+	var leaves []*level
+	for _, l := range tables {
+		for _, c := range l.children {
+			if c.res != nil {
+				offsets[c] = size
+				size += 16
+				leaves = append(leaves, c)
+			}
+		}
+	}
+	dataOff := map[*level]uint32{}
+	for _, l := range leaves {
+		size = alignUp(size, 8)
+		dataOff[l] = size
+		size += uint32(len(l.res.Data))
+	}
+
+	b := make([]byte, size)
+	for _, l := range tables {
+		off := offsets[l]
+		named := 0
+		for _, c := range l.children {
+			if c.id.Name != "" {
+				named++
+			}
+		}
+		le.PutUint16(b[off+12:], uint16(named))
+		le.PutUint16(b[off+14:], uint16(len(l.children)-named))
+		for i, c := range l.children {
+			e := b[off+16+8*uint32(i):]
+			if c.id.Name != "" {
+				le.PutUint32(e, 0x80000000|names[c.id.Name])
+			} else {
+				le.PutUint32(e, uint32(c.id.ID))
+			}
+			if c.res != nil {
+				le.PutUint32(e[4:], offsets[c])
+			} else {
+				le.PutUint32(e[4:], 0x80000000|offsets[c])
+			}
+		}
+	}
+	for name, off := range names {
+		units := utf16le(name)
+		le.PutUint16(b[off:], uint16(len(units)/2))
+		copy(b[off+2:], units)
+	}
+	for _, l := range leaves {
+		off := offsets[l]
+		le.PutUint32(b[off:], rva+dataOff[l])
+		le.PutUint32(b[off+4:], uint32(len(l.res.Data)))
+		copy(b[dataOff[l]:], l.res.Data)
+	}
+	return b
+}
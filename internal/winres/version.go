@@ -0,0 +1,114 @@
+package winres
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// VersionInfo is the content of a VERSIONINFO resource, shown on the Details
+// tab of the file properties.
+type VersionInfo struct {
+	FileVersion    Version
+	ProductVersion Version
+	// Strings holds fields such as CompanyName, FileDescription,
+	// LegalCopyright or ProductName. FileVersion and ProductVersion default
+	// to the numeric versions.
+	Strings map[string]string
+}
+
+// Version is a four-part Windows version number.
+type Version [4]uint16
+
+// ParseVersion accepts versions such as "1.2", "v1.2.3" or "1.2.3.4-rc1";
+// missing parts are zero and any suffix after '-' or '+' is ignored.
+func ParseVersion(s string) (Version, error) {
+	var v Version
+	t := strings.TrimPrefix(s, "v")
+	if i := strings.IndexAny(t, "-+"); i >= 0 {
+		t = t[:i]
+	}
+	parts := strings.Split(t, ".")
+	if t == "" || len(parts) > len(v) {
+		return v, fmt.Errorf("invalid version %q (expected up to four numbers, e.g. 1.2.3.4)", s)
+	}
+	for i, p := range parts {
+		n, err := strconv.ParseUint(p, 10, 16)
+		if err != nil {
+			return v, fmt.Errorf("invalid version %q (expected up to four numbers, e.g. 1.2.3.4)", s)
+		}
+		v[i] = uint16(n)
+	}
+	return v, nil
+}
+
+func (v Version) String() string {
+	return fmt.Sprintf("%d.%d.%d.%d", v[0], v[1], v[2], v[3])
+}
+
+func (v Version) ms() uint32 { return uint32(v[0])<<16 | uint32(v[1]) }
+func (v Version) ls() uint32 { return uint32(v[2])<<16 | uint32(v[3]) }
+
+// codePageUnicode is the code page of the string table (UTF-16).
+const codePageUnicode = 1200
+
+// Bytes encodes v as a VS_VERSIONINFO structure.
+func (v VersionInfo) Bytes() []byte {
+	fixed := make([]byte, 52)
+	le.PutUint32(fixed[0:], 0xfeef04bd) // signature
+	le.PutUint32(fixed[4:], 0x00010000) // structure version
+	le.PutUint32(fixed[8:], v.FileVersion.ms())
+	le.PutUint32(fixed[12:], v.FileVersion.ls())
+	le.PutUint32(fixed[16:], v.ProductVersion.ms())
+	le.PutUint32(fixed[20:], v.ProductVersion.ls())
+	le.PutUint32(fixed[24:], 0x3f)    // flags mask
+	le.PutUint32(fixed[32:], 0x40004) // VOS_NT_WINDOWS32
+	le.PutUint32(fixed[36:], 1)       // VFT_APP
+
+	strs := map[string]string{
+		"FileVersion":    v.FileVersion.String(),
+		"ProductVersion": v.ProductVersion.String(),
+	}
+	for k, val := range v.Strings {
+		strs[k] = val
+	}
+	keys := make([]string, 0, len(strs))
+	for k := range strs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var entries [][]byte
+	for _, k := range keys {
+		value := utf16z(strs[k])
+		entries = append(entries, versionNode(k, 1, value, uint16(len(value)/2)))
+	}
+	table := versionNode(fmt.Sprintf("%04X%04X", LangEnUS, codePageUnicode), 1, nil, 0, entries...)
+	translation := le.AppendUint16(le.AppendUint16(nil, LangEnUS), codePageUnicode)
+
+	return versionNode("VS_VERSION_INFO", 0, fixed, uint16(len(fixed)),
+		versionNode("StringFileInfo", 1, nil, 0, table),
+		versionNode("VarFileInfo", 1, nil, 0, versionNode("Translation", 0, translation, uint16(len(translation)))),
+	)
+}
+
+// versionNode encodes one node of the version tree: length, value length,
+// type, key, then the value and children, each aligned to 32 bits.
+func versionNode(key string, typ uint16, value []byte, valueLen uint16, children ...[]byte) []byte {
+	b := make([]byte, 6)
+	b = append(b, utf16z(key)...)
+	b = pad32(b)
+	b = append(b, value...)
+	for _, c := range children {
+		b = pad32(b)
+		b = append(b, c...)
+	}
+	le.PutUint16(b[0:], uint16(len(b)))
+	le.PutUint16(b[2:], valueLen)
+	le.PutUint16(b[4:], typ)
+	return b
+}
+
+func pad32(b []byte) []byte {
+	return append(b, make([]byte, alignUp(len(b), 4)-len(b))...)
+}
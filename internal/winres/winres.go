@@ -0,0 +1,160 @@
+// Package winres reads and writes the resources of Windows PE executables
+// (icons, version information, manifests, raw data) in pure Go, so release
+// tooling can brand a prebuilt launcher on any platform.
+package winres
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf16"
+)
+
+// Standard resource types.
+const (
+	TypeIcon      uint16 = 3
+	TypeRCData    uint16 = 10
+	TypeGroupIcon uint16 = 14
+	TypeVersion   uint16 = 16
+	TypeManifest  uint16 = 24
+)
+
+// LangEnUS is the language resources are written with.
+const LangEnUS uint16 = 0x0409
+
+// Resource names the launcher reads its baked configuration from.
+const (
+	ConfigName    = "GJG_CONFIG"
+	ConfigSigName = "GJG_CONFIG_SIG"
+)
+
+var (
+	ErrNotPE  = errors.New("not a PE executable")
+	ErrSigned = errors.New("executable has an Authenticode signature; stamp it before signing")
+	ErrNoRoom = errors.New("no room for another section header")
+)
+
+// Ident is a resource type or name: a string when Name is set, otherwise a
+// numeric ID.
+type Ident struct {
+	ID   uint16
+	Name string
+}
+
+// IntID returns a numeric identifier.
+func IntID(id uint16) Ident { return Ident{ID: id} }
+
+// StringID returns a named identifier. Windows compares names in upper case.
+func StringID(name string) Ident { return Ident{Name: strings.ToUpper(name)} }
+
+func (i Ident) String() string {
+	if i.Name != "" {
+		return i.Name
+	}
+	return fmt.Sprintf("#%d", i.ID)
+}
+
+// less orders identifiers as the resource directory requires: names first,
+// then IDs in ascending order.
+func (i Ident) less(j Ident) bool {
+	if (i.Name != "") != (j.Name != "") {
+		return i.Name != ""
+	}
+	if i.Name != "" {
+		return i.Name < j.Name
+	}
+	return i.ID < j.ID
+}
+
+// Resource is one leaf of the resource tree.
+type Resource struct {
+	Type Ident
+	Name Ident
+	Lang uint16
+	Data []byte
+}
+
+// Set is the list of resources of an executable.
+type Set []Resource
+
+// Put adds r, replacing a resource with the same type, name and language.
+func (s *Set) Put(r Resource) {
+	for i, e := range *s {
+		if e.Type == r.Type && e.Name == r.Name && e.Lang == r.Lang {
+			(*s)[i] = r
+			return
+		}
+	}
+	*s = append(*s, r)
+}
+
+// Remove deletes the resource typ/name in every language.
+func (s *Set) Remove(typ, name Ident) {
+	kept := (*s)[:0]
+	for _, e := range *s {
+		if e.Type != typ || e.Name != name {
+			kept = append(kept, e)
+		}
+	}
+	*s = kept
+}
+
+// Find returns the first resource typ/name, whatever its language.
+func (s Set) Find(typ, name Ident) (Resource, bool) {
+	for _, e := range s {
+		if e.Type == typ && e.Name == name {
+			return e, true
+		}
+	}
+	return Resource{}, false
+}
+
+// nextID returns an ID above every numeric name of type typ.
+func (s Set) nextID(typ Ident) uint16 {
+	next := uint16(1)
+	for _, e := range s {
+		if e.Type == typ && e.Name.Name == "" && e.Name.ID >= next {
+			next = e.Name.ID + 1
+		}
+	}
+	return next
+}
+
+// sorted returns the resources in directory order.
+func (s Set) sorted() Set {
+	out := append(Set(nil), s...)
+	sort.SliceStable(out, func(i, j int) bool {
+		a, b := out[i], out[j]
+		if a.Type != b.Type {
+			return a.Type.less(b.Type)
+		}
+		if a.Name != b.Name {
+			return a.Name.less(b.Name)
+		}
+		return a.Lang < b.Lang
+	})
+	return out
+}
+
+// utf16z encodes s as NUL-terminated little-endian UTF-16.
+func utf16z(s string) []byte {
+	b := utf16le(s)
+	return append(b, 0, 0)
+}
+
+func utf16le(s string) []byte {
+	units := utf16.Encode([]rune(s))
+	b := make([]byte, 2*len(units))
+	for i, u := range units {
+		le.PutUint16(b[2*i:], u)
+	}
+	return b
+}
+
+func alignUp[T ~int | ~uint32](n, align T) T {
+	if align == 0 {
+		return n
+	}
+	return (n + align - 1) / align * align
+}
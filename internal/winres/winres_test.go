@@ -0,0 +1,278 @@
+package winres
+
+import (
+	"bytes"
+	"debug/pe"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// minimalPE builds a PE32+ image with one .text section and room for more
+// section headers.
+func minimalPE() []byte {
+	b := make([]byte, 0x400)
+	copy(b, "MZ")
+	le.PutUint32(b[0x3c:], 0x40)
+	copy(b[0x40:], "PE\x00\x00")
+	coff := b[0x44:]
+	le.PutUint16(coff[0:], pe.IMAGE_FILE_MACHINE_AMD64)
+	le.PutUint16(coff[2:], 1)
+	le.PutUint16(coff[16:], 240)
+	le.PutUint16(coff[18:], pe.IMAGE_FILE_EXECUTABLE_IMAGE|pe.IMAGE_FILE_LARGE_ADDRESS_AWARE)
+	opt := b[0x58:]
+	le.PutUint16(opt[0:], 0x20b)
+	le.PutUint32(opt[16:], 0x1000) // entry point
+	le.PutUint64(opt[24:], 0x140000000)
+	le.PutUint32(opt[optSectionAlignment:], 0x1000)
+	le.PutUint32(opt[optFileAlignment:], 0x200)
+	le.PutUint16(opt[48:], 6) // subsystem version
+	le.PutUint32(opt[optSizeOfImage:], 0x2000)
+	le.PutUint32(opt[optSizeOfHeaders:], 0x200)
+	le.PutUint16(opt[68:], pe.IMAGE_SUBSYSTEM_WINDOWS_GUI)
+	le.PutUint32(opt[108:], 16)
+	text := b[0x58+240:]
+	copy(text, ".text")
+	le.PutUint32(text[8:], 1)
+	le.PutUint32(text[12:], 0x1000)
+	le.PutUint32(text[16:], 0x200)
+	le.PutUint32(text[20:], 0x200)
+	le.PutUint32(text[36:], pe.IMAGE_SCN_CNT_CODE|pe.IMAGE_SCN_MEM_EXECUTE|pe.IMAGE_SCN_MEM_READ)
+	b[0x200] = 0xc3 // ret
+	return b
+}
+
+// testICO builds an .ico file with two images.
+func testICO() []byte {
+	images := [][]byte{bytes.Repeat([]byte{1}, 40), bytes.Repeat([]byte{2}, 24)}
+	b := le.AppendUint16(le.AppendUint16(le.AppendUint16(nil, 0), 1), uint16(len(images)))
+	off := icoHeaderSize + len(images)*icoEntrySize
+	for i, img := range images {
+		size := byte(16 * (i + 1))
+		b = append(b, size, size, 0, 0)
+		b = le.AppendUint16(le.AppendUint16(b, 1), 32)
+		b = le.AppendUint32(le.AppendUint32(b, uint32(len(img))), uint32(off))
+		off += len(img)
+	}
+	for _, img := range images {
+		b = append(b, img...)
+	}
+	return b
+}
+
+func resourceDir(t *testing.T, data []byte) (*pe.Section, pe.DataDirectory) {
+	t.Helper()
+	f, err := pe.NewFile(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("debug/pe cannot parse the output: %v", err)
+	}
+	dir := f.OptionalHeader.(*pe.OptionalHeader64).DataDirectory[pe.IMAGE_DIRECTORY_ENTRY_RESOURCE]
+	s := f.Section(".rsrc")
+	if s == nil {
+		t.Fatalf("no .rsrc section in %d sections", len(f.Sections))
+	}
+	if dir.VirtualAddress != s.VirtualAddress || dir.Size != s.VirtualSize {
+		t.Errorf("resource directory = %+v, want .rsrc at %#x size %d", dir, s.VirtualAddress, s.VirtualSize)
+	}
+	return s, dir
+}
+
+func TestWriteAndRead(t *testing.T) {
+	var set Set
+	if err := set.SetIcon(IntID(1), testICO()); err != nil {
+		t.Fatal(err)
+	}
+	info := VersionInfo{FileVersion: Version{1, 2, 3, 4}, ProductVersion: Version{1, 2, 0, 0}, Strings: map[string]string{"ProductName": "My App"}}
+	set.Put(Resource{Type: IntID(TypeVersion), Name: IntID(1), Lang: LangEnUS, Data: info.Bytes()})
+	set.Put(Resource{Type: IntID(TypeManifest), Name: IntID(1), Lang: LangEnUS, Data: []byte("<assembly/>")})
+	set.Put(Resource{Type: IntID(TypeRCData), Name: StringID(ConfigName), Lang: LangEnUS, Data: []byte("jvm_args=-Xmx1g\n")})
+
+	out, err := Write(minimalPE(), set)
+	if err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	s, _ := resourceDir(t, out)
+	if s.Characteristics != rsrcCharacteristics {
+		t.Errorf(".rsrc characteristics = %#x", s.Characteristics)
+	}
+
+	got, err := Read(out)
+	if err != nil {
+		t.Fatalf("Read() error = %v", err)
+	}
+	if len(got) != 6 {
+		t.Fatalf("Read() = %d resources, want 6 (2 icons, group, version, manifest, config)", len(got))
+	}
+	// Named types and names sort before numeric ones.
+	if r := got[0]; r.Type != IntID(TypeIcon) || r.Name != IntID(1) || !bytes.Equal(r.Data, bytes.Repeat([]byte{1}, 40)) {
+		t.Errorf("first resource = %v/%v, want the first icon image", r.Type, r.Name)
+	}
+	cfg, ok := got.Find(IntID(TypeRCData), StringID(ConfigName))
+	if !ok || string(cfg.Data) != "jvm_args=-Xmx1g\n" {
+		t.Errorf("config resource = %q, %v", cfg.Data, ok)
+	}
+	group, _ := got.Find(IntID(TypeGroupIcon), IntID(1))
+	if ids := groupIconIDs(group.Data); len(ids) != 2 || ids[0] != 1 || ids[1] != 2 {
+		t.Errorf("group icon IDs = %v, want [1 2]", ids)
+	}
+	ver, _ := got.Find(IntID(TypeVersion), IntID(1))
+	if !bytes.Contains(ver.Data, utf16le("My App")) || !bytes.Contains(ver.Data, utf16le("1.2.3.4")) {
+		t.Error("version info is missing its strings")
+	}
+	if int(le.Uint16(ver.Data)) != len(ver.Data) {
+		t.Errorf("version info length = %d, want %d", le.Uint16(ver.Data), len(ver.Data))
+	}
+}
+
+func TestWriteTwiceReusesSection(t *testing.T) {
+	set := Set{{Type: IntID(TypeManifest), Name: IntID(1), Lang: LangEnUS, Data: []byte("one")}}
+	first, err := Write(minimalPE(), set)
+	if err != nil {
+		t.Fatal(err)
+	}
+	set, err = Read(first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := set.SetIcon(IntID(1), testICO()); err != nil {
+		t.Fatal(err)
+	}
+	if err := set.SetIcon(IntID(1), testICO()); err != nil {
+		t.Fatal(err)
+	}
+	second, err := Write(first, set)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := pe.NewFile(bytes.NewReader(second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(f.Sections) != 2 {
+		t.Errorf("sections = %d, want .text and a single .rsrc", len(f.Sections))
+	}
+	got, err := Read(second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 4 {
+		t.Errorf("Read() = %d resources, want manifest, group and 2 icons (replaced, not added)", len(got))
+	}
+	if m, ok := got.Find(IntID(TypeManifest), IntID(1)); !ok || string(m.Data) != "one" {
+		t.Errorf("manifest = %q, want existing resources kept", m.Data)
+	}
+}
+
+func TestWriteErrors(t *testing.T) {
+	signed := minimalPE()
+	le.PutUint32(signed[0x58+112+8*dirSecurity+4:], 100)
+	if _, err := Write(signed, nil); !errors.Is(err, ErrSigned) {
+		t.Errorf("Write(signed) error = %v, want ErrSigned", err)
+	}
+	if _, err := Write([]byte("#!/bin/sh\n"), nil); !errors.Is(err, ErrNotPE) {
+		t.Errorf("Write(script) error = %v, want ErrNotPE", err)
+	}
+	var set Set
+	if err := set.SetIcon(IntID(1), []byte("PNG")); err == nil {
+		t.Error("SetIcon() expected error for a non-ico file")
+	}
+}
+
+func TestParseVersion(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Version
+		wantErr bool
+	}{
+		{"1.2.3.4", Version{1, 2, 3, 4}, false},
+		{"v2.1", Version{2, 1, 0, 0}, false},
+		{"1.0.0-rc1", Version{1, 0, 0, 0}, false},
+		{"1.2.3.4.5", Version{}, true},
+		{"dev", Version{}, true},
+		{"", Version{}, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseVersion(tt.in)
+		if (err != nil) != tt.wantErr || (!tt.wantErr && got != tt.want) {
+			t.Errorf("ParseVersion(%q) = %v, %v; want %v, error %v", tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+// TestWriteGoBinary stamps a real Windows build of the launcher. Go's linker
+// puts a COFF symbol table after the sections, which must survive the write.
+func TestWriteGoBinary(t *testing.T) {
+	if testing.Short() {
+		t.Skip("builds the launcher")
+	}
+	goTool, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("go tool not found")
+	}
+	exe := filepath.Join(t.TempDir(), "launcher.exe")
+	cmd := exec.Command(goTool, "build", "-o", exe, "gjg/cmd/launcher")
+	cmd.Env = append(os.Environ(), "GOOS=windows", "GOARCH=amd64", "CGO_ENABLED=0")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("go build: %v\n%s", err, out)
+	}
+	data, err := os.ReadFile(exe)
+	if err != nil {
+		t.Fatal(err)
+	}
+	orig, err := pe.NewFile(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if orig.PointerToSymbolTable == 0 || len(orig.Symbols) == 0 {
+		t.Fatal("the build has no COFF symbol table")
+	}
+
+	var set Set
+	if err := set.SetIcon(IntID(1), testICO()); err != nil {
+		t.Fatal(err)
+	}
+	set.Put(Resource{Type: IntID(TypeRCData), Name: StringID(ConfigName), Lang: LangEnUS, Data: []byte("jvm_args=-Xmx1g\n")})
+	out, err := Write(data, set)
+	if err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	// Stamping again rewrites the appended section in place.
+	set.Put(Resource{Type: IntID(TypeRCData), Name: StringID(ConfigName), Lang: LangEnUS, Data: []byte("jvm_args=-Xmx2g\n")})
+	if out, err = Write(out, set); err != nil {
+		t.Fatalf("second Write() error = %v", err)
+	}
+
+	resourceDir(t, out)
+	f, err := pe.NewFile(bytes.NewReader(out))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(f.Sections) != len(orig.Sections)+1 {
+		t.Errorf("sections = %d, want %d plus .rsrc", len(f.Sections), len(orig.Sections))
+	}
+	if f.PointerToSymbolTable != orig.PointerToSymbolTable || !reflect.DeepEqual(f.Symbols, orig.Symbols) || !reflect.DeepEqual(f.StringTable, orig.StringTable) {
+		t.Errorf("symbol table changed: %d symbols at %#x, want %d at %#x",
+			len(f.Symbols), f.PointerToSymbolTable, len(orig.Symbols), orig.PointerToSymbolTable)
+	}
+	for _, s := range orig.Sections {
+		want, _ := s.Data()
+		got, _ := f.Section(s.Name).Data()
+		if !bytes.Equal(got, want) {
+			t.Errorf("section %s changed", s.Name)
+		}
+	}
+
+	got, err := Read(out)
+	if err != nil {
+		t.Fatalf("Read() error = %v", err)
+	}
+	if len(got) != 4 {
+		t.Errorf("Read() = %d resources, want 2 icons, group and config", len(got))
+	}
+	if cfg, ok := got.Find(IntID(TypeRCData), StringID(ConfigName)); !ok || string(cfg.Data) != "jvm_args=-Xmx2g\n" {
+		t.Errorf("config resource = %q, %v", cfg.Data, ok)
+	}
+}
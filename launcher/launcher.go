@@ -0,0 +1,766 @@
+// Package launcher loads a gjg configuration, resolves it into a launch plan
+// and runs it. The gjg executable is a thin wrapper around it; other tools
+// can use it to launch an application the same way.
+package launcher
+
+import (
+	"context"
+	"crypto/ed25519"
+	"errors"
+	"fmt"
+	"gjg/internal/config"
+	"gjg/internal/crash"
+	"gjg/internal/history"
+	"gjg/internal/hooks"
+	"gjg/internal/instance"
+	"gjg/internal/jnlp"
+	"gjg/internal/lockfile"
+	"gjg/internal/manifest"
+	"gjg/internal/maven"
+	"gjg/internal/paths"
+	"gjg/internal/perm"
+	"gjg/internal/plan"
+	"gjg/internal/redact"
+	"gjg/internal/runner"
+	"gjg/internal/runtimes"
+	"gjg/internal/signature"
+	"gjg/internal/update"
+	"gjg/internal/versions"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Config is a parsed configuration file.
+type Config = config.Config
+
+// LaunchPlan is a fully resolved launch, see Plan.
+type LaunchPlan = plan.LaunchPlan
+
+// PlanSchemaVersion is the version of the LaunchPlan JSON format.
+const PlanSchemaVersion = plan.SchemaVersion
+
+// FailureReportName is the file written to the cache directory when Java fails.
+const FailureReportName = "gjg-failure-report.txt"
+
+// ErrAlreadyRunning is returned by Run when single_instance is enabled,
+// another instance holds the lock and the policy is exit.
+var ErrAlreadyRunning = instance.ErrAlreadyRunning
+
+// Options describes the process the launcher acts for. Zero fields use the
+// current process.
+type Options struct {
+	// Executable is the launcher path; the config file name and the cache
+	// directory derive from it.
+	Executable string
+	// Root is searched for the config file after the executable's directory,
+	// normally the working directory.
+	Root string
+	// SearchPolicy overrides where the config file may be found: exe,
+	// exe+cwd or dev. Empty uses the policy baked into the build.
+	SearchPolicy string
+	// BakedConfig is the base configuration the config file is layered
+	// over. Nil uses the one built into the executable, if any.
+	BakedConfig []byte
+	// Environ is the inherited environment the configuration is merged into.
+	Environ []string
+	// CacheDir holds logs, the heap fallback cache, failure reports and the
+	// single-instance lock.
+	CacheDir string
+	// Stdout and Stderr receive the application's output.
+	Stdout io.Writer
+	Stderr io.Writer
+	// Logger receives the launcher's own messages. Nil discards them.
+	Logger *slog.Logger
+	// Version is the launcher version recorded in the launch history.
+	Version string
+	// PublicKey requires signed configuration, manifests and plans. Nil uses
+	// the key embedded at build time, if any.
+	PublicKey ed25519.PublicKey
+	// UseVersion runs this version of a versioned layout instead of the
+	// current one.
+	UseVersion string
+	// RuntimesDir is the shared cache of Java runtimes downloaded for
+	// java_download. Empty uses the per-user default.
+	RuntimesDir string
+	// JNLP is a .jnlp URL or absolute path launched instead of the jnlp
+	// key; the config file is then optional.
+	JNLP string
+	// MavenDir is the shared local repository of dependency jars. Empty uses
+	// the per-user default.
+	MavenDir string
+}
+
+func (o Options) configOptions() config.Options {
+	return config.Options{
+		Executable:   o.Executable,
+		Root:         o.Root,
+		Environ:      o.Environ,
+		CacheDir:     o.CacheDir,
+		SearchPolicy: o.SearchPolicy,
+		PublicKey:    o.PublicKey,
+		Baked:        o.BakedConfig,
+		UseVersion:   o.UseVersion,
+		RuntimesDir:  o.RuntimesDir,
+		JNLP:         o.JNLP,
+		MavenDir:     o.MavenDir,
+	}
+}
+
+func (o Options) publicKey() (ed25519.PublicKey, error) {
+	if o.PublicKey != nil {
+		return o.PublicKey, nil
+	}
+	return signature.EmbeddedKey()
+}
+
+func (o Options) logger() *slog.Logger {
+	if o.Logger == nil {
+		return slog.New(slog.DiscardHandler)
+	}
+	return o.Logger
+}
+
+func (o Options) exeName() string {
+	if o.Executable == "" {
+		return paths.ExeName()
+	}
+	return paths.BaseName(o.Executable)
+}
+
+func (o Options) cacheDir() (string, error) {
+	switch {
+	case o.CacheDir != "":
+		return o.CacheDir, nil
+	case o.Executable != "":
+		return paths.CacheDirFor(o.Executable)
+	}
+	return paths.AppCacheDir()
+}
+
+// Load finds and parses the configuration file. Its path is returned even
+// when parsing fails.
+func Load(opts Options) (*Config, string, error) {
+	return opts.configOptions().Load()
+}
+
+// SearchPaths returns the candidate configuration files in lookup order.
+func SearchPaths(opts Options) ([]string, error) {
+	return opts.configOptions().SearchPaths()
+}
+
+// InsecurePaths returns the config file and jar, or the folders holding
+// them, when users other than the owner can modify them.
+func InsecurePaths(cfg *Config, confPath string) []string {
+	paths := []string{confPath}
+	if cfg.JarFileAbsolutePath != "" {
+		paths = append(paths, cfg.JarFileAbsolutePath)
+	}
+	return perm.Insecure(perm.Default, append(paths, cfg.Classpath...)...)
+}
+
+// Plan resolves cfg, loaded from confPath, into a launch plan. forwardArgs
+// are appended to the application arguments. A Java download, JNLP
+// application or dependencies cfg names must be resolved first, see Resolve.
+func Plan(cfg *Config, confPath string, forwardArgs []string) (*LaunchPlan, error) {
+	return plan.Build(cfg, confPath, forwardArgs)
+}
+
+// Prepare readies cfg, loaded from confPath, for a launch: it installs an
+// update an earlier launch downloaded, removes versions beyond keep_versions
+// and resolves cfg (see Resolve). It returns the configuration to plan,
+// loaded again when the update changed it. Only failures to resolve are
+// returned; a failed install or prune is logged and the launch goes on.
+func Prepare(ctx context.Context, cfg *Config, confPath string, opts Options) (*Config, string, error) {
+	log := opts.logger()
+	installed, err := ApplyUpdate(cfg, confPath)
+	switch {
+	case err != nil:
+		log.Warn("Failed to install update", "error", err)
+	case installed != "":
+		log.Info("Update installed", "version", installed)
+		if cfg, confPath, err = Load(opts); err != nil {
+			return nil, confPath, err
+		}
+	}
+	removed, err := PruneVersions(cfg, confPath)
+	for _, v := range removed {
+		log.Debug("Removed old version", "version", v)
+	}
+	if err != nil {
+		log.Warn("Failed to remove old versions", "error", err)
+	}
+	return Resolve(ctx, cfg, confPath, opts)
+}
+
+// Resolve downloads the Java runtime of java_download when no suitable Java
+// was found, fetches the JNLP application and resolves the dependencies of
+// cfg, so that Plan has everything the command line needs. It returns the
+// configuration to plan, loaded again when a runtime was installed.
+// Cancelling ctx stops the downloads.
+func Resolve(ctx context.Context, cfg *Config, confPath string, opts Options) (*Config, string, error) {
+	log := opts.logger()
+	if cfg.JavaDownload.Pending {
+		log.Info("No suitable Java found; downloading runtime", "version", cfg.JavaDownload.Version, "url", cfg.JavaDownload.URL)
+		if _, err := ProvisionJava(ctx, cfg); err != nil {
+			return nil, confPath, err
+		}
+		log.Info("Java runtime installed", "path", cfg.JavaDownload.Dir)
+		var err error
+		if cfg, confPath, err = Load(opts); err != nil {
+			return nil, confPath, err
+		}
+	}
+	if err := ResolveJNLP(ctx, cfg, opts); err != nil {
+		return nil, confPath, err
+	}
+	if err := ResolveDependencies(ctx, cfg, opts); err != nil {
+		return nil, confPath, err
+	}
+	return cfg, confPath, nil
+}
+
+// ApplyUpdate installs an update of cfg's installation downloaded by an
+// earlier launch. It returns the installed version, or "" when there was
+// none; the configuration must then be loaded again, as it may have changed.
+func ApplyUpdate(cfg *Config, confPath string) (string, error) {
+	if cfg.Update.URL == "" {
+		return "", nil
+	}
+	return update.Updater{Dir: filepath.Dir(confPath)}.Apply()
+}
+
+// ProvisionJava downloads the runtime java_download provides when cfg found
+// no suitable Java and it is not in the runtimes cache yet. It reports
+// whether it installed one; the configuration must then be loaded again.
+func ProvisionJava(ctx context.Context, cfg *Config) (bool, error) {
+	dl := cfg.JavaDownload
+	if !dl.Pending {
+		return false, nil
+	}
+	spec := runtimes.Spec{URL: dl.URL, SHA256: dl.SHA256, Version: dl.Version}
+	if _, err := runtimes.Install(ctx, nil, filepath.Dir(dl.Dir), spec); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// ResolveJNLP fetches the JNLP descriptor of cfg and its jars, revalidating
+// cached copies, and sets cfg up to launch its main class. Features the
+// launcher ignores are logged as warnings.
+func ResolveJNLP(ctx context.Context, cfg *Config, opts Options) error {
+	if cfg.JNLP.Source == "" {
+		return nil
+	}
+	log := opts.logger()
+	app, err := jnlp.Cache{Dir: cfg.JNLP.CacheDir}.Resolve(ctx, cfg.JNLP.Source)
+	if err != nil {
+		return fmt.Errorf("JNLP %s: %w", cfg.JNLP.Source, err)
+	}
+	cfg.MainClass = app.MainClass
+	cfg.Classpath = app.Classpath
+	cfg.JNLP.JVMArgs = app.JVMArgs
+	cfg.JNLP.AppArgs = app.Args
+	cfg.JNLP.Resolved = true
+
+	for _, f := range app.Unsupported {
+		log.Warn("Unsupported JNLP feature ignored", "feature", f)
+	}
+	if app.Offline {
+		log.Warn("JNLP server unreachable; using cached files", "source", cfg.JNLP.Source)
+	}
+	if want := strings.Fields(app.JavaVersion); len(want) > 0 {
+		v := strings.TrimRight(want[0], "+*")
+		if !runtimes.Suitable(cfg.JavaExecutableAbsolutePath, v) {
+			log.Warn("Java may not match the version the JNLP file asks for", "wanted", app.JavaVersion, "java", cfg.JavaExecutableAbsolutePath, "version", runtimes.ReleaseVersion(cfg.JavaExecutableAbsolutePath))
+		}
+	}
+	return nil
+}
+
+// ResolveDependencies adds the jars of cfg's dependency keys to its
+// classpath. The lock file pins them while the dependencies and repositories
+// are unchanged; otherwise they are resolved from the POMs and the lock file
+// is written again.
+func ResolveDependencies(ctx context.Context, cfg *Config, opts Options) error {
+	m := cfg.Maven
+	if len(m.Dependencies) == 0 {
+		return nil
+	}
+	log := opts.logger()
+	r := &maven.Resolver{Repositories: m.Repositories, Local: m.Local}
+	inputs := maven.Inputs(m.Dependencies, m.Repositories)
+	lock, err := maven.ReadLock(m.LockFile)
+	if err != nil {
+		log.Warn("Ignoring unreadable lock file", "path", m.LockFile, "error", err)
+		lock = nil
+	}
+	if lock != nil && lock.Inputs == inputs {
+		if err := r.Install(ctx, lock.Artifacts); err != nil {
+			return fmt.Errorf("dependencies from %s: %w", filepath.Base(m.LockFile), err)
+		}
+	} else {
+		coords := make([]maven.Coord, 0, len(m.Dependencies))
+		for _, d := range m.Dependencies {
+			c, err := maven.ParseCoord(d)
+			if err != nil {
+				return err
+			}
+			coords = append(coords, c)
+		}
+		artifacts, err := r.Resolve(ctx, coords)
+		if err != nil {
+			return fmt.Errorf("dependency resolution failed: %w", err)
+		}
+		lock = &maven.Lock{Inputs: inputs, Artifacts: artifacts}
+		if err := lock.Write(m.LockFile); err != nil {
+			log.Warn("Failed to write lock file", "path", m.LockFile, "error", err)
+		} else {
+			log.Info("Dependencies resolved", "count", len(artifacts), "lock", m.LockFile)
+		}
+	}
+	for _, a := range lock.Artifacts {
+		cfg.Classpath = append(cfg.Classpath, r.File(a))
+	}
+	cfg.Maven.Resolved = true
+	return nil
+}
+
+// RollbackVersion makes the previous version of cfg's versioned layout the
+// current one and returns it. The configuration must then be loaded again.
+func RollbackVersion(cfg *Config) (string, error) {
+	if cfg.Versions.Dir == "" {
+		return "", errors.New("--gjg-rollback needs versions_dir in the configuration")
+	}
+	return versions.Dir(cfg.Versions.Dir).Rollback()
+}
+
+// PruneVersions removes the oldest versions of cfg's versioned layout beyond
+// keep_versions, sparing the selected one and those other launches are
+// running. It returns the removed versions. While another launch installs
+// or downloads an update, nothing is pruned.
+func PruneVersions(cfg *Config, confPath string) ([]string, error) {
+	if cfg.Versions.Dir == "" {
+		return nil, nil
+	}
+	lock, err := lockfile.TryAcquire(update.LockPath(filepath.Dir(confPath)))
+	if errors.Is(err, lockfile.ErrLocked) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer lock.Release()
+	return versions.Dir(cfg.Versions.Dir).Prune(cfg.Versions.Keep, cfg.Versions.Selected)
+}
+
+// LoadPlan reads a plan written by LaunchPlan.Write. With a public key the
+// plan must be signed. A plan exported with its secrets masked cannot run.
+func LoadPlan(path string, opts Options) (*LaunchPlan, error) {
+	key, err := opts.publicKey()
+	if err != nil {
+		return nil, err
+	}
+	p, err := plan.Load(path, key)
+	if err != nil {
+		return nil, err
+	}
+	if p.Redacted {
+		return nil, fmt.Errorf("plan %s was exported with secret values masked; export it with --gjg-dry-run=json-unmasked to run it", path)
+	}
+	return p, nil
+}
+
+// Run executes p: it claims the single instance, installs a downloaded
+// update, runs the hooks and supervises Java until the restart policy stops.
+// It returns the exit code the launcher should exit with. Cancelling ctx
+// kills Java. The update keeps p's command line: a plan exported before an
+// update that changes the configuration should be exported again.
+func Run(ctx context.Context, p *LaunchPlan, opts Options) (int, error) {
+	log := opts.logger()
+	redactor, err := redact.New(p.Redact)
+	if err != nil {
+		return 1, err
+	}
+	key, err := opts.publicKey()
+	if err != nil {
+		return 1, err
+	}
+	cacheDir, cacheErr := opts.cacheDir()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	entry := history.Entry{
+		Time:            time.Now(),
+		LauncherVersion: opts.Version,
+		Profile:         p.Profile,
+		JavaVersion:     runtimes.ReleaseVersion(p.Executable),
+		ArgvHash:        history.HashArgv(p.Argv),
+	}
+
+	var replaced atomic.Bool
+	if p.SingleInstance.Scope != instance.ScopeOff {
+		if cacheErr != nil && p.SingleInstance.Scope == instance.ScopeUser {
+			return 1, fmt.Errorf("cannot determine cache directory for single-instance lock: %w", cacheErr)
+		}
+		dir := instance.Dir(p.SingleInstance.Scope, opts.exeName(), cacheDir)
+		inst, err := claimInstance(ctx, log, dir, p.SingleInstance.Scope, p.SingleInstance.Policy, p.ForwardArgs)
+		if inst == nil {
+			return exitCode(err), err
+		}
+		defer inst.Close()
+
+		err = inst.Serve(func(msg instance.Message) error {
+			switch msg.Action {
+			case instance.PolicyForward:
+				log.Info("Received arguments from another launch", "args", msg.Args)
+				return instance.AppendInbox(p.SingleInstance.Inbox, msg)
+			case instance.PolicyReplace:
+				log.Info("Replaced by another launch, stopping")
+				replaced.Store(true)
+				cancel()
+				return nil
+			}
+			return fmt.Errorf("unsupported action %q", msg.Action)
+		})
+		if err != nil {
+			log.Warn("Single-instance hand-off unavailable", "error", err)
+		}
+	}
+
+	// Install what an earlier launch downloaded before anything reads the
+	// installation; a second launch handing off to the running instance
+	// returned above and leaves its files alone.
+	var updater *update.Updater
+	trial := false
+	if p.Update.URL != "" {
+		updater = &update.Updater{
+			URL:             p.Update.URL,
+			Dir:             p.Update.Dir,
+			LauncherVersion: opts.Version,
+			Interval:        time.Duration(p.Update.Interval),
+			Timeout:         time.Duration(p.Update.Timeout),
+			PublicKey:       key,
+		}
+		if version, err := updater.Apply(); err != nil {
+			log.Warn("Failed to install update", "error", err)
+		} else if version != "" {
+			log.Info("Update installed", "version", version)
+		}
+		if st, err := updater.State(); err != nil {
+			log.Warn("Failed to read update state", "error", err)
+		} else {
+			trial = st.Trial
+		}
+	}
+
+	// Keep the running version from being pruned by other launches. A
+	// read-only installation cannot be pruned either, so it runs without.
+	var inUse *lockfile.Lock
+	if p.Versions.Dir != "" {
+		inUse, err = versions.Dir(p.Versions.Dir).Use(p.Versions.Selected)
+		switch {
+		case errors.Is(err, versions.ErrNotMarked):
+			log.Warn("Other launches may remove the running version", "error", err)
+		case err != nil:
+			return 1, err
+		}
+		defer inUse.Release()
+	}
+
+	console, err := runner.OpenConsole(runner.ConsoleLogs{
+		StdoutPath: p.Console.StdoutLog,
+		StderrPath: p.Console.StderrLog,
+		MaxSize:    p.Console.MaxSize,
+		Keep:       p.Console.Keep,
+		Timestamps: p.Console.Timestamps,
+		Stdout:     opts.Stdout,
+		Stderr:     opts.Stderr,
+	})
+	if err != nil {
+		return 1, fmt.Errorf("failed to open console log: %w", err)
+	}
+	defer console.Close()
+
+	heapFallback := runner.HeapFallback{Sizes: p.HeapFallback}
+	if cacheErr == nil {
+		heapFallback.CachePath = filepath.Join(cacheDir, "heap-fallback.txt")
+	}
+
+	// Keep the last stderr lines to explain startup failures
+	stderrTail := crash.NewTail(200)
+
+	cmd := runner.Command{
+		Argv:    p.Argv,
+		Env:     p.Env,
+		WorkDir: p.WorkDir,
+		Stdout:  console.Stdout,
+		Stderr:  runner.Tee(stderrTail, console.Stderr),
+		Exited: func(state *os.ProcessState) {
+			entry.Signal = runner.ExitSignal(state)
+		},
+	}
+	hookOpts := hooks.Options{
+		Env:       cmd.Env,
+		WorkDir:   cmd.WorkDir,
+		Timeout:   time.Duration(p.Hooks.Timeout),
+		OnFailure: p.Hooks.OnFailure,
+		Stdout:    console.Stdout,
+		Stderr:    console.Stderr,
+	}
+	if err := verify(log, p.Verify, key, cacheDir, cacheErr); err != nil {
+		return 1, err
+	}
+	if err := hooks.Run(ctx, "pre-launch", p.Hooks.PreLaunch, hookOpts, log); err != nil {
+		return 1, fmt.Errorf("pre-launch hook failed: %w", err)
+	}
+
+	if p.Exec == runner.ExecAuto {
+		if needs := execBlockers(p, opts); len(needs) > 0 {
+			log.Debug("Running Java as a child process", "neededBy", needs)
+		} else {
+			log.Debug("Replacing the launcher with Java")
+			if err := inUse.KeepOnExec(); err != nil {
+				return 1, err
+			}
+			// Nothing runs once Java replaced the launcher: record the launch
+			// now, without an outcome, and report no crash.
+			entry.Exec = true
+			recordHistory(log, entry, cacheDir, cacheErr)
+			return 1, fmt.Errorf("failed to exec Java: %w", runner.Exec(cmd))
+		}
+	}
+
+	if updater != nil {
+		checkCtx, stopCheck := context.WithCancel(context.Background())
+		defer stopCheck()
+		checked := make(chan struct{})
+		go func() {
+			defer close(checked)
+			version, err := updater.Check(checkCtx)
+			switch {
+			case err != nil:
+				log.Warn("Update check failed", "error", err)
+			case version != "":
+				log.Info("Update downloaded; it is installed on the next launch", "version", version)
+			}
+		}()
+		defer waitForUpdateCheck(log, checked, stopCheck, time.Duration(p.Update.Timeout))
+	}
+
+	runs := 0
+	code, err := runner.Supervise(ctx, p.RestartPolicy(), log, func(ctx context.Context) (int, error) {
+		runs++
+		stderrTail.Reset()
+		started := time.Now()
+		code, err := runner.RunWithHeapFallback(ctx, cmd, heapFallback, log)
+		if (code != 0 || err != nil) && ctx.Err() == nil {
+			r := crash.Analyze(code, err, started, redactor.Args(p.Argv), cmd.WorkDir, stderrTail.Lines())
+			reportFailure(log, r, cacheDir, cacheErr)
+		}
+		if trial {
+			trial = false
+			failed := (code != 0 || err != nil) && ctx.Err() == nil && time.Since(started) < update.StartupWindow
+			endTrial(log, updater, failed)
+		}
+		return code, err
+	})
+
+	entry.DurationMs = time.Since(entry.Time).Milliseconds()
+	entry.ExitCode = code
+	entry.Restarts = max(runs-1, 0)
+	entry.Stopped = ctx.Err() != nil
+	if err != nil {
+		entry.Error = redactor.String(err.Error())
+	}
+	recordHistory(log, entry, cacheDir, cacheErr)
+
+	if len(p.Hooks.PostExit) > 0 {
+		hookOpts.Env = append(slices.Clone(cmd.Env), fmt.Sprintf("GJG_EXIT_CODE=%d", code))
+		if err := hooks.Run(context.Background(), "post-exit", p.Hooks.PostExit, hookOpts, log); err != nil {
+			log.Error("Post-exit hook failed", "error", err)
+		}
+	}
+
+	if replaced.Load() {
+		return 0, nil
+	}
+	if err != nil && code == 0 {
+		code = 1
+	}
+	return code, err
+}
+
+// recordHistory appends entry to the launch history in the cache directory.
+func recordHistory(log *slog.Logger, entry history.Entry, cacheDir string, cacheErr error) {
+	if cacheErr != nil {
+		return
+	}
+	if err := (history.File{Path: filepath.Join(cacheDir, history.FileName)}).Append(entry); err != nil {
+		log.Warn("Failed to record launch history", "error", err)
+	}
+}
+
+// endTrial confirms a just-installed update, or rolls it back when it failed
+// to start. A restart then runs the previous version.
+func endTrial(log *slog.Logger, u *update.Updater, failed bool) {
+	if !failed {
+		if err := u.Confirm(); err != nil {
+			log.Warn("Failed to confirm update", "error", err)
+		}
+		return
+	}
+	version, err := u.Rollback()
+	if err != nil {
+		log.Error("Failed to roll back update", "error", err)
+		return
+	}
+	log.Error("Updated version failed to start; rolled back to the previous version", "version", version)
+}
+
+// waitForUpdateCheck gives a running update check up to timeout after Java
+// exits, then cancels it; it starts over on the next launch.
+func waitForUpdateCheck(log *slog.Logger, checked <-chan struct{}, stop context.CancelFunc, timeout time.Duration) {
+	select {
+	case <-checked:
+		return
+	default:
+	}
+	log.Debug("Waiting for the update check to finish", "timeout", timeout)
+	select {
+	case <-checked:
+	case <-time.After(timeout):
+		stop()
+		<-checked
+	}
+}
+
+// execBlockers returns what keeps Java from replacing the launcher process:
+// the platform, or features that need the launcher to outlive Java.
+func execBlockers(p *LaunchPlan, opts Options) []string {
+	var needs []string
+	if !runner.CanExec {
+		needs = append(needs, runtime.GOOS)
+	}
+	if policy := p.RestartPolicy(); policy.Mode != runner.RestartNever || len(policy.RestartExitCodes) > 0 {
+		needs = append(needs, "restart")
+	}
+	if len(p.HeapFallback) > 0 {
+		needs = append(needs, "heap_fallback")
+	}
+	if p.Console.StdoutLog != "" || p.Console.StderrLog != "" {
+		needs = append(needs, "console_log")
+	}
+	if p.SingleInstance.Scope != instance.ScopeOff && p.SingleInstance.Scope != "" {
+		needs = append(needs, "single_instance")
+	}
+	if len(p.Hooks.PostExit) > 0 {
+		needs = append(needs, "post_exit")
+	}
+	if p.Update.URL != "" {
+		needs = append(needs, "update_url")
+	}
+	if opts.Stdout != nil || opts.Stderr != nil {
+		needs = append(needs, "output redirection")
+	}
+	return needs
+}
+
+// claimInstance makes this launch the running instance, applying policy when
+// another one already holds the lock. A nil instance means this launch must
+// not continue; the error then says why, or is nil when it handed off.
+func claimInstance(ctx context.Context, log *slog.Logger, dir string, scope instance.Scope, policy instance.Policy, forwardArgs []string) (*instance.Instance, error) {
+	inst, err := instance.Acquire(dir, scope)
+	if err == nil {
+		return inst, nil
+	}
+	if !errors.Is(err, instance.ErrAlreadyRunning) {
+		return nil, fmt.Errorf("single-instance lock failed: %w", err)
+	}
+
+	cwd, _ := os.Getwd()
+	msg := instance.Message{Action: policy, Args: forwardArgs, WorkDir: cwd}
+	switch policy {
+	case instance.PolicyForward:
+		if err := instance.Send(dir, msg, 5*time.Second); err != nil {
+			return nil, fmt.Errorf("another instance is running and did not accept the arguments: %w", err)
+		}
+		log.Info("Another instance is already running; arguments forwarded to it")
+		return nil, nil
+	case instance.PolicyReplace:
+		log.Info("Another instance is already running; replacing it")
+		if err := instance.Send(dir, msg, 5*time.Second); err != nil {
+			return nil, fmt.Errorf("failed to stop the running instance: %w", err)
+		}
+		waitCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+		defer cancel()
+		inst, err := instance.AcquireWait(waitCtx, dir, scope)
+		if err != nil {
+			return nil, fmt.Errorf("the running instance did not exit: %w", err)
+		}
+		return inst, nil
+	}
+	return nil, ErrAlreadyRunning
+}
+
+// verify checks the installation against its manifest. Failures only stop
+// the launch in strict mode, except a bad manifest signature, which always does.
+// With a public key the check is always strict, whatever the plan says.
+func verify(log *slog.Logger, v plan.Verify, key ed25519.PublicKey, cacheDir string, cacheErr error) error {
+	if key != nil {
+		v.Mode = manifest.ModeStrict
+	}
+	if v.Mode == manifest.ModeOff || v.Mode == "" {
+		return nil
+	}
+	verifier := manifest.Verifier{Manifest: v.Manifest, Full: v.Full, PublicKey: key}
+	if cacheErr == nil {
+		verifier.StampPath = filepath.Join(cacheDir, "manifest-stamp.json")
+	}
+	started := time.Now()
+	err := verifier.Verify()
+	if err == nil {
+		log.Debug("Integrity check passed", "manifest", v.Manifest, "full", v.Full, "took", time.Since(started).Round(time.Millisecond))
+		return nil
+	}
+	if v.Mode == manifest.ModeStrict || errors.Is(err, signature.ErrUnsigned) || errors.Is(err, signature.ErrBadSignature) {
+		return err
+	}
+	log.Warn("Integrity check failed, launching anyway", "error", err)
+	return nil
+}
+
+func exitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	return 1
+}
+
+// reportFailure logs the suggested cause of a failed run and writes the
+// failure report to the cache directory.
+func reportFailure(log *slog.Logger, r crash.Report, cacheDir string, cacheErr error) {
+	if r.Cause != "" {
+		log.Error("Java failed", "cause", r.Cause)
+	}
+	for _, f := range r.CrashFiles {
+		log.Error("JVM crash file found", "path", f)
+	}
+
+	if cacheErr != nil {
+		return
+	}
+	reportPath := filepath.Join(cacheDir, FailureReportName)
+	if err := crash.WriteReport(reportPath, r); err != nil {
+		log.Warn("Failed to write failure report", "error", err)
+		return
+	}
+	log.Info("Failure report written", "path", reportPath)
+}
@@ -0,0 +1,759 @@
+package launcher
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gjg/internal/config"
+	"gjg/internal/fsutil"
+	"gjg/internal/history"
+	"gjg/internal/lockfile"
+	"gjg/internal/plan"
+	"gjg/internal/redact"
+	"gjg/internal/runner"
+	"gjg/internal/signature"
+	"gjg/internal/update"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestHelperProcess stands in for Java when Run is tested.
+func TestHelperProcess(t *testing.T) {
+	if os.Getenv("GJG_TEST_HELPER") != "1" {
+		return
+	}
+	if cacheDir := os.Getenv("GJG_TEST_EXEC_CACHE"); cacheDir != "" {
+		// Act as a launcher in exec mode, replaced by a plain helper
+		p := &LaunchPlan{
+			SchemaVersion: PlanSchemaVersion,
+			Executable:    os.Args[0],
+			Argv:          []string{os.Args[0], "-test.run=TestHelperProcess", "--", "exec"},
+			Env: slices.DeleteFunc(os.Environ(), func(kv string) bool {
+				return strings.HasPrefix(kv, "GJG_TEST_EXEC_CACHE=")
+			}),
+			WorkDir: cacheDir,
+			Exec:    runner.ExecAuto,
+		}
+		p.Restart.Mode = "never"
+		p.SingleInstance.Scope = "off"
+		_, err := Run(context.Background(), p, Options{CacheDir: cacheDir})
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(100)
+	}
+	args := os.Args
+	for i, a := range args {
+		if a == "--" {
+			args = args[i+1:]
+			break
+		}
+	}
+	fmt.Fprintf(os.Stdout, "args=%s\n", strings.Join(args, " "))
+	fmt.Fprintf(os.Stderr, "extra=%s\n", os.Getenv("EXTRA"))
+	code := 0
+	if len(args) > 0 && args[0] == "fail" {
+		code = 3
+	}
+	os.Exit(code)
+}
+
+func writeFile(t *testing.T, path, content string, mode os.FileMode) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), mode); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoadAndPlan(t *testing.T) {
+	root := t.TempDir()
+	javaName := "java"
+	if runtime.GOOS == "windows" {
+		javaName = "javaw.exe"
+	}
+	binDir := filepath.Join(root, "jdk", "bin")
+	writeFile(t, filepath.Join(binDir, javaName), "", 0755)
+	writeFile(t, filepath.Join(root, "work", "myapp.jar"), "", 0644)
+	writeFile(t, filepath.Join(root, "work", "myapp.gjg.conf"), "jvm_args=-Xmx64m\nenv_EXTRA=yes\nlog_file=launcher.log\n", 0644)
+
+	opts := Options{
+		Executable: filepath.Join(root, "bin", "myapp.exe"),
+		Root:       filepath.Join(root, "work"),
+		Environ:    []string{"PATH=" + binDir, "HOME=/home/me"},
+		CacheDir:   filepath.Join(root, "cache"),
+	}
+	cfg, confPath, err := Load(opts)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if want := filepath.Join(root, "work", "myapp.gjg.conf"); confPath != want {
+		t.Errorf("Load() path = %q, want %q", confPath, want)
+	}
+	if want := filepath.Join(binDir, javaName); cfg.JavaExecutableAbsolutePath != want {
+		t.Errorf("java = %q, want %q (from injected PATH)", cfg.JavaExecutableAbsolutePath, want)
+	}
+	if want := filepath.Join(root, "cache", "launcher.log"); cfg.LogFile != want {
+		t.Errorf("log_file = %q, want %q", cfg.LogFile, want)
+	}
+
+	p, err := Plan(cfg, confPath, []string{"--open"})
+	if err != nil {
+		t.Fatalf("Plan() error = %v", err)
+	}
+	if got := p.Argv[len(p.Argv)-1]; got != "--open" {
+		t.Errorf("Plan() argv = %q, want forwarded args last", p.Argv)
+	}
+	wantEnv := []string{"PATH=" + binDir, "HOME=/home/me", "EXTRA=yes"}
+	if strings.Join(p.Env, "\n") != strings.Join(wantEnv, "\n") {
+		t.Errorf("Plan() env = %q, want %q", p.Env, wantEnv)
+	}
+}
+
+func TestLoadSignature(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		sign    bool
+		tamper  bool
+		wantErr error
+	}{
+		{"signed", true, false, nil},
+		{"unsigned", false, false, signature.ErrUnsigned},
+		{"tampered", true, true, signature.ErrBadSignature},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			binDir := filepath.Join(root, "jdk", "bin")
+			writeFile(t, filepath.Join(binDir, "java"), "", 0755)
+			writeFile(t, filepath.Join(binDir, "javaw.exe"), "", 0755)
+			writeFile(t, filepath.Join(root, "myapp.jar"), "", 0644)
+			confPath := filepath.Join(root, "myapp.gjg.conf")
+			writeFile(t, confPath, "jvm_args=-Xmx64m\nverify=off\n", 0644)
+			if tt.sign {
+				if err := signature.SignFile(priv, confPath); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if tt.tamper {
+				writeFile(t, confPath, "jvm_args=-Xmx64m -javaagent:evil.jar\nverify=off\n", 0644)
+			}
+			opts := Options{Executable: filepath.Join(root, "myapp.exe"), Root: root, Environ: []string{"PATH=" + binDir}, PublicKey: pub}
+			cfg, _, err := Load(opts)
+			if !errors.Is(err, tt.wantErr) || (tt.wantErr == nil) != (err == nil) {
+				t.Fatalf("Load() error = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && cfg.Verify.Mode != "strict" {
+				t.Errorf("verify = %q with a public key, want strict", cfg.Verify.Mode)
+			}
+		})
+	}
+}
+
+func TestVerifyStrictWithKey(t *testing.T) {
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A plan turning verification off still needs a signed manifest
+	v := plan.Verify{Mode: "off", Manifest: filepath.Join(t.TempDir(), "gjg.manifest")}
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	if err := verify(log, v, nil, "", nil); err != nil {
+		t.Errorf("verify() without a key error = %v", err)
+	}
+	if err := verify(log, v, pub, "", nil); err == nil {
+		t.Error("verify() with a key skipped the manifest check")
+	}
+}
+
+func TestLoadNotFound(t *testing.T) {
+	root := t.TempDir()
+	_, _, err := Load(Options{Executable: filepath.Join(root, "myapp.exe"), Root: root, Environ: []string{}})
+	if err == nil {
+		t.Fatal("Load() expected error without a config file")
+	}
+}
+
+func TestLoadSearchPolicy(t *testing.T) {
+	root := t.TempDir()
+	exe := filepath.Join(root, "bin", "myapp.exe")
+	cwd := filepath.Join(root, "downloads")
+	writeFile(t, filepath.Join(cwd, "myapp.gjg.conf"), "java_dir=jdk\n", 0644)
+	writeFile(t, filepath.Join(cwd, "example.gjg.conf"), "java_dir=jdk\n", 0644)
+
+	tests := []struct {
+		policy string
+		want   string
+	}{
+		{"exe", ""},
+		{"exe+cwd", filepath.Join(cwd, "myapp.gjg.conf")},
+		{"dev", filepath.Join(cwd, "myapp.gjg.conf")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.policy, func(t *testing.T) {
+			paths, err := SearchPaths(Options{Executable: exe, Root: cwd, SearchPolicy: tt.policy})
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, confPath, _ := Load(Options{Executable: exe, Root: cwd, Environ: []string{}, SearchPolicy: tt.policy})
+			if confPath != tt.want {
+				t.Errorf("Load() path = %q, want %q (searched %q)", confPath, tt.want, paths)
+			}
+			hasExample := false
+			for _, p := range paths {
+				hasExample = hasExample || filepath.Base(p) == "example.gjg.conf"
+			}
+			if hasExample != (tt.policy == "dev") {
+				t.Errorf("SearchPaths() = %q; example.gjg.conf only belongs to dev", paths)
+			}
+		})
+	}
+
+	if _, err := SearchPaths(Options{Executable: exe, SearchPolicy: "anywhere"}); err == nil {
+		t.Error("SearchPaths() expected error for an unknown policy")
+	}
+}
+
+func TestLoadBaked(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "jdk", "bin", "java"), "", 0755)
+	writeFile(t, filepath.Join(root, "jdk", "bin", "javaw.exe"), "", 0755)
+	writeFile(t, filepath.Join(root, "app.jar"), "", 0644)
+	baked := []byte("java_dir=jdk\njar_file=app.jar\njvm_args=-Xmx1g\nlock=jvm_args, env_*\n")
+
+	tests := []struct {
+		name     string
+		file     string
+		wantJVM  string
+		wantApp  string
+		wantErr  string
+		wantFrom string
+	}{
+		{"no file", "", "-Xmx1g", "", "", config.SourceBaked},
+		{"file layered over", "app_args=--fast\n", "-Xmx1g", "--fast", "", config.SourceBaked},
+		{"locked key", "jvm_args=-Xmx4g\n", "", "", "jvm_args at line 1 is locked", ""},
+		{"locked pattern", "env_JAVA_TOOL_OPTIONS=-javaagent:x.jar\n", "", "", "is locked", ""},
+		{"lock in file", "lock=app_args\n", "", "", "only allowed in the baked configuration", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			confPath := filepath.Join(root, "myapp.gjg.conf")
+			os.Remove(confPath)
+			if tt.file != "" {
+				writeFile(t, confPath, tt.file, 0644)
+			}
+			opts := Options{Executable: filepath.Join(root, "myapp.exe"), Root: root, Environ: []string{}, BakedConfig: baked}
+			cfg, gotPath, err := Load(opts)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Load() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Load() error = %v", err)
+			}
+			if gotPath != confPath {
+				t.Errorf("Load() path = %q, want %q", gotPath, confPath)
+			}
+			if cfg.JVMArgs != tt.wantJVM || cfg.AppArgs != tt.wantApp {
+				t.Errorf("jvm_args, app_args = %q, %q; want %q, %q", cfg.JVMArgs, cfg.AppArgs, tt.wantJVM, tt.wantApp)
+			}
+			if src := cfg.SourceOf("jvm_args"); src.Kind != tt.wantFrom || src.Line != 3 {
+				t.Errorf("jvm_args source = %v, want %s line 3", src, tt.wantFrom)
+			}
+		})
+	}
+}
+
+func TestLoadAppBundle(t *testing.T) {
+	root := t.TempDir()
+	contents := filepath.Join(root, "My App.app", "Contents")
+	resources := filepath.Join(contents, "Resources")
+	for _, name := range []string{"java", "javaw.exe"} {
+		writeFile(t, filepath.Join(resources, "runtime", "Contents", "Home", "bin", name), "", 0755)
+	}
+	writeFile(t, filepath.Join(resources, "myapp.jar"), "", 0644)
+	writeFile(t, filepath.Join(resources, "myapp.gjg.conf"), "java_dir=runtime\n", 0644)
+
+	cfg, confPath, err := Load(Options{
+		Executable:   filepath.Join(contents, "MacOS", "myapp"),
+		Root:         "/",
+		Environ:      []string{},
+		SearchPolicy: "exe",
+	})
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if want := filepath.Join(resources, "myapp.gjg.conf"); confPath != want {
+		t.Errorf("Load() path = %q, want %q", confPath, want)
+	}
+	if want := filepath.Join(resources, "runtime", "Contents", "Home", "bin"); filepath.Dir(cfg.JavaExecutableAbsolutePath) != want {
+		t.Errorf("java = %q, want it under %q", cfg.JavaExecutableAbsolutePath, want)
+	}
+	if want := filepath.Join(resources, "myapp.jar"); cfg.JarFileAbsolutePath != want {
+		t.Errorf("jar = %q, want %q", cfg.JarFileAbsolutePath, want)
+	}
+}
+
+func TestLoadVersioned(t *testing.T) {
+	root := t.TempDir()
+	for _, v := range []string{"1.4.2", "1.5.0"} {
+		for _, name := range []string{"java", "javaw.exe"} {
+			writeFile(t, filepath.Join(root, "versions", v, "runtime", "bin", name), "", 0755)
+		}
+		writeFile(t, filepath.Join(root, "versions", v, "myapp.jar"), "", 0644)
+	}
+	writeFile(t, filepath.Join(root, "versions", "current"), "1.5.0\n", 0644)
+	writeFile(t, filepath.Join(root, "versions", "previous"), "1.4.2\n", 0644)
+	writeFile(t, filepath.Join(root, "myapp.gjg.conf"), "versions_dir=versions\njava_dir=runtime\n", 0644)
+	opts := Options{Executable: filepath.Join(root, "myapp.exe"), Root: root, Environ: []string{}}
+
+	tests := []struct {
+		name string
+		use  string
+		want string
+	}{
+		{"current", "", "1.5.0"},
+		{"use version", "1.4.2", "1.4.2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts.UseVersion = tt.use
+			cfg, _, err := Load(opts)
+			if err != nil {
+				t.Fatalf("Load() error = %v", err)
+			}
+			dir := filepath.Join(root, "versions", tt.want)
+			if cfg.JarFileAbsolutePath != filepath.Join(dir, "myapp.jar") || !strings.HasPrefix(cfg.JavaExecutableAbsolutePath, dir) {
+				t.Errorf("jar, java = %q, %q; want both in %q", cfg.JarFileAbsolutePath, cfg.JavaExecutableAbsolutePath, dir)
+			}
+		})
+	}
+
+	opts.UseVersion = ""
+	cfg, _, err := Load(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, err := RollbackVersion(cfg); err != nil || v != "1.4.2" {
+		t.Fatalf("RollbackVersion() = %q, %v; want 1.4.2", v, err)
+	}
+	if cfg, _, err = Load(opts); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Versions.Selected != "1.4.2" {
+		t.Errorf("version after rollback = %q, want 1.4.2", cfg.Versions.Selected)
+	}
+
+	opts.UseVersion = "9.9"
+	if _, _, err := Load(opts); err == nil {
+		t.Error("Load() expected error for a version that is not installed")
+	}
+}
+
+func TestLoadJavaDownload(t *testing.T) {
+	var archive bytes.Buffer
+	gz := gzip.NewWriter(&archive)
+	tw := tar.NewWriter(gz)
+	for _, name := range []string{"jre/bin/java", "jre/bin/javaw.exe"} {
+		tw.WriteHeader(&tar.Header{Name: name, Mode: 0755, Typeflag: tar.TypeReg})
+	}
+	tw.Close()
+	gz.Close()
+	sum := sha256.Sum256(archive.Bytes())
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.Write(archive.Bytes()) }))
+	defer srv.Close()
+
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "myapp.jar"), "", 0644)
+	writeFile(t, filepath.Join(root, "myapp.gjg.conf"), fmt.Sprintf(
+		"java_download_url=%s/jre-{version}.tar.gz\njava_download_version=17\njava_download_sha256_%s_%s=%x\n",
+		srv.URL, runtime.GOOS, runtime.GOARCH, sum), 0644)
+	opts := Options{Executable: filepath.Join(root, "myapp.exe"), Root: root, Environ: []string{}, RuntimesDir: filepath.Join(root, "runtimes")}
+
+	cfg, _, err := Load(opts)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if !cfg.JavaDownload.Pending || cfg.JavaDownload.URL != srv.URL+"/jre-17.tar.gz" {
+		t.Fatalf("JavaDownload = %+v, want a pending download of jre-17", cfg.JavaDownload)
+	}
+	if installed, err := ProvisionJava(context.Background(), cfg); err != nil || !installed {
+		t.Fatalf("ProvisionJava() = %v, %v", installed, err)
+	}
+	if cfg, _, err = Load(opts); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.JavaDownload.Pending || cfg.JavaLookup != "java_download" || !strings.HasPrefix(cfg.JavaExecutableAbsolutePath, opts.RuntimesDir) {
+		t.Errorf("java = %q (%s), want the cached runtime", cfg.JavaExecutableAbsolutePath, cfg.JavaLookup)
+	}
+}
+
+func TestLoadJNLP(t *testing.T) {
+	root := t.TempDir()
+	binDir := filepath.Join(root, "jdk", "bin")
+	writeFile(t, filepath.Join(binDir, "java"), "", 0755)
+	writeFile(t, filepath.Join(binDir, "javaw.exe"), "", 0755)
+	writeFile(t, filepath.Join(root, "app", "app.jar"), "", 0644)
+	writeFile(t, filepath.Join(root, "app", "app.jnlp"), `<jnlp><resources><jar href="app.jar"/></resources>
+<application-desc main-class="com.example.Main"><argument>--x</argument></application-desc></jnlp>`, 0644)
+
+	// No config file: --gjg-jnlp alone is enough
+	opts := Options{Executable: filepath.Join(root, "myapp.exe"), Root: root, Environ: []string{"PATH=" + binDir}, CacheDir: filepath.Join(root, "cache"), JNLP: filepath.Join(root, "app", "app.jnlp")}
+	cfg, confPath, err := Load(opts)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if _, err := Plan(cfg, confPath, nil); err == nil {
+		t.Fatal("Plan() of an unresolved JNLP application succeeded")
+	}
+	if cfg, confPath, err = Resolve(context.Background(), cfg, confPath, opts); err != nil {
+		t.Fatalf("Resolve() error = %v", err)
+	}
+	p, err := Plan(cfg, confPath, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"-cp", filepath.Join(root, "app", "app.jar"), "com.example.Main", "--x"}
+	if got := p.Argv[1:]; strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("Argv = %q, want java %q", p.Argv, want)
+	}
+
+	// A signed launcher needs a signed configuration to accept --gjg-jnlp
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts.PublicKey = pub
+	if _, _, err := Load(opts); err == nil {
+		t.Error("Load() accepted --gjg-jnlp without a configuration file")
+	}
+	writeFile(t, confPath, "", 0644)
+	if err := signature.SignFile(priv, confPath); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := Load(opts); err != nil {
+		t.Errorf("Load() with a signed configuration error = %v", err)
+	}
+}
+
+func TestLoadDependencies(t *testing.T) {
+	root := t.TempDir()
+	binDir := filepath.Join(root, "jdk", "bin")
+	writeFile(t, filepath.Join(binDir, "java"), "", 0755)
+	writeFile(t, filepath.Join(binDir, "javaw.exe"), "", 0755)
+	writeFile(t, filepath.Join(root, "app", "myapp.jar"), "", 0644)
+	repo := filepath.Join(root, "repo")
+	writeFile(t, filepath.Join(repo, "org", "example", "lib", "1.0", "lib-1.0.pom"), `<project><dependencies>
+<dependency><groupId>org.example</groupId><artifactId>dep</artifactId><version>2.0</version></dependency>
+<dependency><groupId>org.example</groupId><artifactId>junit</artifactId><version>4</version><scope>test</scope></dependency>
+</dependencies></project>`, 0644)
+	writeFile(t, filepath.Join(repo, "org", "example", "lib", "1.0", "lib-1.0.jar"), "lib", 0644)
+	writeFile(t, filepath.Join(repo, "org", "example", "dep", "2.0", "dep-2.0.jar"), "dep", 0644)
+	repoURL := fsutil.ToURL(repo).String()
+	confPath := filepath.Join(root, "app", "myapp.gjg.conf")
+	writeFile(t, confPath, "main_class=com.example.Main\ndependency=org.example:lib:1.0\nrepository="+repoURL+"\n", 0644)
+
+	opts := Options{Executable: filepath.Join(root, "app", "myapp.exe"), Environ: []string{"PATH=" + binDir}, CacheDir: filepath.Join(root, "cache"), MavenDir: filepath.Join(root, "m2")}
+	load := func() *Config {
+		t.Helper()
+		cfg, _, err := Load(opts)
+		if err != nil {
+			t.Fatalf("Load() error = %v", err)
+		}
+		if err := ResolveDependencies(context.Background(), cfg, opts); err != nil {
+			t.Fatalf("ResolveDependencies() error = %v", err)
+		}
+		return cfg
+	}
+	cfg := load()
+	p, err := Plan(cfg, confPath, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	classpath := strings.Join([]string{
+		filepath.Join(root, "app", "myapp.jar"),
+		filepath.Join(root, "m2", "org", "example", "lib", "1.0", "lib-1.0.jar"),
+		filepath.Join(root, "m2", "org", "example", "dep", "2.0", "dep-2.0.jar"),
+	}, string(os.PathListSeparator))
+	want := []string{"-cp", classpath, "com.example.Main"}
+	if got := p.Argv[1:]; strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("Argv = %q, want java %q", p.Argv, want)
+	}
+	lock, err := os.ReadFile(filepath.Join(root, "cache", "myapp.gjg.lock"))
+	if err != nil || !strings.Contains(string(lock), "org.example:dep:2.0") {
+		t.Fatalf("lock file = %s, %v; want the resolved versions", lock, err)
+	}
+
+	// The lock file and local repository are enough without the repository
+	os.RemoveAll(repo)
+	if cfg := load(); len(cfg.Classpath) != 3 {
+		t.Errorf("Classpath from the lock file = %q, want 3 entries", cfg.Classpath)
+	}
+}
+
+func TestPruneVersions(t *testing.T) {
+	root := t.TempDir()
+	for _, v := range []string{"1.0", "1.1"} {
+		writeFile(t, filepath.Join(root, "versions", v, "myapp.jar"), "", 0644)
+	}
+	cfg := &Config{Versions: config.VersionsConfig{Dir: filepath.Join(root, "versions"), Keep: 1, Selected: "1.1"}}
+	confPath := filepath.Join(root, "myapp.gjg.conf")
+
+	// An update in progress holds the update lock
+	lock, err := lockfile.TryAcquire(update.LockPath(root))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if removed, err := PruneVersions(cfg, confPath); err != nil || len(removed) != 0 {
+		t.Errorf("PruneVersions() = %q, %v during an update; want nothing removed", removed, err)
+	}
+	lock.Release()
+	if removed, err := PruneVersions(cfg, confPath); err != nil || len(removed) != 1 {
+		t.Errorf("PruneVersions() = %q, %v; want 1.0 removed", removed, err)
+	}
+}
+
+func TestExecBlockers(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(p *LaunchPlan, o *Options)
+		want   string
+	}{
+		{"plain", func(p *LaunchPlan, o *Options) {}, ""},
+		{"restart", func(p *LaunchPlan, o *Options) { p.Restart.Mode = "on-failure" }, "restart"},
+		{"restart exit codes", func(p *LaunchPlan, o *Options) { p.Restart.ExitCodes = []int{42} }, "restart"},
+		{"heap fallback", func(p *LaunchPlan, o *Options) { p.HeapFallback = []string{"1g"} }, "heap_fallback"},
+		{"console log", func(p *LaunchPlan, o *Options) { p.Console.StderrLog = "err.log" }, "console_log"},
+		{"single instance", func(p *LaunchPlan, o *Options) { p.SingleInstance.Scope = "user" }, "single_instance"},
+		{"post exit", func(p *LaunchPlan, o *Options) { p.Hooks.PostExit = []string{"cleanup"} }, "post_exit"},
+		{"update", func(p *LaunchPlan, o *Options) { p.Update.URL = "https://example.com/update.json" }, "update_url"},
+		{"redirected output", func(p *LaunchPlan, o *Options) { o.Stdout = &bytes.Buffer{} }, "output redirection"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &LaunchPlan{}
+			p.Restart.Mode = "never"
+			p.SingleInstance.Scope = "off"
+			var o Options
+			tt.modify(p, &o)
+			got := strings.Join(execBlockers(p, o), ",")
+			if runtime.GOOS == "windows" {
+				got = strings.TrimPrefix(strings.TrimPrefix(got, "windows"), ",")
+			}
+			if got != tt.want {
+				t.Errorf("execBlockers() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadPlanRedacted(t *testing.T) {
+	p := &LaunchPlan{
+		SchemaVersion: PlanSchemaVersion,
+		Executable:    os.Args[0],
+		Argv:          []string{os.Args[0], "-Dpassword=secret"},
+		WorkDir:       t.TempDir(),
+	}
+	p.Restart.Mode = "never"
+	p.SingleInstance.Scope = "off"
+	p.SingleInstance.Policy = "exit"
+	p.Hooks.OnFailure = "abort"
+	p.Verify.Mode = "off"
+	redactor, err := redact.New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		name    string
+		plan    *LaunchPlan
+		wantErr bool
+	}{
+		{"unmasked", p, false},
+		{"masked", p.Masked(redactor), true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := tt.plan.Write(&buf); err != nil {
+				t.Fatal(err)
+			}
+			path := filepath.Join(t.TempDir(), "plan.json")
+			writeFile(t, path, buf.String(), 0644)
+			got, err := LoadPlan(path, Options{})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("LoadPlan() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && got.Argv[1] != "-Dpassword=secret" {
+				t.Errorf("LoadPlan() argv = %q", got.Argv)
+			}
+		})
+	}
+}
+
+func TestRun(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		wantCode int
+	}{
+		{"success", []string{"hello"}, 0},
+		{"exit code", []string{"fail"}, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &LaunchPlan{
+				SchemaVersion: PlanSchemaVersion,
+				Executable:    os.Args[0],
+				Argv:          append([]string{os.Args[0], "-test.run=TestHelperProcess", "--"}, tt.args...),
+				Env:           append(os.Environ(), "GJG_TEST_HELPER=1", "EXTRA=yes"),
+				WorkDir:       t.TempDir(),
+			}
+			p.Restart.Mode = "never"
+			p.SingleInstance.Scope = "off"
+			p.Hooks.OnFailure = "abort"
+
+			var stdout, stderr bytes.Buffer
+			code, err := Run(context.Background(), p, Options{CacheDir: t.TempDir(), Stdout: &stdout, Stderr: &stderr})
+			if err != nil {
+				t.Fatalf("Run() error = %v", err)
+			}
+			if code != tt.wantCode {
+				t.Errorf("Run() code = %d, want %d", code, tt.wantCode)
+			}
+			if want := "args=" + strings.Join(tt.args, " "); !strings.Contains(stdout.String(), want) {
+				t.Errorf("stdout = %q, want %q", stdout.String(), want)
+			}
+			if !strings.Contains(stderr.String(), "extra=yes") {
+				t.Errorf("stderr = %q, want extra=yes", stderr.String())
+			}
+		})
+	}
+}
+
+func TestRunRecordsFailure(t *testing.T) {
+	cacheDir := t.TempDir()
+	p := &LaunchPlan{
+		SchemaVersion: PlanSchemaVersion,
+		Executable:    os.Args[0],
+		Argv:          []string{os.Args[0], "-test.run=TestHelperProcess", "--", "fail"},
+		Env:           append(os.Environ(), "GJG_TEST_HELPER=1"),
+		WorkDir:       t.TempDir(),
+	}
+	p.Restart.Mode = "never"
+	p.SingleInstance.Scope = "off"
+
+	var out bytes.Buffer
+	if _, err := Run(context.Background(), p, Options{CacheDir: cacheDir, Stdout: &out, Stderr: &out}); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(cacheDir, FailureReportName)); err != nil {
+		t.Errorf("failure report not written: %v", err)
+	}
+	entries, err := history.File{Path: filepath.Join(cacheDir, history.FileName)}.Entries()
+	if err != nil || len(entries) != 1 || entries[0].ExitCode != 3 || !entries[0].Failed() {
+		t.Errorf("history = %+v, %v; want one failed launch with exit code 3", entries, err)
+	}
+}
+
+func TestRunExecRecordsHistory(t *testing.T) {
+	if !runner.CanExec {
+		t.Skip("exec is not supported on " + runtime.GOOS)
+	}
+	cacheDir := t.TempDir()
+	cmd := exec.Command(os.Args[0], "-test.run=TestHelperProcess")
+	cmd.Env = append(os.Environ(), "GJG_TEST_HELPER=1", "GJG_TEST_EXEC_CACHE="+cacheDir)
+	out, err := cmd.CombinedOutput()
+	if err != nil || !strings.Contains(string(out), "args=exec") {
+		t.Fatalf("exec'd launch = %v, %q; want the helper's output", err, out)
+	}
+	entries, err := history.File{Path: filepath.Join(cacheDir, history.FileName)}.Entries()
+	if err != nil || len(entries) != 1 || !entries[0].Exec || entries[0].Failed() {
+		t.Errorf("history = %+v, %v; want one exec'd launch", entries, err)
+	}
+}
+
+func TestRunUpdateTrial(t *testing.T) {
+	const jar = "jar v2"
+	sum := sha256.Sum256([]byte(jar))
+	mux := http.NewServeMux()
+	mux.HandleFunc("/update.json", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(update.Manifest{
+			Version:   "2.0",
+			Artifacts: []update.Artifact{{Path: "app.jar", URL: "app.jar", SHA256: hex.EncodeToString(sum[:])}},
+		})
+	})
+	mux.HandleFunc("/app.jar", func(w http.ResponseWriter, r *http.Request) { io.WriteString(w, jar) })
+	srv := httptest.NewTLSServer(mux)
+	defer srv.Close()
+
+	tests := []struct {
+		name        string
+		args        []string
+		wantVersion string
+		wantJar     string
+	}{
+		{"starts", []string{"hello"}, "2.0", "jar v2"},
+		{"fails at startup", []string{"fail"}, "", "jar v1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeFile(t, filepath.Join(dir, "app.jar"), "jar v1", 0644)
+			u := update.Updater{URL: srv.URL + "/update.json", Dir: dir, Interval: time.Hour, Client: srv.Client()}
+			// Run installs what the check staged, as for --gjg-run-plan
+			if _, err := u.Check(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+
+			p := &LaunchPlan{
+				SchemaVersion: PlanSchemaVersion,
+				Executable:    os.Args[0],
+				Argv:          append([]string{os.Args[0], "-test.run=TestHelperProcess", "--"}, tt.args...),
+				Env:           append(os.Environ(), "GJG_TEST_HELPER=1"),
+				WorkDir:       dir,
+			}
+			p.Restart.Mode = "never"
+			p.SingleInstance.Scope = "off"
+			p.Update.URL = u.URL
+			p.Update.Dir = dir
+			p.Update.Interval = plan.Duration(time.Hour)
+			p.Update.Timeout = plan.Duration(time.Second)
+
+			var out bytes.Buffer
+			if _, err := Run(context.Background(), p, Options{CacheDir: t.TempDir(), Stdout: &out, Stderr: &out}); err != nil {
+				t.Fatalf("Run() error = %v", err)
+			}
+			st, err := u.State()
+			if err != nil || st.Trial || st.Version != tt.wantVersion {
+				t.Errorf("state = %+v, %v; want version %q confirmed", st, err, tt.wantVersion)
+			}
+			data, _ := os.ReadFile(filepath.Join(dir, "app.jar"))
+			if string(data) != tt.wantJar {
+				t.Errorf("app.jar = %q, want %q", data, tt.wantJar)
+			}
+		})
+	}
+}
@@ -0,0 +1,41 @@
+//go:build unix
+
+package launcher
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestRunExec(t *testing.T) {
+	if os.Getenv("GJG_TEST_EXEC") == "1" {
+		// Child: Run replaces this process with the shell, which reports its PID
+		p := &LaunchPlan{
+			SchemaVersion: PlanSchemaVersion,
+			Executable:    "/bin/sh",
+			Argv:          []string{"/bin/sh", "-c", "echo pid=$$; exit 7"},
+			WorkDir:       t.TempDir(),
+			Exec:          "auto",
+		}
+		p.Restart.Mode = "never"
+		p.SingleInstance.Scope = "off"
+		_, err := Run(context.Background(), p, Options{CacheDir: t.TempDir()})
+		t.Fatalf("Run() returned instead of replacing the process: %v", err)
+	}
+
+	cmd := exec.Command(os.Args[0], "-test.run=^TestRunExec$")
+	cmd.Env = append(os.Environ(), "GJG_TEST_EXEC=1")
+	out, err := cmd.Output()
+	var ee *exec.ExitError
+	if !errors.As(err, &ee) || ee.ExitCode() != 7 {
+		t.Fatalf("exit = %v, want 7 from the shell (output %q)", err, out)
+	}
+	if want := "pid=" + strconv.Itoa(cmd.Process.Pid); strings.TrimSpace(string(out)) != want {
+		t.Errorf("output = %q, want %q: Java must keep the launcher's PID", out, want)
+	}
+}
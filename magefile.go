@@ -4,6 +4,7 @@
 package main
 
 import (
+	"encoding/base64"
 	"fmt"
 	"os"
 	"os/exec"
@@ -47,18 +48,51 @@ func getGitVersion() string {
 	return ""
 }
 
+// searchPolicy is where release builds look for their config: GJG_SEARCH_POLICY,
+// or only next to the executable.
+func searchPolicy() string {
+	if p := os.Getenv("GJG_SEARCH_POLICY"); p != "" {
+		return p
+	}
+	return "exe"
+}
+
+// bakedConfig returns the base64 content of the config file named by
+// GJG_BAKED_CONFIG, compiled in as the base configuration.
+func bakedConfig() (string, error) {
+	path := os.Getenv("GJG_BAKED_CONFIG")
+	if path == "" {
+		return "", nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read GJG_BAKED_CONFIG: %w", err)
+	}
+	return base64.StdEncoding.EncodeToString(data), nil
+}
+
 func Build() error {
 	version := getVersion()
-	fmt.Printf("Building GJG Launcher v%s for all Windows architectures...\n\n", version)
+	fmt.Printf("Building GJG Launcher v%s for Windows, Linux and macOS...\n\n", version)
 
 	targets := []struct {
+		goos   string
 		goarch string
 		output string
 		desc   string
 	}{
-		{"amd64", "gjg-launcher-windows-amd64.exe", "Windows 64-bit"},
-		{"386", "gjg-launcher-windows-386.exe", "Windows 32-bit"},
-		{"arm64", "gjg-launcher-windows-arm64.exe", "Windows ARM64"},
+		{"windows", "amd64", "gjg-launcher-windows-amd64.exe", "Windows 64-bit"},
+		{"windows", "386", "gjg-launcher-windows-386.exe", "Windows 32-bit"},
+		{"windows", "arm64", "gjg-launcher-windows-arm64.exe", "Windows ARM64"},
+		{"linux", "amd64", "gjg-launcher-linux-amd64", "Linux 64-bit"},
+		{"linux", "arm64", "gjg-launcher-linux-arm64", "Linux ARM64"},
+		{"darwin", "amd64", "gjg-launcher-darwin-amd64", "macOS Intel"},
+		{"darwin", "arm64", "gjg-launcher-darwin-arm64", "macOS Apple Silicon"},
+	}
+
+	baked, err := bakedConfig()
+	if err != nil {
+		return err
 	}
 
 	if err := os.MkdirAll("bin", 0755); err != nil {
@@ -68,7 +102,17 @@ func Build() error {
 	for _, target := range targets {
 		fmt.Printf("Building %s...\n", target.desc)
 
-		ldflags := fmt.Sprintf("-H windowsgui -X main.version=%s", version)
+		ldflags := fmt.Sprintf("-X main.version=%s", version)
+		if target.goos == "windows" {
+			ldflags = "-H windowsgui " + ldflags
+		}
+		ldflags += " -X gjg/internal/config.SearchPolicy=" + searchPolicy()
+		if baked != "" {
+			ldflags += " -X gjg/internal/config.BakedConfig=" + baked
+		}
+		if key := os.Getenv("GJG_PUBLIC_KEY"); key != "" {
+			ldflags += " -X gjg/internal/signature.PublicKey=" + key
+		}
 
 		cmd := exec.Command("go", "build",
 			"-ldflags", ldflags,
@@ -77,7 +121,7 @@ func Build() error {
 			"./cmd/launcher/main.go")
 
 		cmd.Env = append(os.Environ(),
-			"GOOS=windows",
+			"GOOS="+target.goos,
 			"GOARCH="+target.goarch,
 			"CGO_ENABLED=0",
 		)
@@ -97,7 +141,37 @@ func Build() error {
 	fmt.Printf("\n✅ Build completed successfully!\n")
 	fmt.Printf("📁 Binaries available in: bin/\n")
 	fmt.Printf("📌 Version: %s\n", version)
+	fmt.Printf("🔎 Config search policy: %s\n", searchPolicy())
+	if baked != "" {
+		fmt.Printf("📦 Baked configuration: %s\n", os.Getenv("GJG_BAKED_CONFIG"))
+	}
+	if os.Getenv("GJG_PUBLIC_KEY") != "" {
+		fmt.Printf("🔑 Signature verification enabled (GJG_PUBLIC_KEY)\n")
+	}
+
+	return nil
+}
+
+// Tool builds the gjg release tool (manifest, keygen, sign, stamp) for the host platform.
+func Tool() error {
+	version := getVersion()
+	fmt.Printf("Building gjg tool v%s...\n", version)
+
+	if err := os.MkdirAll("bin", 0755); err != nil {
+		return fmt.Errorf("failed to create bin directory: %w", err)
+	}
+
+	cmd := exec.Command("go", "build",
+		"-ldflags", "-X main.version="+version,
+		"-trimpath",
+		"-o", "./bin/",
+		"./cmd/gjg")
+	cmd.Env = append(os.Environ(), "CGO_ENABLED=0")
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to build gjg tool: %w\n%s", err, output)
+	}
 
+	fmt.Println("✓ bin/gjg")
 	return nil
 }
 